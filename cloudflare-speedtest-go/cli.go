@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"cloudflare-speedtest/internal/downloader"
+	"cloudflare-speedtest/internal/engine"
+	"cloudflare-speedtest/internal/history"
+	"cloudflare-speedtest/internal/notifier"
+	"cloudflare-speedtest/internal/publisher"
+	"cloudflare-speedtest/internal/resultmanager"
+	"cloudflare-speedtest/internal/tester"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes for the run subcommand
+const (
+	exitOK          = 0   // Expected number of qualified servers found
+	exitError       = 1   // Configuration, data or runtime error
+	exitPartial     = 2   // Run finished without reaching expected servers, or verify dropped IPs
+	exitInterrupted = 130 // Run stopped by SIGINT/SIGTERM
+)
+
+// runCommand executes a full test run from the command line
+func runCommand(exeDir string, args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	configPath := fs.String("config", filepath.Join(exeDir, "config.yaml"), "path to config.yaml")
+	dataDir := fs.String("data", exeDir, "directory containing ips-v4.txt, ips-v6.txt, colo.txt and url.txt")
+	output := fs.String("o", "", "result file path (default: <file_path>/result-<timestamp>.<format>)")
+	format := fs.String("format", "csv", "result file format: csv, json, txt, hosts, clash, sing-box, xray or dnsmasq")
+	domain := fs.String("domain", "", "override export.domain for the hosts, dnsmasq and proxy formats")
+	top := fs.Int("top", 0, "override export.top_n for the hosts, dnsmasq and proxy formats")
+	ipType := fs.String("ip-type", "", "override test.ip_type (ipv4 or ipv6)")
+	expected := fs.Int("expected", 0, "override test.expected_servers")
+	bandwidth := fs.Float64("bandwidth", 0, "override test.bandwidth in Mbps")
+	useTLS := fs.Bool("tls", false, "override test.use_tls to true")
+	colos := fs.String("colo", "", "comma separated data center codes to keep (default: all)")
+	lang := fs.String("lang", models.DefaultLanguage, "language of status labels in result files (zh or en)")
+	verify := fs.Bool("verify", false, "retest the qualified IPs of the last run instead of discovering new ones")
+	verifyFile := fs.String("verify-file", "", "retest the IPs listed in this file (one per line, result CSV/TXT files work)")
+	publish := fs.Bool("publish", false, "publish the best IPs to DNS after a successful run (also enabled by publish.enabled)")
+	dryRun := fs.Bool("dry-run", false, "show the DNS changes -publish would make without applying them")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	exportFormat := resultmanager.ExportFormat(*format)
+	switch exportFormat {
+	case resultmanager.FormatCSV, resultmanager.FormatJSON, resultmanager.FormatTXT:
+	default:
+		if !resultmanager.IsBestIPFormat(exportFormat) {
+			fmt.Fprintf(os.Stderr, "Unsupported format: %s. Use csv, json, txt, hosts, clash, sing-box, xray or dnsmasq\n", *format)
+			return exitError
+		}
+	}
+
+	cfg, err := yamlconfig.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return exitError
+	}
+
+	if *domain != "" {
+		cfg.Export.Domain = *domain
+	}
+	if *top > 0 {
+		cfg.Export.TopN = *top
+	}
+
+	if *ipType != "" {
+		cfg.Test.IPType = *ipType
+	}
+	if *expected > 0 {
+		cfg.Test.ExpectedServers = *expected
+	}
+	if *bandwidth > 0 {
+		cfg.Test.Bandwidth = *bandwidth
+	}
+	if *useTLS {
+		cfg.Test.UseTLS = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration validation failed: %v\n", err)
+		return exitError
+	}
+
+	// Catch a missing domain or proxy setting before the run rather than after it
+	exportOpts := resultmanager.NewExportOptions(cfg.Export)
+	if resultmanager.IsBestIPFormat(exportFormat) {
+		if err := exportOpts.Validate(exportFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid export settings: %v\n", err)
+			return exitError
+		}
+	}
+
+	if err := ensureDataFiles(cfg, *dataDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to prepare data files: %v\n", err)
+		return exitError
+	}
+
+	eng := engine.New(*dataDir, engine.Components{})
+	if *colos != "" {
+		eng.ColoManager().SetSelectedDataCenters(splitList(*colos))
+	}
+
+	// Record the run in the shared history unless another process holds the database
+	store, err := history.Open(filepath.Join(*dataDir, "history.db"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Run history disabled: %v\n", err)
+	} else {
+		defer store.Close()
+	}
+
+	plan := engine.NewPlan(cfg)
+	if *verify || *verifyFile != "" {
+		ips, err := verifyIPs(store, *verifyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load IPs to verify: %v\n", err)
+			return exitError
+		}
+		plan.VerifyIPs = ips
+	}
+
+	// Stop gracefully on Ctrl+C so partial results are still written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	events, err := eng.Run(ctx, plan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start test: %v\n", err)
+		return exitError
+	}
+
+	var runID uint64
+	if store != nil {
+		if run, err := store.StartRun(cfg, eng.ColoManager().GetSelectedDataCenters(), history.TriggerCLI); err == nil {
+			runID = run.ID
+		}
+	}
+
+	var summary *engine.Summary
+	for ev := range events {
+		if runID != 0 {
+			if err := store.Record(runID, ev); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to record %s event: %v\n", ev.Type, err)
+			}
+		}
+
+		switch ev.Type {
+		case engine.EventSpeedSample:
+			continue
+		case engine.EventRunFinished:
+			summary = ev.Summary
+		}
+		fmt.Println(ev)
+	}
+
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = filepath.Join(cfg.Test.FilePath,
+			fmt.Sprintf("result-%s.%s", time.Now().Format("20060102-150405"), resultmanager.FileExtension(exportFormat)))
+	}
+
+	// A failed export still reports, notifies and publishes the run
+	stepFailed := false
+	if err := writeResults(eng.ResultManager(), outputPath, exportFormat, exportOpts, models.MatchLanguage(*lang)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write results: %v\n", err)
+		stepFailed = true
+	}
+
+	if summary.Reason == engine.ReasonVerified {
+		fmt.Printf("\nVerified %d IPs (%.0fs), %d still qualified, %d dropped\n",
+			summary.Tested, summary.Duration, summary.Qualified, summary.Dropped)
+	} else {
+		fmt.Printf("\nTested %d IPs in %d batches (%.0fs), %d/%d qualified servers found\n",
+			summary.Tested, summary.Batches, summary.Duration, summary.Qualified, summary.Expected)
+	}
+	if summary.Reason == engine.ReasonBudget {
+		fmt.Printf("Stopped early, run budget exhausted: %s\n", summary.Budget)
+	}
+	if summary.FirstQualified > 0 {
+		fmt.Printf("First qualified server found after %.1fs\n", summary.FirstQualified)
+	}
+	if summary.Pruned > 0 {
+		fmt.Printf("%d IPs skipped by the latency pre-filter\n", summary.Pruned)
+	}
+	fmt.Printf("Data used: %s\n", summary.Traffic)
+	if !stepFailed {
+		fmt.Printf("Results written to: %s\n", outputPath)
+	}
+
+	sendNotifications(cfg.Notify, *dataDir, summary, eng.ResultManager().GetSortedResults("speed", false))
+
+	succeeded := summary.Reason == engine.ReasonCompleted || summary.Reason == engine.ReasonVerified
+	if succeeded && (*publish || cfg.Publish.Enabled) {
+		results := eng.ResultManager().GetSortedResults("speed", false)
+		if err := publishResults(cfg.Publish, *dataDir, results, *dryRun || cfg.Publish.DryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to publish: %v\n", err)
+			stepFailed = true
+		}
+	}
+
+	// An interrupted or partial run keeps its exit code when a step failed too
+	code := runExitCode(summary)
+	if stepFailed && code == exitOK {
+		return exitError
+	}
+	return code
+}
+
+// runExitCode returns the exit code for how a run finished
+func runExitCode(summary *engine.Summary) int {
+	switch summary.Reason {
+	case engine.ReasonCompleted:
+		return exitOK
+	case engine.ReasonVerified:
+		if summary.Dropped > 0 {
+			return exitPartial
+		}
+		return exitOK
+	case engine.ReasonCancelled:
+		return exitInterrupted
+	case engine.ReasonFailed:
+		return exitError
+	default:
+		return exitPartial
+	}
+}
+
+// publishCommand publishes the best IPs of the last run with qualified
+// results, or rolls back the last publish
+func publishCommand(exeDir string, args []string) int {
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	configPath := fs.String("config", filepath.Join(exeDir, "config.yaml"), "path to config.yaml")
+	dataDir := fs.String("data", exeDir, "directory containing history.db and the publish state")
+	dryRun := fs.Bool("dry-run", false, "show the DNS changes without applying them")
+	rollback := fs.Bool("rollback", false, "restore the records replaced by the last publish")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	cfg, err := yamlconfig.LoadAndValidate(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return exitError
+	}
+
+	if *rollback {
+		pub, err := publisher.New(cfg.Publish, *dataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to roll back: %v\n", err)
+			return exitError
+		}
+
+		report, err := pub.Rollback(context.Background(), *dryRun || cfg.Publish.DryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to roll back: %v\n", err)
+			return exitError
+		}
+		printLines(report.Lines())
+		return exitOK
+	}
+
+	store, err := history.Open(filepath.Join(*dataDir, "history.db"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open run history: %v\n", err)
+		return exitError
+	}
+	defer store.Close()
+
+	run, err := store.LatestQualifiedRun()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No previous run with qualified results: %v\n", err)
+		return exitError
+	}
+
+	results, err := store.GetResults(run.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read results of run %d: %v\n", run.ID, err)
+		return exitError
+	}
+
+	// Sort through a result manager so the order matches a live run
+	rm := resultmanager.New(len(results))
+	for _, result := range results {
+		rm.AddResultAllowDuplicate(result)
+	}
+
+	fmt.Printf("Publishing results of run %d (%s)\n", run.ID, run.StartedAt.Format(time.DateTime))
+	if err := publishResults(cfg.Publish, *dataDir, rm.GetSortedResults("speed", false), *dryRun || cfg.Publish.DryRun); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to publish: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// publishResults points the configured hostnames at the best of results and prints the changes
+func publishResults(cfg yamlconfig.PublishConfig, dataDir string, results []*models.SpeedTestResult, dryRun bool) error {
+	pub, err := publisher.New(cfg, dataDir)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	report, err := pub.Publish(ctx, results, dryRun)
+	if err != nil {
+		return err
+	}
+	printLines(report.Lines())
+	return nil
+}
+
+// sendNotifications notifies the enabled notifiers about the finished run.
+// Failed notifications are reported but do not change the exit code.
+func sendNotifications(cfg yamlconfig.NotifyConfig, dataDir string, summary *engine.Summary, results []*models.SpeedTestResult) {
+	n, err := notifier.New(cfg, dataDir)
+	if errors.Is(err, notifier.ErrNoNotifiers) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Notifications skipped: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	for _, d := range n.Notify(ctx, summary, results) {
+		if d.Error != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s notification via %s failed after %d attempts: %s\n", d.Event, d.Channel, d.Attempts, d.Error)
+			continue
+		}
+		fmt.Printf("Sent %s notification via %s\n", d.Event, d.Channel)
+	}
+}
+
+// printLines prints each line on its own
+func printLines(lines []string) {
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// verifyIPs returns the IPs for a verify run: those listed in path if set,
+// otherwise the qualified IPs of the last run recorded in the history
+func verifyIPs(store *history.Store, path string) ([]string, error) {
+	var ips []string
+	if path != "" {
+		list, err := tester.ReadIPList(path)
+		if err != nil {
+			return nil, err
+		}
+		ips = list
+	} else {
+		if store == nil {
+			return nil, fmt.Errorf("run history is not available")
+		}
+		run, list, err := store.LatestQualifiedIPs()
+		if err != nil {
+			return nil, fmt.Errorf("no previous run with qualified results: %w", err)
+		}
+		fmt.Printf("Verifying %d qualified IPs from run %d (%s)\n", len(list), run.ID, run.StartedAt.Format(time.DateTime))
+		ips = list
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IPs to verify")
+	}
+	return ips, nil
+}
+
+// ensureDataFiles downloads any data files missing from dataDir
+func ensureDataFiles(cfg *yamlconfig.Config, dataDir string) error {
+	var missing []downloader.FileInfo
+	for _, file := range downloader.GetFilesFromConfig(cfg.GetAllDownloadURLs()) {
+		if !downloader.FileExists(filepath.Join(dataDir, file.Name)) {
+			missing = append(missing, file)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Downloading %d missing data files...\n", len(missing))
+	return downloader.New().DownloadFiles(missing, dataDir)
+}
+
+// writeResults exports the results of the run to outputPath with status labels in lang.
+// The hosts, dnsmasq and proxy formats use opts instead.
+func writeResults(rm *resultmanager.ResultManager, outputPath string, format resultmanager.ExportFormat, opts resultmanager.ExportOptions, lang string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if resultmanager.IsBestIPFormat(format) {
+		// Render first so a run without completed results leaves no empty config behind
+		var buf bytes.Buffer
+		if err := rm.ExportBest(&buf, format, opts); err != nil {
+			return err
+		}
+		if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write result file: %w", err)
+		}
+		return nil
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create result file: %w", err)
+	}
+	defer file.Close()
+
+	return rm.Export(file, format, "speed", false, lang)
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
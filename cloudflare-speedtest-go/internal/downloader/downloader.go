@@ -1,6 +1,8 @@
 package downloader
 
 import (
+	"cloudflare-speedtest/internal/errorhandler"
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"fmt"
@@ -16,8 +18,7 @@ import (
 // Downloader handles file downloads with enhanced features
 type Downloader struct {
 	timeout      time.Duration
-	maxRetries   int
-	retryDelay   time.Duration
+	errorHandler *errorhandler.ErrorHandler // Classifies failures and paces retries
 	cacheDir     string
 	progressChan chan ProgressInfo
 	mu           sync.RWMutex
@@ -70,8 +71,7 @@ type CacheInfo struct {
 func New() *Downloader {
 	return &Downloader{
 		timeout:      30 * time.Second,
-		maxRetries:   3,
-		retryDelay:   2 * time.Second,
+		errorHandler: errorhandler.New(),
 		progressChan: make(chan ProgressInfo, 100),
 	}
 }
@@ -89,13 +89,13 @@ func (d *Downloader) SetCacheDir(cacheDir string) error {
 	return nil
 }
 
-// SetRetryPolicy sets the retry policy
-func (d *Downloader) SetRetryPolicy(maxRetries int, retryDelay time.Duration) {
+// SetErrorHandler sets the error handler whose retry policies pace download
+// retries, so its error statistics include download failures
+func (d *Downloader) SetErrorHandler(eh *errorhandler.ErrorHandler) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	d.maxRetries = maxRetries
-	d.retryDelay = retryDelay
+	d.errorHandler = eh
 }
 
 // GetProgressChannel returns the progress channel
@@ -129,8 +129,12 @@ func (d *Downloader) DownloadWithProgress(fileInfo FileInfo, outputPath string)
 		cachePath = filepath.Join(d.cacheDir, fileInfo.Name)
 	}
 
-	// Attempt download with retries
-	for attempt := 1; attempt <= d.maxRetries; attempt++ {
+	d.mu.RLock()
+	eh := d.errorHandler
+	d.mu.RUnlock()
+
+	// Attempt download, retrying per the policy of each failure's error type
+	for attempt := 1; ; attempt++ {
 		result.Attempts = attempt
 
 		d.sendProgress(ProgressInfo{
@@ -157,7 +161,8 @@ func (d *Downloader) DownloadWithProgress(fileInfo FileInfo, outputPath string)
 				if verified, verifyErr := d.verifyFileIntegrity(downloadTarget, fileInfo); verifyErr == nil && verified {
 					result.Verified = true
 				} else {
-					err = fmt.Errorf("file verification failed: %w", verifyErr)
+					// A corrupted transfer may well succeed the next time
+					err = errorhandler.Classify(errorhandler.ErrorTypeNetwork, true, fmt.Errorf("file verification failed: %w", verifyErr))
 				}
 			}
 
@@ -165,7 +170,8 @@ func (d *Downloader) DownloadWithProgress(fileInfo FileInfo, outputPath string)
 				// If downloaded to cache, copy to output path (with overwrite)
 				if cachePath != "" && cachePath != outputPath {
 					if err := d.copyFile(cachePath, outputPath); err != nil {
-						result.Error = fmt.Errorf("failed to copy from cache to output: %w", err)
+						result.Error = errorhandler.Classify(errorhandler.ErrorTypeFileIO, true,
+							fmt.Errorf("failed to copy from cache to output: %w", err))
 						d.sendProgress(ProgressInfo{
 							FileName:  fileInfo.Name,
 							Status:    "failed",
@@ -173,6 +179,9 @@ func (d *Downloader) DownloadWithProgress(fileInfo FileInfo, outputPath string)
 							StartTime: startTime,
 							EndTime:   time.Now(),
 						})
+						if !d.shouldRetry(eh, fileInfo, result.Error, attempt) {
+							break
+						}
 						continue
 					}
 					// Clean up cache file after successful copy
@@ -211,9 +220,8 @@ func (d *Downloader) DownloadWithProgress(fileInfo FileInfo, outputPath string)
 			EndTime:   time.Now(),
 		})
 
-		// Wait before retry (except for last attempt)
-		if attempt < d.maxRetries {
-			time.Sleep(d.retryDelay)
+		if !d.shouldRetry(eh, fileInfo, err, attempt) {
+			break
 		}
 	}
 
@@ -221,6 +229,19 @@ func (d *Downloader) DownloadWithProgress(fileInfo FileInfo, outputPath string)
 	return result
 }
 
+// shouldRetry reports the failed attempt to eh and waits out the retry delay.
+// It returns false once the error is not retryable or its retries are used up.
+func (d *Downloader) shouldRetry(eh *errorhandler.ErrorHandler, fileInfo FileInfo, err error, attempt int) bool {
+	errorType, retryable := errorhandler.ClassifyError(err)
+	info := errorhandler.CreateErrorInfo(errorType, errorhandler.SeverityMedium, err.Error(), fileInfo.URL, "downloader", "download_"+fileInfo.Name)
+	info.Retryable = retryable
+	info.RetryCount = attempt - 1
+	if policy := eh.GetRetryPolicy(errorType); policy != nil {
+		info.MaxRetries = policy.MaxRetries
+	}
+	return eh.HandleError(context.Background(), info) == nil
+}
+
 // downloadWithProgressTracking downloads a file with real-time progress tracking
 func (d *Downloader) downloadWithProgressTracking(fileInfo FileInfo, outputPath string) error {
 	client := &http.Client{
@@ -234,7 +255,13 @@ func (d *Downloader) downloadWithProgressTracking(fileInfo FileInfo, outputPath
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+		// Server errors and rate limits are worth retrying, other statuses are not
+		retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		errorType := errorhandler.ErrorTypeValidation
+		if retryable {
+			errorType = errorhandler.ErrorTypeNetwork
+		}
+		return errorhandler.Classify(errorType, retryable, fmt.Errorf("download failed with status %d", resp.StatusCode))
 	}
 
 	// Get content length
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+)
+
+// ConcurrencyMode selects how the number of concurrent datacenter probes is chosen
+type ConcurrencyMode string
+
+const (
+	ConcurrencyFixed    ConcurrencyMode = "fixed"    // Always Workers probes at once
+	ConcurrencyAdaptive ConcurrencyMode = "adaptive" // Start at Workers and adapt between MinWorkers and MaxWorkers
+)
+
+// AIMD tuning. A window of as many probes as the current limit is judged as
+// a whole: the limit shrinks when too many of them timed out or their median
+// latency rose well above the best seen, and grows while neither happens.
+const (
+	aimdMinWindow        = 5    // Fewest probes judged at once
+	aimdIncrease         = 2    // Probes added after a healthy window
+	aimdDecrease         = 0.5  // Factor applied after a congested window
+	aimdMaxTimeoutRatio  = 0.1  // Timeout share above which the window is congested
+	aimdMaxInflation     = 2.0  // Median latency over the baseline above which the window is congested
+	aimdGrowInflation    = 1.5  // Median latency over the baseline below which the limit may grow
+	aimdGrowTimeoutRatio = 0.02 // Timeout share below which the limit may grow
+)
+
+// probeController sizes the number of concurrent datacenter probes with
+// additive increase, multiplicative decrease, so weak routers are not flooded
+// and fast hosts are not left idle
+type probeController struct {
+	mu       sync.Mutex
+	limiter  *limiter
+	adaptive bool
+	min      int
+	max      int
+	workers  int // Configured starting point
+	limit    int
+
+	// Current window
+	probes    int
+	timeouts  int
+	latencies []float64
+
+	baseline float64 // Lowest window median latency seen, in ms
+	degraded bool    // The error handler is in degraded mode
+}
+
+// windowStats describes a judged probe window
+type windowStats struct {
+	probes       int
+	timeoutRatio float64
+	inflation    float64 // Median latency over the baseline, 1 when unknown
+	limit        int     // Limit after the window was judged
+	changed      bool
+}
+
+// newProbeController creates a controller driving l for the plan's probes
+func newProbeController(l *limiter, plan Plan) *probeController {
+	pc := &probeController{
+		limiter:  l,
+		adaptive: plan.Concurrency == ConcurrencyAdaptive,
+		min:      max(1, plan.MinWorkers),
+		max:      max(plan.Workers, plan.MaxWorkers),
+		workers:  plan.Workers,
+		limit:    plan.Workers,
+	}
+	pc.min = min(pc.min, pc.workers)
+	l.setLimit(pc.limit)
+	return pc
+}
+
+// maxProbes returns the most probes that may ever run at once
+func (pc *probeController) maxProbes() int {
+	if pc.adaptive {
+		return pc.max
+	}
+	return pc.workers
+}
+
+// describe returns a one-line description of the probe concurrency
+func (pc *probeController) describe() string {
+	if !pc.adaptive {
+		return fmt.Sprintf("fixed at %d", pc.workers)
+	}
+	return fmt.Sprintf("adaptive, starting at %d (between %d and %d)", pc.workers, pc.min, pc.max)
+}
+
+// observe records the outcome of a probe. Once a window is complete it is
+// judged and returned with ok set; the limit only changes in adaptive mode.
+func (pc *probeController) observe(latency float64, err error) (stats windowStats, ok bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		return windowStats{}, false
+	}
+
+	pc.probes++
+	switch {
+	case isTimeout(err):
+		pc.timeouts++
+	case err == nil && latency > 0:
+		pc.latencies = append(pc.latencies, latency)
+	}
+
+	if !pc.adaptive || pc.probes < max(aimdMinWindow, pc.limit) {
+		return windowStats{}, false
+	}
+
+	stats = windowStats{
+		probes:       pc.probes,
+		timeoutRatio: float64(pc.timeouts) / float64(pc.probes),
+		inflation:    1,
+	}
+	if len(pc.latencies) > 0 {
+		slices.Sort(pc.latencies)
+		median := pc.latencies[len(pc.latencies)/2]
+		if pc.baseline == 0 || median < pc.baseline {
+			pc.baseline = median
+		}
+		stats.inflation = median / pc.baseline
+	}
+
+	limit := pc.limit
+	switch {
+	case stats.timeoutRatio > aimdMaxTimeoutRatio || stats.inflation > aimdMaxInflation:
+		limit = max(pc.min, int(float64(limit)*aimdDecrease))
+	case !pc.degraded && stats.timeoutRatio <= aimdGrowTimeoutRatio && stats.inflation < aimdGrowInflation:
+		limit = min(pc.max, limit+aimdIncrease)
+	}
+	stats.changed = limit != pc.limit
+	stats.limit = limit
+
+	pc.limit = limit
+	pc.limiter.setLimit(limit)
+	pc.probes, pc.timeouts = 0, 0
+	pc.latencies = pc.latencies[:0]
+
+	return stats, true
+}
+
+// degrade divides the limit when the error handler enters degraded mode and
+// returns the new limit. The limit does not grow while degraded; afterwards
+// fixed mode restores it at once and adaptive mode grows it back.
+func (pc *probeController) degrade(degraded bool) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	switch {
+	case degraded && !pc.degraded:
+		pc.limit = max(1, pc.limit/degradedDivisor)
+		if pc.adaptive {
+			pc.limit = max(pc.min, pc.limit)
+		}
+	case !degraded && pc.degraded && !pc.adaptive:
+		pc.limit = pc.workers
+	}
+	pc.degraded = degraded
+
+	pc.limiter.setLimit(pc.limit)
+	return pc.limit
+}
+
+// isTimeout reports whether err is a timeout, the sign of a congested link
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
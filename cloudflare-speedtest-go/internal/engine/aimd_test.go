@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// window is the outcome of one window of probes
+type window struct {
+	latency  float64 // Of every probe that did not time out, in ms
+	timeouts int
+	degraded bool // Degraded mode before the window
+}
+
+// runWindow feeds pc a complete window and returns how it was judged
+func runWindow(t *testing.T, pc *probeController, w window) windowStats {
+	t.Helper()
+	pc.degrade(w.degraded)
+
+	n := max(aimdMinWindow, pc.limit)
+	for i := range n {
+		var err error
+		if i < w.timeouts {
+			err = context.DeadlineExceeded
+		}
+		stats, ok := pc.observe(w.latency, err)
+		if ok != (i == n-1) {
+			t.Fatalf("probe %d of %d: judged = %v", i+1, n, ok)
+		}
+		if ok {
+			return stats
+		}
+	}
+	return windowStats{}
+}
+
+func TestProbeControllerLimits(t *testing.T) {
+	healthy := window{latency: 40}
+
+	tests := []struct {
+		name    string
+		plan    Plan
+		windows []window
+		want    []int // Limit after each window
+	}{
+		{
+			name:    "grows while healthy up to the maximum",
+			plan:    Plan{Concurrency: ConcurrencyAdaptive, Workers: 10, MinWorkers: 2, MaxWorkers: 13},
+			windows: []window{healthy, healthy, healthy},
+			want:    []int{12, 13, 13},
+		},
+		{
+			name:    "halves on timeouts down to the minimum",
+			plan:    Plan{Concurrency: ConcurrencyAdaptive, Workers: 20, MinWorkers: 8, MaxWorkers: 40},
+			windows: []window{{latency: 40, timeouts: 3}, {latency: 40, timeouts: 2}},
+			want:    []int{10, 8},
+		},
+		{
+			name:    "a few timeouts hold the limit",
+			plan:    Plan{Concurrency: ConcurrencyAdaptive, Workers: 20, MinWorkers: 1, MaxWorkers: 50},
+			windows: []window{{latency: 40, timeouts: 1}, healthy},
+			want:    []int{20, 22},
+		},
+		{
+			name:    "one timeout in a small window shrinks",
+			plan:    Plan{Concurrency: ConcurrencyAdaptive, Workers: 5, MinWorkers: 1, MaxWorkers: 50},
+			windows: []window{healthy, healthy, {latency: 40, timeouts: 1}},
+			want:    []int{7, 9, 4},
+		},
+		{
+			name: "latency inflation over the baseline shrinks",
+			plan: Plan{Concurrency: ConcurrencyAdaptive, Workers: 16, MinWorkers: 1, MaxWorkers: 64},
+			// 30 ms sets the baseline, 75 ms is 2.5 times it
+			windows: []window{{latency: 30}, {latency: 75}},
+			want:    []int{18, 9},
+		},
+		{
+			name: "moderate inflation holds",
+			plan: Plan{Concurrency: ConcurrencyAdaptive, Workers: 16, MinWorkers: 1, MaxWorkers: 64},
+			// 1.8 times the baseline is between the grow and shrink thresholds
+			windows: []window{{latency: 50}, {latency: 90}, {latency: 50}},
+			want:    []int{18, 18, 20},
+		},
+		{
+			name:    "degraded mode divides and stops growth",
+			plan:    Plan{Concurrency: ConcurrencyAdaptive, Workers: 24, MinWorkers: 4, MaxWorkers: 48},
+			windows: []window{{latency: 40, degraded: true}, {latency: 40, degraded: true}, healthy},
+			want:    []int{6, 6, 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter(1)
+			pc := newProbeController(l, tt.plan)
+
+			var got []int
+			for _, w := range tt.windows {
+				stats := runWindow(t, pc, w)
+				got = append(got, stats.limit)
+				if l.currentLimit() != stats.limit {
+					t.Errorf("limiter at %d, controller at %d", l.currentLimit(), stats.limit)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("limits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeControllerFixed(t *testing.T) {
+	l := newLimiter(1)
+	pc := newProbeController(l, Plan{Concurrency: ConcurrencyFixed, Workers: 12, MaxWorkers: 100})
+
+	for range 50 {
+		if _, ok := pc.observe(0, context.DeadlineExceeded); ok {
+			t.Fatal("fixed mode judged a window")
+		}
+	}
+	if pc.maxProbes() != 12 || l.currentLimit() != 12 {
+		t.Errorf("maxProbes() = %d, limit = %d, want 12", pc.maxProbes(), l.currentLimit())
+	}
+
+	// Degraded mode still divides the limit and its end restores it
+	if got := pc.degrade(true); got != 3 {
+		t.Errorf("degrade(true) = %d, want 3", got)
+	}
+	if got := pc.degrade(false); got != 12 {
+		t.Errorf("degrade(false) = %d, want 12", got)
+	}
+}
+
+func TestProbeControllerIgnoresCancelled(t *testing.T) {
+	pc := newProbeController(newLimiter(1), Plan{Concurrency: ConcurrencyAdaptive, Workers: 5, MaxWorkers: 10})
+
+	for range 20 {
+		if _, ok := pc.observe(0, context.Canceled); ok {
+			t.Fatal("cancelled probes completed a window")
+		}
+	}
+	if pc.probes != 0 {
+		t.Errorf("counted %d cancelled probes", pc.probes)
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{&timeoutError{}, true},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTimeout(tt.err); got != tt.want {
+			t.Errorf("isTimeout(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+func TestLimiterSetLimitWakesWaiters(t *testing.T) {
+	l := newLimiter(1)
+	ctx := context.Background()
+	if !l.acquire(ctx) {
+		t.Fatal("first acquire failed")
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- l.acquire(ctx) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire did not wait for a free slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.setLimit(2)
+	if !<-acquired {
+		t.Fatal("acquire failed after the limit was raised")
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := newLimiter(0) // Raised to 1
+	ctx, cancel := context.WithCancel(context.Background())
+	if !l.acquire(ctx) {
+		t.Fatal("first acquire failed")
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- l.acquire(ctx) }()
+	cancel()
+
+	if <-acquired {
+		t.Error("acquire succeeded after the context was cancelled")
+	}
+	if l.acquire(ctx) {
+		t.Error("acquire succeeded with a cancelled context")
+	}
+
+	l.release()
+	if !l.acquire(context.Background()) {
+		t.Error("released slot could not be acquired")
+	}
+}
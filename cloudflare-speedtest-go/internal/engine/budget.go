@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// budget holds what a run may use: the test.max_* limits and what is left of
+// the monthly quota. A zero limit is no limit.
+type budget struct {
+	maxDuration time.Duration
+	maxIPs      int
+	maxBytes    int64 // Downloaded bytes
+	maxTraffic  int64 // Probe and download bytes, what is left of the monthly quota
+}
+
+// newBudget creates the budget of a run from the test configuration and the
+// remaining quota
+func newBudget(test yamlconfig.TestConfig, quotaLeft int64) *budget {
+	// An invalid duration was rejected when the configuration was validated
+	duration, _ := time.ParseDuration(test.MaxRunDuration)
+
+	return &budget{
+		maxDuration: max(0, duration),
+		maxIPs:      max(0, test.MaxIPsTested),
+		maxBytes:    max(0, test.MaxBytesDownloaded),
+		maxTraffic:  max(0, quotaLeft),
+	}
+}
+
+// ipsLeft returns how many of n more IPs fit in the budget after queued
+func (b *budget) ipsLeft(queued, n int) int {
+	if b.maxIPs == 0 {
+		return n
+	}
+	return max(0, min(n, b.maxIPs-queued))
+}
+
+// limitsTraffic reports whether the budget has a byte limit
+func (b *budget) limitsTraffic() bool {
+	return b.maxBytes > 0 || b.maxTraffic > 0
+}
+
+// trafficSpent returns which byte limit used has reached, or an empty string
+func (b *budget) trafficSpent(used usage.Usage) string {
+	switch {
+	case b.maxBytes > 0 && used.DownloadBytes >= b.maxBytes:
+		return fmt.Sprintf("max_bytes_downloaded of %s reached", usage.FormatBytes(b.maxBytes))
+	case b.maxTraffic > 0 && used.Total() >= b.maxTraffic:
+		return fmt.Sprintf("monthly quota reached, %s were left", usage.FormatBytes(b.maxTraffic))
+	}
+	return ""
+}
+
+// describe returns the limits of the budget, or an empty string if there are none
+func (b *budget) describe() string {
+	var limits []string
+	if b.maxDuration > 0 {
+		limits = append(limits, b.maxDuration.String())
+	}
+	if b.maxIPs > 0 {
+		limits = append(limits, fmt.Sprintf("%d IPs", b.maxIPs))
+	}
+	if b.maxBytes > 0 {
+		limits = append(limits, usage.FormatBytes(b.maxBytes)+" downloaded")
+	}
+	if b.maxTraffic > 0 {
+		limits = append(limits, usage.FormatBytes(b.maxTraffic)+" of traffic left in the monthly quota")
+	}
+	return strings.Join(limits, ", ")
+}
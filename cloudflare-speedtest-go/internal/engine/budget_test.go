@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudgetIPsLeft(t *testing.T) {
+	tests := []struct {
+		maxIPs, queued, n int
+		want              int
+	}{
+		{maxIPs: 0, queued: 5000, n: 256, want: 256},
+		{maxIPs: 100, queued: 0, n: 256, want: 100},
+		{maxIPs: 100, queued: 90, n: 256, want: 10},
+		{maxIPs: 100, queued: 90, n: 4, want: 4},
+		{maxIPs: 100, queued: 100, n: 256, want: 0},
+		{maxIPs: 100, queued: 130, n: 1, want: 0},
+	}
+
+	for _, tt := range tests {
+		b := newBudget(yamlconfig.TestConfig{MaxIPsTested: tt.maxIPs}, 0)
+		if got := b.ipsLeft(tt.queued, tt.n); got != tt.want {
+			t.Errorf("ipsLeft(%d, %d) with %d IPs = %d, want %d", tt.queued, tt.n, tt.maxIPs, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetTrafficSpent(t *testing.T) {
+	const mib = 1 << 20
+
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		quotaLeft int64
+		used      usage.Usage
+		want      string
+	}{
+		{"no limits", 0, 0, usage.Usage{DownloadBytes: 1 << 40}, ""},
+		{"downloads below the limit", 100 * mib, 0, usage.Usage{DownloadBytes: 99 * mib, ProbeBytes: 5 * mib}, ""},
+		{"downloads at the limit", 100 * mib, 0, usage.Usage{DownloadBytes: 100 * mib}, "max_bytes_downloaded of 100.00 MiB reached"},
+		{"probes count toward the quota", 0, 50 * mib, usage.Usage{DownloadBytes: 45 * mib, ProbeBytes: 5 * mib}, "monthly quota reached, 50.00 MiB were left"},
+		{"uploads count toward the quota", 0, 50 * mib, usage.Usage{UploadBytes: 60 * mib}, "monthly quota reached, 50.00 MiB were left"},
+		{"uploads do not count as downloads", 10 * mib, 0, usage.Usage{UploadBytes: 60 * mib}, ""},
+		{"download limit first", 10 * mib, 10 * mib, usage.Usage{DownloadBytes: 10 * mib}, "max_bytes_downloaded of 10.00 MiB reached"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBudget(yamlconfig.TestConfig{MaxBytesDownloaded: tt.maxBytes}, tt.quotaLeft)
+			if got := b.trafficSpent(tt.used); got != tt.want {
+				t.Errorf("trafficSpent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetDescribe(t *testing.T) {
+	tests := []struct {
+		test      yamlconfig.TestConfig
+		quotaLeft int64
+		want      string
+	}{
+		{yamlconfig.TestConfig{}, 0, ""},
+		{yamlconfig.TestConfig{MaxRunDuration: "90m", MaxIPsTested: 500}, 0, "1h30m0s, 500 IPs"},
+		{yamlconfig.TestConfig{MaxBytesDownloaded: 1 << 30}, 3 << 30, "1.00 GiB downloaded, 3.00 GiB of traffic left in the monthly quota"},
+		{yamlconfig.TestConfig{MaxRunDuration: "-5m", MaxIPsTested: -1, MaxBytesDownloaded: -1}, -1, ""},
+	}
+
+	for i, tt := range tests {
+		b := newBudget(tt.test, tt.quotaLeft)
+		if got := b.describe(); got != tt.want {
+			t.Errorf("case %d: describe() = %q, want %q", i, got, tt.want)
+		}
+	}
+
+	if b := newBudget(yamlconfig.TestConfig{MaxRunDuration: "45s"}, 0); b.maxDuration != 45*time.Second {
+		t.Errorf("maxDuration = %s, want 45s", b.maxDuration)
+	}
+}
+
+func TestCountTrafficStopsInFlightTransfer(t *testing.T) {
+	const limit = 1 << 20
+
+	// An endless download, the fake traffic source. It is paced so the bytes
+	// in flight when the run stops stay well below the limit.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 32<<10)
+		for r.Context().Err() == nil {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		test      yamlconfig.TestConfig
+		quotaLeft int64
+		kind      usage.Kind
+		wantSpent string
+	}{
+		{"download limit", yamlconfig.TestConfig{MaxBytesDownloaded: limit}, 0, usage.KindDownload, "max_bytes_downloaded"},
+		{"monthly quota", yamlconfig.TestConfig{}, limit, usage.KindUpload, "monthly quota reached"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan Event, 16)
+			go func() {
+				for range events {
+				}
+			}()
+			defer close(events)
+
+			e := New(t.TempDir(), Components{})
+			p := newPipeline(context.Background(), e, Plan{Workers: 1}, newBudget(tt.test, tt.quotaLeft), &Summary{}, events)
+			defer p.cancel()
+
+			req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var transferred int64
+			buf := make([]byte, 32<<10)
+			for transferred < 100*limit {
+				n, err := resp.Body.Read(buf)
+				transferred += int64(n)
+				p.countTraffic(tt.kind, int64(n))
+				if err != nil {
+					break
+				}
+			}
+
+			if transferred >= 2*limit {
+				t.Errorf("transferred %s, want the transfer stopped near %s", usage.FormatBytes(transferred), usage.FormatBytes(limit))
+			}
+			if reason, _ := p.stopReason(); reason != ReasonBudget {
+				t.Errorf("stop reason = %q, want %q", reason, ReasonBudget)
+			}
+			if spent := p.budgetSpent(); !strings.Contains(spent, tt.wantSpent) {
+				t.Errorf("budgetSpent() = %q, want %q", spent, tt.wantSpent)
+			}
+		})
+	}
+}
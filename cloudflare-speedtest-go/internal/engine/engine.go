@@ -0,0 +1,574 @@
+package engine
+
+import (
+	"cloudflare-speedtest/internal/colomanager"
+	"cloudflare-speedtest/internal/errorhandler"
+	"cloudflare-speedtest/internal/metrics"
+	"cloudflare-speedtest/internal/resultmanager"
+	"cloudflare-speedtest/internal/scoring"
+	"cloudflare-speedtest/internal/tester"
+	"cloudflare-speedtest/internal/urlmanager"
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRunning is returned by Run when a run is already in progress
+var ErrRunning = errors.New("test already running")
+
+// degradedDivisor divides the probe workers while the error handler is in degraded mode
+const degradedDivisor = 4
+
+// Plan describes the parameters of a single run
+type Plan struct {
+	Test         yamlconfig.TestConfig
+	Workers      int       // Concurrent datacenter probes, the starting point in adaptive mode
+	MinWorkers   int       // Fewest concurrent probes in adaptive mode
+	MaxWorkers   int       // Most concurrent probes in adaptive mode
+	BatchSize    int       // IPs read per batch
+	SpeedMode    SpeedMode // Download scheduling for the speed phase
+	SpeedWorkers int       // Maximum parallel downloads
+	URLStrategy  urlmanager.Strategy
+	Concurrency  ConcurrencyMode          // How the number of concurrent probes is chosen
+	Scoring      yamlconfig.ScoringConfig // Score weights and qualification thresholds
+	Quota        yamlconfig.QuotaConfig   // Monthly data quota shared by every run
+	VerifyIPs    []string                 // Known IPs to retest instead of generating new ones
+}
+
+// IsVerify reports whether the plan retests known IPs instead of discovering new ones
+func (p Plan) IsVerify() bool {
+	return len(p.VerifyIPs) > 0
+}
+
+// scorer returns the scorer judging the plan's results
+func (p Plan) scorer() *scoring.Scorer {
+	return scoring.New(p.Scoring, p.Test.Bandwidth)
+}
+
+// NewPlan builds a plan from the application configuration
+func NewPlan(cfg *yamlconfig.Config) Plan {
+	return Plan{
+		Test:         cfg.Test,
+		Workers:      cfg.Advanced.ConcurrentWorkers,
+		MinWorkers:   cfg.Advanced.MinConcurrentWorkers,
+		MaxWorkers:   cfg.Advanced.MaxConcurrentWorkers,
+		BatchSize:    100,
+		SpeedMode:    SpeedMode(cfg.Test.SpeedMode),
+		SpeedWorkers: cfg.Test.SpeedWorkers,
+		URLStrategy:  urlmanager.Strategy(cfg.Test.URLStrategy),
+		Concurrency:  ConcurrencyMode(cfg.Advanced.ConcurrencyMode),
+		Scoring:      cfg.Scoring,
+		Quota:        cfg.Quota,
+	}
+}
+
+// Components holds the collaborators used by the engine.
+// Nil fields are replaced with defaults rooted at the data directory.
+type Components struct {
+	ResultManager *resultmanager.ResultManager
+	Metrics       *metrics.Metrics
+	ColoManager   *colomanager.ColoManager
+	URLManager    *urlmanager.URLManager
+	IPReader      *tester.IPReader
+	ErrorHandler  *errorhandler.ErrorHandler
+	Usage         *usage.Tracker
+}
+
+// Engine runs the speed test as a pipeline: IPs stream through concurrent
+// datacenter detection and filtering into scheduled speed testing
+type Engine struct {
+	resultManager *resultmanager.ResultManager
+	metrics       *metrics.Metrics
+	coloManager   *colomanager.ColoManager
+	urlManager    *urlmanager.URLManager
+	ipReader      *tester.IPReader
+	errorHandler  *errorhandler.ErrorHandler
+	usage         *usage.Tracker
+	mu            sync.Mutex
+	running       bool
+}
+
+// target is a download endpoint split into host and path
+type target struct {
+	domain   string
+	filePath string
+}
+
+// New creates a new engine
+func New(dataDir string, c Components) *Engine {
+	if c.ResultManager == nil {
+		c.ResultManager = resultmanager.New(1000)
+	}
+	if c.Metrics == nil {
+		c.Metrics = metrics.New()
+	}
+	if c.ColoManager == nil {
+		c.ColoManager = colomanager.New(dataDir)
+	}
+	if c.URLManager == nil {
+		c.URLManager = urlmanager.New(dataDir)
+	}
+	if c.IPReader == nil {
+		c.IPReader = tester.NewIPReader(dataDir)
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = errorhandler.New()
+	}
+	if c.Usage == nil {
+		c.Usage = usage.New(dataDir)
+	}
+
+	return &Engine{
+		resultManager: c.ResultManager,
+		metrics:       c.Metrics,
+		coloManager:   c.ColoManager,
+		urlManager:    c.URLManager,
+		ipReader:      c.IPReader,
+		errorHandler:  c.ErrorHandler,
+		usage:         c.Usage,
+	}
+}
+
+// ResultManager returns the result manager holding the run's results
+func (e *Engine) ResultManager() *resultmanager.ResultManager {
+	return e.resultManager
+}
+
+// Metrics returns the metrics recorded by the engine
+func (e *Engine) Metrics() *metrics.Metrics {
+	return e.metrics
+}
+
+// ColoManager returns the data center manager used for filtering
+func (e *Engine) ColoManager() *colomanager.ColoManager {
+	return e.coloManager
+}
+
+// IPReader returns the reader generating IPs from the learned subnet pool
+func (e *Engine) IPReader() *tester.IPReader {
+	return e.ipReader
+}
+
+// URLManager returns the manager rotating the download URLs
+func (e *Engine) URLManager() *urlmanager.URLManager {
+	return e.urlManager
+}
+
+// ErrorHandler returns the error handler retrying probes and downloads
+func (e *Engine) ErrorHandler() *errorhandler.ErrorHandler {
+	return e.errorHandler
+}
+
+// Usage returns the tracker accounting the traffic of every run
+func (e *Engine) Usage() *usage.Tracker {
+	return e.usage
+}
+
+// IsRunning returns whether a run is in progress
+func (e *Engine) IsRunning() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.running
+}
+
+// Run starts a test run in the background and returns its event stream.
+// Results and metrics from the previous run are cleared. The channel is
+// closed after the EventRunFinished event; callers must drain it.
+// Cancelling ctx stops the run after the IP currently being tested.
+// A run that would go over the monthly quota is refused with an error
+// wrapping usage.ErrQuotaExceeded.
+func (e *Engine) Run(ctx context.Context, plan Plan) (<-chan Event, error) {
+	if plan.Workers < 1 {
+		plan.Workers = 1
+	}
+	if plan.BatchSize < 1 {
+		plan.BatchSize = 100
+	}
+
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return nil, ErrRunning
+	}
+	e.running = true
+	e.mu.Unlock()
+
+	var quotaLeft int64
+	if plan.Quota.MonthlyBytes > 0 {
+		left, err := e.usage.CheckQuota(time.Now(), plan.Quota.MonthlyBytes, plan.Quota.ResetDay)
+		if err != nil {
+			e.setRunning(false)
+			return nil, err
+		}
+		quotaLeft = left
+	}
+
+	if err := e.prepare(plan); err != nil {
+		e.setRunning(false)
+		return nil, err
+	}
+
+	e.resultManager.Clear()
+	e.metrics.Reset()
+	e.metrics.RecordTestStart()
+	e.usage.StartRun()
+
+	events := make(chan Event, 256)
+	go func() {
+		defer close(events)
+		defer e.setRunning(false)
+		e.run(ctx, plan, newBudget(plan.Test, quotaLeft), events)
+	}()
+
+	return events, nil
+}
+
+// setRunning updates the running flag
+func (e *Engine) setRunning(running bool) {
+	e.mu.Lock()
+	e.running = running
+	e.mu.Unlock()
+}
+
+// prepare loads URLs and data centers and resets URL health for the run
+func (e *Engine) prepare(plan Plan) error {
+	if !e.urlManager.HasURLs() {
+		if err := e.urlManager.LoadURLs(); err != nil {
+			return fmt.Errorf("failed to load URLs: %w", err)
+		}
+	}
+
+	if !e.coloManager.HasColos() {
+		if err := e.coloManager.LoadColos(); err != nil {
+			return fmt.Errorf("failed to load data centers: %w", err)
+		}
+	}
+
+	if !e.urlManager.HasURLs() {
+		return fmt.Errorf("no URLs available for testing")
+	}
+
+	e.urlManager.SetStrategy(plan.URLStrategy)
+	e.urlManager.ResetHealth()
+	e.ipReader.Reset()
+	return nil
+}
+
+// parseTarget splits a download URL into domain and file path
+func parseTarget(url string) target {
+	url, _ = strings.CutPrefix(url, "http://")
+	url, _ = strings.CutPrefix(url, "https://")
+
+	parts := strings.SplitN(url, "/", 2)
+	tgt := target{domain: parts[0]}
+	if len(parts) > 1 {
+		tgt.filePath = parts[1]
+	}
+	return tgt
+}
+
+// emit sends an event, stamping its time
+func emit(events chan<- Event, ev Event) {
+	ev.Time = time.Now()
+	events <- ev
+}
+
+// logf emits a free-form log event
+func logf(events chan<- Event, format string, args ...any) {
+	emit(events, Event{Type: EventLog, Message: fmt.Sprintf(format, args...)})
+}
+
+// countTraffic accounts bytes sent and received by a tester
+func (e *Engine) countTraffic(kind usage.Kind, n int64) {
+	e.usage.Add(kind, n)
+	e.metrics.RecordTraffic(string(kind), n)
+}
+
+// run streams IPs through the pipeline until enough qualified servers are
+// found, IPs run out, b is used up or ctx is cancelled
+func (e *Engine) run(ctx context.Context, plan Plan, b *budget, events chan<- Event) {
+	start := time.Now()
+	summary := &Summary{Expected: plan.Test.ExpectedServers}
+
+	defer func() {
+		if r := recover(); r != nil {
+			summary.Reason = ReasonFailed
+			summary.Error = fmt.Sprintf("test panic: %v", r)
+		}
+		if err := e.ipReader.SaveScores(); err != nil {
+			logf(events, "Failed to save subnet scores: %v", err)
+		}
+		summary.Traffic = e.usage.RunUsage()
+		if err := e.usage.Save(); err != nil {
+			logf(events, "Failed to save data usage: %v", err)
+		}
+		summary.Qualified = e.qualifiedCount(plan.Test.Bandwidth)
+		summary.Duration = time.Since(start).Seconds()
+		e.metrics.RecordRunFinished(string(summary.Reason), time.Since(start))
+		emit(events, Event{Type: EventRunFinished, Summary: summary})
+	}()
+
+	emit(events, Event{
+		Type: EventRunStarted,
+		Message: fmt.Sprintf("Target: %d servers with speed >= %.2f Mbps (URLs: %d, rotation: %s, filter: %s)",
+			plan.Test.ExpectedServers, plan.Test.Bandwidth, e.urlManager.URLCount(), e.urlManager.GetStrategy(),
+			e.coloManager.GetFilterMode()),
+	})
+
+	if e.coloManager.GetFilterMode() == "selected" {
+		logf(events, "Selected data centers: %v", e.coloManager.GetSelectedDataCenters())
+	}
+
+	if thresholds := plan.scorer().Describe(); thresholds != "" {
+		logf(events, "Qualified servers also need %s", thresholds)
+	}
+
+	next := func(n int) ([]string, error) {
+		return e.ipReader.ReadIPs(plan.Test.IPType, n)
+	}
+	if plan.IsVerify() {
+		logf(events, "Verify mode: retesting %d known IPs", len(plan.VerifyIPs))
+		next = verifySource(plan.VerifyIPs)
+	}
+
+	p := newPipeline(ctx, e, plan, b, summary, events)
+	if limits := p.budget.describe(); limits != "" {
+		logf(events, "Run budget: at most %s", limits)
+	}
+	p.run(next)
+
+	summary.Reason, summary.Error = p.stopReason()
+	switch {
+	case summary.Reason != "":
+	case ctx.Err() != nil:
+		summary.Reason = ReasonCancelled
+	case p.budgetSpent() != "":
+		summary.Reason = ReasonBudget
+	case plan.IsVerify():
+		summary.Reason = ReasonVerified
+	default:
+		summary.Reason = ReasonExhausted
+	}
+
+	// A stopped verify run still reports the IPs it got to retest
+	if plan.IsVerify() {
+		summary.Dropped = e.reportDropped(plan, p.retestedIPs(), events)
+	}
+
+	if summary.Reason == ReasonCompleted {
+		stats := e.resultManager.GetStats()
+		e.resultManager.SetTotal(stats.Completed)
+	}
+	if summary.Reason == ReasonBudget {
+		summary.Budget = p.budgetSpent()
+	}
+}
+
+// qualifiedCount counts completed results at or above the bandwidth threshold.
+// Completed results have already met the score and latency thresholds.
+func (e *Engine) qualifiedCount(bandwidth float64) int {
+	count := 0
+	for _, r := range e.resultManager.GetQualifiedResults() {
+		if r.Speed >= bandwidth {
+			count++
+		}
+	}
+	return count
+}
+
+// testSpeed re-checks the datacenter and measures the download speed of one IP
+// using the next URL in rotation, reporting its traffic to count. If a URL is
+// refused with an HTTP error the download is retried on another URL. It
+// returns nil if no URL is available, the datacenter lookup fails or ctx is
+// cancelled during the download.
+func (e *Engine) testSpeed(ctx context.Context, plan Plan, batch int, ip string, count func(usage.Kind, int64), events chan<- Event) *models.SpeedTestResult {
+	url, err := e.urlManager.Next()
+	if err != nil {
+		logf(events, "Skipping speed test for %s: %v", ip, err)
+		return nil
+	}
+
+	tgt := parseTarget(url)
+	enhancedTester := tester.NewEnhanced(plan.Test.Timeout)
+	enhancedTester.SetConfig(tgt.domain, tgt.filePath, float64(plan.Test.DownloadTime))
+	enhancedTester.SetRetry(ctx, e.errorHandler)
+	enhancedTester.SetTrafficCounter(count)
+
+	e.resultManager.UpdateCurrentTest(ip, "")
+	testedAt := time.Now()
+
+	datacenter, latency, err := enhancedTester.TestDataCenterOnly(ip, plan.Test.UseTLS, plan.Test.Timeout)
+	if err != nil {
+		logf(events, "Failed to get datacenter info for %s: %v", ip, err)
+		return nil
+	}
+
+	var latencyStats *models.LatencyStats
+	if plan.Test.LatencyProbes > 0 {
+		latencyStats = enhancedTester.MeasureLatency(ctx, ip, plan.Test.UseTLS, plan.Test.Timeout,
+			plan.Test.LatencyProbes, plan.Test.LatencyMethod)
+		if latencyStats.Received > 0 {
+			latency = latencyStats.Median
+		}
+		logf(events, "Latency of %s (%s, %d probes): min %.2f, median %.2f, p95 %.2f, jitter %.2f ms, loss %.0f%%",
+			ip, latencyStats.Method, latencyStats.Probes, latencyStats.Min, latencyStats.Median, latencyStats.P95,
+			latencyStats.Jitter, latencyStats.Loss)
+	}
+
+	enhancedTester.SetSampleCallback(func(sample tester.SpeedSample) {
+		emit(events, Event{
+			Type:    EventSpeedSample,
+			Batch:   batch,
+			IP:      ip,
+			Speed:   sample.Speed,
+			Bytes:   sample.Bytes,
+			Elapsed: sample.Duration,
+		})
+	})
+
+	speedResult, err := enhancedTester.TestSpeedOnly(ctx, ip, plan.Test.UseTLS, plan.Test.Timeout, float64(plan.Test.DownloadTime))
+	for attempt := 1; err != nil && ctx.Err() == nil; attempt++ {
+		if !e.reportURLFailure(url, err, events) || attempt >= e.urlManager.URLCount() {
+			break
+		}
+
+		next, nextErr := e.urlManager.Next()
+		if nextErr != nil {
+			break
+		}
+		url = next
+		logf(events, "Retrying speed test for %s with %s", ip, url)
+
+		tgt = parseTarget(url)
+		enhancedTester.SetConfig(tgt.domain, tgt.filePath, float64(plan.Test.DownloadTime))
+		speedResult, err = enhancedTester.TestSpeedOnly(ctx, ip, plan.Test.UseTLS, plan.Test.Timeout, float64(plan.Test.DownloadTime))
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// The run stopped mid-download, which says nothing about the IP
+		return nil
+	}
+	if err != nil {
+		logf(events, "Speed test failed for %s: %v", ip, err)
+
+		return &models.SpeedTestResult{
+			IP:         ip,
+			Status:     models.StatusInvalid,
+			Latency:    latency,
+			DataCenter: e.coloManager.GetFriendlyName(datacenter),
+			Error:      err.Error(),
+			TestedAt:   testedAt,
+
+			LatencyStats: latencyStats,
+		}
+	}
+
+	e.urlManager.ReportSuccess(url)
+
+	if plan.Test.Bandwidth > 0 && speedResult.Speed < plan.Test.Bandwidth {
+		speedResult.Status = models.StatusSlow
+	}
+
+	speedResult.IP = ip
+	speedResult.Latency = latency
+	speedResult.LatencyStats = latencyStats
+	speedResult.DataCenter = e.coloManager.GetFriendlyName(datacenter)
+	speedResult.TestedAt = testedAt
+
+	if plan.Test.UploadURL != "" {
+		if upload := e.testUpload(ctx, plan, ip, count, events); upload != nil {
+			speedResult.UploadSpeed = upload.Speed
+			speedResult.UploadBytes = upload.Bytes
+		}
+	}
+
+	if reason := plan.scorer().Apply(speedResult); reason != "" {
+		logf(events, "%s does not qualify: %s", ip, reason)
+	}
+	return speedResult
+}
+
+// testUpload measures the upload speed of one IP to the upload endpoint,
+// reporting its traffic to count. A failed upload is logged and leaves the
+// download result as it is, so it returns nil.
+func (e *Engine) testUpload(ctx context.Context, plan Plan, ip string, count func(usage.Kind, int64), events chan<- Event) *tester.UploadResult {
+	uploadTime := plan.Test.UploadTime
+	if uploadTime == 0 {
+		uploadTime = plan.Test.DownloadTime
+	}
+
+	tgt := parseTarget(plan.Test.UploadURL)
+	uploadTester := tester.NewEnhanced(plan.Test.Timeout)
+	uploadTester.SetConfig(tgt.domain, tgt.filePath, float64(uploadTime))
+	uploadTester.SetRetry(ctx, e.errorHandler)
+	uploadTester.SetTrafficCounter(count)
+
+	upload, err := uploadTester.TestUploadOnly(ctx, ip, plan.Test.UseTLS, plan.Test.Timeout, float64(uploadTime))
+	if err != nil {
+		logf(events, "Upload test failed for %s: %v", ip, err)
+		e.metrics.RecordCounter("uploads.failed", 1, nil)
+		return nil
+	}
+
+	logf(events, "Upload speed of %s: %.2f Mbps (peak %.2f Mbps, %s sent)",
+		ip, upload.Speed, upload.PeakSpeed, usage.FormatBytes(upload.Bytes))
+	return upload
+}
+
+// subnetQuality rates a result from 0 to 1 for subnet scoring: failures score 0
+// and a download at exactly the required bandwidth scores 0.5
+func subnetQuality(result *models.SpeedTestResult, bandwidth float64) float64 {
+	if result.Status == models.StatusInvalid || result.Speed <= 0 {
+		return 0
+	}
+	if bandwidth <= 0 {
+		bandwidth = 100
+	}
+	return result.Speed / (result.Speed + bandwidth)
+}
+
+// reportURLFailure records an HTTP error status returned by url, logging if the
+// URL gets disabled. It returns false if err is not an HTTP status error.
+func (e *Engine) reportURLFailure(url string, err error, events chan<- Event) bool {
+	var statusErr *tester.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	if e.urlManager.ReportFailure(url, statusErr.StatusCode) {
+		logf(events, "Disabled test URL %s for the rest of the run (HTTP %d)", url, statusErr.StatusCode)
+	}
+	return true
+}
+
+// storeResult stores a test result using ResultManager and updates metrics
+func (e *Engine) storeResult(result *models.SpeedTestResult) {
+	e.resultManager.AddResultAllowDuplicate(result)
+
+	if result.Status == models.StatusCompleted {
+		e.resultManager.UpdateCurrentTest(result.IP, result.SpeedString())
+
+		duration := 0.0
+		if result.Timing != nil {
+			duration = result.Timing.Transfer.Seconds()
+		}
+		e.metrics.RecordSpeedSample(result.Speed, result.Bytes, duration)
+		e.metrics.RecordLatencySample(result.Latency)
+		e.metrics.RecordTestComplete(true)
+
+		e.metrics.RecordCounter("tests.successful", 1, map[string]string{
+			"datacenter": result.DataCenter,
+		})
+	} else {
+		e.metrics.RecordTestComplete(false)
+		e.metrics.RecordCounter("tests.failed", 1, map[string]string{
+			"status": string(result.Status),
+		})
+	}
+}
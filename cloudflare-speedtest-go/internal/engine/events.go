@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/pkg/models"
+	"fmt"
+	"time"
+)
+
+// EventType identifies the kind of progress event emitted by a run
+type EventType string
+
+const (
+	EventRunStarted   EventType = "run_started"
+	EventBatchStarted EventType = "batch_started"
+	EventProbeResult  EventType = "probe_result"
+	EventIPFiltered   EventType = "ip_filtered"
+	EventIPPruned     EventType = "ip_pruned"  // Left out of the speed phase by the latency pre-filter
+	EventIPDropped    EventType = "ip_dropped" // Verify mode: a known-good IP no longer qualifies
+	EventSpeedSample  EventType = "speed_sample"
+	EventResultStored EventType = "result_stored"
+	EventRunFinished  EventType = "run_finished"
+	EventLog          EventType = "log"
+)
+
+// FinishReason explains why a run ended
+type FinishReason string
+
+const (
+	ReasonCompleted FinishReason = "completed"        // Expected servers were found
+	ReasonCancelled FinishReason = "cancelled"        // Context was cancelled
+	ReasonExhausted FinishReason = "exhausted"        // No more IPs to test
+	ReasonFailed    FinishReason = "failed"           // Run aborted with an error
+	ReasonVerified  FinishReason = "verified"         // Verify run retested every known IP
+	ReasonBudget    FinishReason = "budget_exhausted" // A run budget was used up first
+)
+
+// Event is a single progress notification from a running test.
+// Only the fields relevant to the event type are set.
+type Event struct {
+	Type       EventType               `json:"type"`
+	Time       time.Time               `json:"time"`
+	Batch      int                     `json:"batch,omitempty"`
+	IP         string                  `json:"ip,omitempty"`
+	DataCenter string                  `json:"datacenter,omitempty"`
+	Latency    float64                 `json:"latency,omitempty"` // ms
+	Speed      float64                 `json:"speed,omitempty"`   // Mbps
+	Bytes      int64                   `json:"bytes,omitempty"`
+	Elapsed    float64                 `json:"elapsed,omitempty"` // Seconds since the download started
+	Count      int                     `json:"count,omitempty"`
+	Message    string                  `json:"message,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	Result     *models.SpeedTestResult `json:"result,omitempty"`
+	Summary    *Summary                `json:"summary,omitempty"`
+}
+
+// Summary describes how a run ended
+type Summary struct {
+	Reason    FinishReason `json:"reason"`
+	Batches   int          `json:"batches"`
+	Tested    int          `json:"tested"`
+	Qualified int          `json:"qualified"`
+	Expected  int          `json:"expected"`
+	Dropped   int          `json:"dropped,omitempty"` // Verify mode: IPs that no longer qualify
+	Pruned    int          `json:"pruned,omitempty"`  // IPs left out of the speed phase by latency
+	Duration  float64      `json:"duration_seconds"`
+	Error     string       `json:"error,omitempty"`
+	Budget    string       `json:"budget,omitempty"` // The budget that was used up, when Reason is budget_exhausted
+
+	FirstQualified float64     `json:"first_qualified_seconds,omitempty"` // Time to the first qualified server
+	Traffic        usage.Usage `json:"traffic"`                           // Bytes used by probes and downloads
+}
+
+// Completed reports whether the run found the expected number of servers
+func (s *Summary) Completed() bool {
+	return s.Reason == ReasonCompleted
+}
+
+// String formats the event as a human-readable log line
+func (e Event) String() string {
+	switch e.Type {
+	case EventRunStarted:
+		return e.Message
+	case EventBatchStarted:
+		return fmt.Sprintf("\n=== Batch %d: testing %d IPs ===", e.Batch, e.Count)
+	case EventProbeResult:
+		if e.Error != "" {
+			return fmt.Sprintf("Datacenter test failed for %s: %s", e.IP, e.Error)
+		}
+		return fmt.Sprintf("Valid IP found: %s (datacenter: %s, latency: %.2f ms)", e.IP, e.DataCenter, e.Latency)
+	case EventIPFiltered:
+		return fmt.Sprintf("IP %s filtered out (datacenter: %s not in selected list)", e.IP, e.DataCenter)
+	case EventIPDropped:
+		return fmt.Sprintf("IP %s dropped: %s", e.IP, e.Message)
+	case EventIPPruned:
+		return fmt.Sprintf("IP %s pruned before speed testing: %s", e.IP, e.Message)
+	case EventSpeedSample:
+		return fmt.Sprintf("Speed sample for %s: %.2f Mbps after %.1fs (%d bytes)", e.IP, e.Speed, e.Elapsed, e.Bytes)
+	case EventResultStored:
+		r := e.Result
+		line := fmt.Sprintf("Speed test completed for %s: Status=%s, Speed=%s Mbps, Latency=%s ms, DataCenter=%s",
+			r.IP, r.Status, r.SpeedString(), r.LatencyString(), r.DataCenter)
+		if r.UploadSpeed > 0 {
+			line += fmt.Sprintf(", Upload=%.2f Mbps", r.UploadSpeed)
+		}
+		if t := r.Timing; t != nil {
+			line += fmt.Sprintf(" (connect %s, TLS %s, first byte %s, transfer %s)",
+				t.Connect.Round(time.Millisecond), t.TLSHandshake.Round(time.Millisecond),
+				t.FirstByte.Round(time.Millisecond), t.Transfer.Round(time.Millisecond))
+		}
+		return line
+	case EventRunFinished:
+		s := e.Summary
+		line := fmt.Sprintf("Run finished (%s): %d/%d qualified servers, %d IPs tested in %d batches",
+			s.Reason, s.Qualified, s.Expected, s.Tested, s.Batches)
+		if s.Reason == ReasonVerified {
+			line = fmt.Sprintf("Run finished (%s): %d of %d IPs still qualified, %d dropped",
+				s.Reason, s.Qualified, s.Tested, s.Dropped)
+		} else if s.Dropped > 0 {
+			line += fmt.Sprintf(", %d verified IPs dropped", s.Dropped)
+		}
+		if s.Error != "" {
+			line += ": " + s.Error
+		}
+		if s.Budget != "" {
+			line += ": " + s.Budget
+		}
+		return line
+	default:
+		return e.Message
+	}
+}
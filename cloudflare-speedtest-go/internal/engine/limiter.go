@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"sync"
+)
+
+// limiter bounds how many operations run at once. Unlike a buffered channel
+// used as a semaphore, its limit can change while operations are waiting.
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+// newLimiter creates a limiter allowing limit operations at once
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: max(1, limit)}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits for a free slot. It returns false if ctx is cancelled first.
+func (l *limiter) acquire(ctx context.Context) bool {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.active >= l.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	l.active++
+	return true
+}
+
+// release frees a slot taken by acquire
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.cond.Broadcast()
+}
+
+// setLimit changes how many operations may run at once. Operations already
+// running above a lowered limit are not interrupted.
+func (l *limiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = max(1, limit)
+	l.cond.Broadcast()
+}
+
+// currentLimit returns how many operations may run at once
+func (l *limiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
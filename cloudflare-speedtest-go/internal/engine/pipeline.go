@@ -0,0 +1,636 @@
+package engine
+
+import (
+	"cloudflare-speedtest/internal/tester"
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minCandidateQueue is the smallest number of candidates that may wait for
+// a speed test. It bounds how far probing runs ahead of the downloads.
+const minCandidateQueue = 4
+
+// probeItem is an IP waiting for its datacenter probe
+type probeItem struct {
+	batch int
+	ip    string
+	tgt   target // Only the domain is used, as the Host header
+}
+
+// probeOutcome is the result of a datacenter probe
+type probeOutcome struct {
+	batch      int
+	ip         string
+	dataCenter string
+	latency    float64
+	err        error
+}
+
+// batchState tracks a batch while its probe outcomes pass the filter
+type batchState struct {
+	size     int // IPs queued for probing, set by the generator
+	seen     int
+	filtered int
+	valid    int
+	held     []candidate // Waiting for the rest of the batch when top_k_by_latency is set
+}
+
+// pipeline streams IPs through the stages of a run, each in its own
+// goroutines: generator, datacenter probes, filter and speed tests. The
+// bounded queues between them make a busy stage hold back the ones before
+// it, so probing never runs far ahead of the downloads.
+type pipeline struct {
+	e       *Engine
+	plan    Plan
+	ctx     context.Context // Cancelled when the run stops
+	cancel  context.CancelFunc
+	events  chan<- Event
+	summary *Summary
+	sched   *speedScheduler
+	probes  *probeController
+	budget  *budget
+	start   time.Time
+	queued  int // IPs handed to the probes, owned by the generator
+
+	mu      sync.Mutex
+	batches map[int]*batchState
+	reason  FinishReason // Set by the stage that stopped the run
+	err     string
+	spent   string // The budget that was used up, if any
+
+	retested map[string]bool // Verify mode: IPs whose retest concluded
+}
+
+// newPipeline creates the pipeline of a run limited by b. Its stages record
+// their progress in summary.
+func newPipeline(ctx context.Context, e *Engine, plan Plan, b *budget, summary *Summary, events chan<- Event) *pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	return &pipeline{
+		e:       e,
+		plan:    plan,
+		ctx:     ctx,
+		cancel:  cancel,
+		events:  events,
+		summary: summary,
+		sched:   newSpeedScheduler(plan.SpeedMode, plan.SpeedWorkers, plan.Test.Bandwidth),
+		probes:  newProbeController(newLimiter(plan.Workers), plan),
+		budget:  b,
+		start:   time.Now(),
+		batches: make(map[int]*batchState),
+
+		retested: make(map[string]bool),
+	}
+}
+
+// run streams the IPs returned by next through the stages and returns once
+// every stage has finished. next returns up to n IPs, and an empty batch
+// when IPs run out.
+func (p *pipeline) run(next func(n int) ([]string, error)) {
+	defer p.cancel()
+
+	items := make(chan probeItem, p.plan.Workers)
+	outcomes := make(chan probeOutcome, p.plan.Workers)
+	candidates := make(chan candidate, max(minCandidateQueue, p.plan.SpeedWorkers))
+
+	logf(p.events, "Probe concurrency: %s", p.probes.describe())
+
+	var stages, probers sync.WaitGroup
+	p.spawn(&stages, func() { p.generate(next, items) })
+	for i := 0; i < p.probes.maxProbes(); i++ {
+		p.spawn(&probers, func() { p.probe(items, outcomes) })
+	}
+	p.spawn(&stages, func() {
+		probers.Wait()
+		close(outcomes)
+	})
+	p.spawn(&stages, func() { p.filter(outcomes, candidates) })
+	p.spawn(&stages, func() { p.testSpeeds(candidates) })
+
+	var watchers sync.WaitGroup
+	finished := make(chan struct{})
+	if p.budget.maxDuration > 0 {
+		p.spawn(&watchers, func() { p.watchDuration(finished) })
+	}
+
+	stages.Wait()
+	close(finished)
+	watchers.Wait()
+}
+
+// watchDuration stops the run once the duration budget is used up, unless
+// finished is closed first
+func (p *pipeline) watchDuration(finished <-chan struct{}) {
+	timer := time.NewTimer(p.budget.maxDuration - time.Since(p.start))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		p.exhaust(fmt.Sprintf("max_run_duration of %s reached", p.budget.maxDuration), true)
+	case <-finished:
+	}
+}
+
+// countTraffic accounts bytes sent and received by the testers of the run.
+// Once they reach the byte budget or the monthly quota it stops the run,
+// which cuts short the probes, downloads and uploads in flight.
+func (p *pipeline) countTraffic(kind usage.Kind, n int64) {
+	p.e.countTraffic(kind, n)
+	if !p.budget.limitsTraffic() {
+		return
+	}
+
+	if spent := p.budget.trafficSpent(p.e.usage.RunUsage()); spent != "" {
+		p.exhaust(spent, true)
+	}
+}
+
+// exhaust records that a budget is used up. A run out of time or bytes stops
+// at once; a run out of IPs first finishes testing the IPs already queued.
+func (p *pipeline) exhaust(spent string, stop bool) {
+	p.mu.Lock()
+	first := p.spent == ""
+	if first {
+		p.spent = spent
+	}
+	p.mu.Unlock()
+
+	if first {
+		if stop {
+			logf(p.events, "Run budget exhausted: %s. Stopping with the results so far.", spent)
+		} else {
+			logf(p.events, "Run budget exhausted: %s. Finishing the IPs already read.", spent)
+		}
+		p.e.metrics.RecordCounter("runs.budget_exhausted", 1, nil)
+	}
+	if stop {
+		p.stop(ReasonBudget, "")
+	}
+}
+
+// budgetSpent returns the budget that was used up, or an empty string
+func (p *pipeline) budgetSpent() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.spent
+}
+
+// spawn runs fn in a goroutine tracked by wg. A panic stops the run as
+// failed instead of crashing the process.
+func (p *pipeline) spawn(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Printf("Test panic: %v\n%s", r, debug.Stack())
+				p.stop(ReasonFailed, fmt.Sprintf("test panic: %v", r))
+			}
+		}()
+		fn()
+	}()
+}
+
+// stop ends the run for reason, cancelling the remaining work. Only the
+// first reason is kept.
+func (p *pipeline) stop(reason FinishReason, err string) {
+	p.mu.Lock()
+	if p.reason == "" {
+		p.reason = reason
+		p.err = err
+	}
+	p.mu.Unlock()
+
+	p.cancel()
+}
+
+// stopReason returns the reason the run was stopped by a stage, if any
+func (p *pipeline) stopReason() (FinishReason, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reason, p.err
+}
+
+// markRetested records that the retest of a verified IP concluded, whether
+// or not it still qualifies
+func (p *pipeline) markRetested(ip string) {
+	if !p.plan.IsVerify() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retested[ip] = true
+}
+
+// retestedIPs returns the verified IPs whose retest concluded, in the order
+// of the plan
+func (p *pipeline) retestedIPs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ips := make([]string, 0, len(p.retested))
+	for _, ip := range p.plan.VerifyIPs {
+		if p.retested[ip] {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// generate reads batches of IPs and queues them for probing until they run
+// out or the run stops
+func (p *pipeline) generate(next func(n int) ([]string, error), out chan<- probeItem) {
+	defer close(out)
+
+	for p.ctx.Err() == nil {
+		// Probes only need a Host header, so any enabled URL will do
+		probeURL, err := p.e.urlManager.Next()
+		if err != nil {
+			p.stop(ReasonFailed, "all test URLs are disabled")
+			return
+		}
+
+		n := p.budget.ipsLeft(p.queued, p.plan.BatchSize)
+		if n == 0 {
+			p.exhaust(fmt.Sprintf("max_ips_tested of %d reached", p.budget.maxIPs), false)
+			return
+		}
+
+		ips, err := next(n)
+		if err != nil {
+			p.stop(ReasonFailed, fmt.Sprintf("failed to read IPs: %v", err))
+			return
+		}
+		if len(ips) == 0 {
+			return
+		}
+
+		p.summary.Batches++
+		batch := p.summary.Batches
+		p.queued += len(ips)
+
+		p.mu.Lock()
+		p.batches[batch] = &batchState{size: len(ips)}
+		p.mu.Unlock()
+
+		emit(p.events, Event{Type: EventBatchStarted, Batch: batch, Count: len(ips)})
+		p.checkDegraded()
+
+		tgt := parseTarget(probeURL)
+		for i, ip := range ips {
+			select {
+			case out <- probeItem{batch: batch, ip: ip, tgt: tgt}:
+			case <-p.ctx.Done():
+				// Let the filter finish the batch with the IPs queued so far
+				p.mu.Lock()
+				p.batches[batch].size = i
+				p.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// checkDegraded lowers the number of concurrent probes while the error
+// handler is in degraded mode
+func (p *pipeline) checkDegraded() {
+	degraded := p.e.errorHandler.IsInDegradedMode()
+	limit := p.probes.degrade(degraded)
+	if degraded {
+		logf(p.events, "Degraded mode: error rate is high, probing with at most %d workers", limit)
+		p.e.metrics.RecordCounter("degraded.batches", 1, nil)
+	}
+	p.e.metrics.RecordGauge("probe.concurrency", float64(limit), nil)
+}
+
+// observeProbe feeds a probe outcome to the concurrency controller and
+// reports the windows it judged
+func (p *pipeline) observeProbe(latency float64, err error) {
+	stats, ok := p.probes.observe(latency, err)
+	if !ok {
+		return
+	}
+
+	p.e.metrics.RecordGauge("probe.concurrency", float64(stats.limit), nil)
+	p.e.metrics.RecordGauge("probe.timeout_ratio", stats.timeoutRatio, nil)
+	p.e.metrics.RecordGauge("probe.latency_inflation", stats.inflation, nil)
+
+	if stats.changed {
+		logf(p.events, "Probe concurrency now %d (last %d probes: %.0f%% timeouts, latency x%.2f of baseline)",
+			stats.limit, stats.probes, stats.timeoutRatio*100, stats.inflation)
+	}
+}
+
+// probe runs the datacenter probe of each queued IP, as many at once as the
+// probe controller allows. A slot is taken before an IP is, and held until the
+// filter takes the outcome, so a stalled filter or a lowered limit stops new
+// probes instead of letting IPs and outcomes pile up.
+func (p *pipeline) probe(in <-chan probeItem, out chan<- probeOutcome) {
+	for p.probes.limiter.acquire(p.ctx) {
+		item, ok := <-in
+		if !ok {
+			p.probes.limiter.release()
+			return
+		}
+
+		enhancedTester := tester.NewEnhanced(p.plan.Test.Timeout)
+		enhancedTester.SetConfig(item.tgt.domain, item.tgt.filePath, float64(p.plan.Test.DownloadTime))
+		enhancedTester.SetRetry(p.ctx, p.e.errorHandler)
+		enhancedTester.SetTrafficCounter(p.countTraffic)
+
+		datacenter, latency, err := enhancedTester.TestDataCenterOnly(item.ip, p.plan.Test.UseTLS, p.plan.Test.Timeout)
+		p.observeProbe(latency, err)
+
+		out <- probeOutcome{
+			batch:      item.batch,
+			ip:         item.ip,
+			dataCenter: datacenter,
+			latency:    latency,
+			err:        err,
+		}
+		p.probes.limiter.release()
+	}
+}
+
+// filter reports each probe outcome, drops the IPs outside the selected
+// data centers or latency limits and passes the rest on to the speed tests
+func (p *pipeline) filter(in <-chan probeOutcome, out chan<- candidate) {
+	defer close(out)
+
+	for outcome := range in {
+		p.mu.Lock()
+		state := p.batches[outcome.batch]
+		p.mu.Unlock()
+
+		state.seen++
+		if p.ctx.Err() == nil {
+			p.check(outcome, state, out)
+		}
+
+		p.mu.Lock()
+		done := state.seen >= state.size
+		p.mu.Unlock()
+		if done {
+			p.finishBatch(outcome.batch, state, out)
+		}
+	}
+
+	// Batches cut short when the run stopped
+	p.mu.Lock()
+	remaining := maps.Clone(p.batches)
+	p.mu.Unlock()
+
+	for _, batch := range slices.Sorted(maps.Keys(remaining)) {
+		p.finishBatch(batch, remaining[batch], out)
+	}
+}
+
+// check reports a probe outcome and passes the IP on if it qualifies for a
+// speed test
+func (p *pipeline) check(outcome probeOutcome, state *batchState, out chan<- candidate) {
+	// Only probed IPs count as tested: the generator reads ahead of the probes
+	p.summary.Tested++
+	p.e.resultManager.SetTotal(p.summary.Tested)
+	p.e.metrics.RecordCounter("ips.probed", 1, nil)
+
+	if outcome.err == nil && outcome.dataCenter == "" {
+		outcome.err = fmt.Errorf("no datacenter info found")
+	}
+
+	ev := Event{
+		Type:       EventProbeResult,
+		Batch:      outcome.batch,
+		IP:         outcome.ip,
+		DataCenter: outcome.dataCenter,
+		Latency:    outcome.latency,
+	}
+	if outcome.err != nil {
+		p.e.ipReader.ReportResult(outcome.ip, 0)
+		p.markRetested(outcome.ip)
+		ev.Error = outcome.err.Error()
+		emit(p.events, ev)
+		return
+	}
+
+	if !p.e.coloManager.FilterByDataCenter(outcome.dataCenter) {
+		emit(p.events, Event{Type: EventIPFiltered, Batch: outcome.batch, IP: outcome.ip, DataCenter: outcome.dataCenter})
+		state.filtered++
+		p.markRetested(outcome.ip)
+		return
+	}
+
+	emit(p.events, ev)
+	state.valid++
+
+	c := candidate{batch: outcome.batch, ip: outcome.ip, latency: outcome.latency}
+
+	// A verify run retests every known IP, however slow
+	if p.plan.IsVerify() {
+		p.send(out, c)
+		return
+	}
+
+	if reason := latencyPruneReason(p.plan, c); reason != "" {
+		p.prune(c, reason)
+		return
+	}
+	if p.plan.Test.TopKByLatency > 0 {
+		state.held = append(state.held, c)
+		return
+	}
+	p.send(out, c)
+}
+
+// finishBatch logs the probe summary of a batch and releases the candidates
+// held back for the top_k_by_latency selection
+func (p *pipeline) finishBatch(batch int, state *batchState, out chan<- candidate) {
+	p.mu.Lock()
+	delete(p.batches, batch)
+	p.mu.Unlock()
+
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	logf(p.events, "Batch %d - Datacenter phase summary: Tested=%d, Filtered=%d, Valid=%d",
+		batch, state.seen, state.filtered, state.valid)
+	if state.valid == 0 && state.filtered > 0 {
+		logf(p.events, "WARNING: All %d IPs were filtered out due to datacenter selection. No IPs match the selected datacenters.", state.filtered)
+	}
+
+	if len(state.held) == 0 {
+		return
+	}
+
+	kept, pruned := topKByLatency(state.held, p.plan.Test.TopKByLatency)
+	for _, c := range pruned {
+		p.prune(c, fmt.Sprintf("not among the %d lowest latencies of the batch", p.plan.Test.TopKByLatency))
+	}
+	if len(pruned) > 0 {
+		logf(p.events, "Batch %d: pruned %d of %d IPs by latency, %d left for speed testing",
+			batch, len(pruned), len(state.held), len(kept))
+	}
+
+	for _, c := range kept {
+		p.send(out, c)
+	}
+}
+
+// send queues a candidate for speed testing unless the run stops first
+func (p *pipeline) send(out chan<- candidate, c candidate) {
+	select {
+	case out <- c:
+	case <-p.ctx.Done():
+	}
+}
+
+// testSpeeds speed tests the candidates in waves sized by the scheduler,
+// taking whatever candidates are ready, and stops the run once enough
+// qualified servers are found
+func (p *pipeline) testSpeeds(in <-chan candidate) {
+	expectedBandwidth := p.plan.Test.Bandwidth
+	lastConcurrency := 1
+	lastQualified := 0
+
+	defer p.e.resultManager.UpdateCurrentTest("", "")
+
+	for {
+		var first candidate
+		select {
+		case c, ok := <-in:
+			if !ok {
+				return
+			}
+			first = c
+		case <-p.ctx.Done():
+			return
+		}
+
+		if p.e.urlManager.ActiveCount() == 0 {
+			p.stop(ReasonFailed, "all test URLs are disabled")
+			return
+		}
+
+		n := p.sched.concurrency()
+		if n > 1 && p.e.errorHandler.IsInDegradedMode() {
+			n = 1
+			if n != lastConcurrency {
+				logf(p.events, "Degraded mode: error rate is high, running one download at a time")
+			}
+		} else if n != lastConcurrency {
+			logf(p.events, "Link capacity %.2f Mbps: running %d downloads in parallel", p.sched.linkCapacity(), n)
+		}
+		lastConcurrency = n
+
+		wave := []candidate{first}
+	fill:
+		for len(wave) < n {
+			select {
+			case c, ok := <-in:
+				if !ok {
+					break fill
+				}
+				wave = append(wave, c)
+			default:
+				break fill
+			}
+		}
+
+		p.testWave(wave)
+
+		if p.e.urlManager.ActiveCount() == 0 {
+			p.stop(ReasonFailed, "all test URLs are disabled")
+			return
+		}
+
+		qualified := p.e.qualifiedCount(expectedBandwidth)
+		if qualified > lastQualified {
+			if lastQualified == 0 {
+				p.summary.FirstQualified = time.Since(p.start).Seconds()
+				logf(p.events, "First qualified server found after %.1fs", p.summary.FirstQualified)
+			}
+			logf(p.events, "Current progress: %d servers with speed >= %.2f Mbps (need %d)",
+				qualified, expectedBandwidth, p.plan.Test.ExpectedServers)
+			lastQualified = qualified
+		}
+
+		// A verify run retests every IP, however many still qualify
+		if !p.plan.IsVerify() && qualified >= p.plan.Test.ExpectedServers {
+			logf(p.events, "Found %d qualified servers (speed >= %.2f Mbps). Expected: %d. Stopping the run.",
+				qualified, expectedBandwidth, p.plan.Test.ExpectedServers)
+			p.stop(ReasonCompleted, "")
+			return
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// testWave speed tests the candidates of a wave in parallel and stores the
+// results, re-testing slow ones alone when parallel load may be to blame
+func (p *pipeline) testWave(wave []candidate) {
+	if len(wave) == 1 {
+		logf(p.events, "Speed testing IP %s (batch %d)", wave[0].ip, wave[0].batch)
+	} else {
+		ips := make([]string, len(wave))
+		for i, c := range wave {
+			ips[i] = c.ip
+		}
+		logf(p.events, "Speed testing %d IPs in parallel: %s", len(wave), strings.Join(ips, ", "))
+	}
+
+	results := make([]*models.SpeedTestResult, len(wave))
+	var wg sync.WaitGroup
+	for i, c := range wave {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = p.e.testSpeed(p.ctx, p.plan, c.batch, c.ip, p.countTraffic, p.events)
+		}()
+	}
+	wg.Wait()
+
+	aggregate := 0.0
+	for _, result := range results {
+		if result != nil {
+			aggregate += result.Speed
+		}
+	}
+	p.sched.observe(aggregate)
+
+	for i, result := range results {
+		if result == nil {
+			// A speed test cut short by the stop did not retest the IP
+			if p.ctx.Err() == nil {
+				p.markRetested(wave[i].ip)
+			}
+			continue
+		}
+
+		if result.Status == models.StatusSlow && p.sched.verifyAlone(len(wave)) && p.ctx.Err() == nil {
+			logf(p.events, "Re-testing %s in isolation (%.2f Mbps under parallel load)", result.IP, result.Speed)
+			if retest := p.e.testSpeed(p.ctx, p.plan, wave[i].batch, result.IP, p.countTraffic, p.events); retest != nil {
+				p.sched.observe(retest.Speed)
+				result = retest
+			}
+		}
+
+		p.e.storeResult(result)
+		p.markRetested(result.IP)
+		p.e.ipReader.ReportResult(result.IP, subnetQuality(result, p.plan.Test.Bandwidth))
+		p.e.resultManager.UpdateCurrentTest(result.IP, result.SpeedString())
+		emit(p.events, Event{Type: EventResultStored, Batch: wave[i].batch, IP: result.IP, Result: result})
+	}
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// candidate is an IP that passed the datacenter probe and filter
+type candidate struct {
+	batch   int
+	ip      string
+	latency float64 // ms, measured by the datacenter probe
+}
+
+// latencyPruneReason returns why c is above test.max_latency_ms, or an empty
+// string if it is within the limit or there is none
+func latencyPruneReason(plan Plan, c candidate) string {
+	if plan.Test.MaxLatencyMs > 0 && c.latency > plan.Test.MaxLatencyMs {
+		return fmt.Sprintf("latency %.2f ms is above %.2f ms", c.latency, plan.Test.MaxLatencyMs)
+	}
+	return ""
+}
+
+// topKByLatency sorts candidates by latency, lowest first, and splits off
+// those beyond the k fastest. A k of 0 keeps every candidate.
+func topKByLatency(candidates []candidate, k int) (kept, pruned []candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].latency < candidates[j].latency
+	})
+	if k <= 0 || len(candidates) <= k {
+		return candidates, nil
+	}
+	return candidates[:k], candidates[k:]
+}
+
+// prune reports a candidate left out of the speed tests
+func (p *pipeline) prune(c candidate, reason string) {
+	emit(p.events, Event{Type: EventIPPruned, Batch: c.batch, IP: c.ip, Latency: c.latency, Message: reason})
+	p.summary.Pruned++
+	p.e.metrics.RecordCounter("ips.pruned", 1, nil)
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"math"
+	"sync"
+)
+
+// SpeedMode selects how the speed phase schedules downloads
+type SpeedMode string
+
+const (
+	SpeedModeIsolation SpeedMode = "isolation" // One download at a time
+	SpeedModeParallel  SpeedMode = "parallel"  // Always SpeedWorkers downloads at once
+	SpeedModeAuto      SpeedMode = "auto"      // Parallel when the measured link capacity allows
+)
+
+// speedScheduler decides how many downloads run at once based on the
+// configured mode and the link capacity observed so far in the run
+type speedScheduler struct {
+	mu        sync.Mutex
+	mode      SpeedMode
+	workers   int
+	bandwidth float64 // Per-IP target speed in Mbps
+	capacity  float64 // Highest aggregate throughput observed in Mbps
+}
+
+// newSpeedScheduler creates a scheduler for a run
+func newSpeedScheduler(mode SpeedMode, workers int, bandwidth float64) *speedScheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	if mode == "" {
+		mode = SpeedModeAuto
+	}
+
+	return &speedScheduler{
+		mode:      mode,
+		workers:   workers,
+		bandwidth: bandwidth,
+	}
+}
+
+// concurrency returns the number of downloads to run in the next wave
+func (ss *speedScheduler) concurrency() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	switch ss.mode {
+	case SpeedModeIsolation:
+		return 1
+	case SpeedModeParallel:
+		return ss.workers
+	}
+
+	// Auto: measure alone until capacity is known, then run as many
+	// downloads as the link can carry at the target bandwidth each
+	if ss.workers == 1 || ss.capacity == 0 {
+		return 1
+	}
+	if ss.bandwidth <= 0 {
+		return ss.workers
+	}
+
+	n := int(math.Floor(ss.capacity / ss.bandwidth))
+	if n < 1 {
+		n = 1
+	}
+	if n > ss.workers {
+		n = ss.workers
+	}
+	return n
+}
+
+// observe records the aggregate throughput of a completed wave
+func (ss *speedScheduler) observe(aggregate float64) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if aggregate > ss.capacity {
+		ss.capacity = aggregate
+	}
+}
+
+// linkCapacity returns the highest aggregate throughput observed
+func (ss *speedScheduler) linkCapacity() float64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.capacity
+}
+
+// verifyAlone reports whether a slow result measured under parallel load
+// should be re-measured in isolation before it is recorded
+func (ss *speedScheduler) verifyAlone(waveSize int) bool {
+	return ss.mode == SpeedModeAuto && waveSize > 1
+}
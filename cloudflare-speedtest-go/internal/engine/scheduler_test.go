@@ -0,0 +1,63 @@
+package engine
+
+import "testing"
+
+func TestSpeedSchedulerConcurrency(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      SpeedMode
+		workers   int
+		bandwidth float64
+		observed  []float64 // Aggregate throughput of the waves so far
+		want      int
+	}{
+		{"isolation", SpeedModeIsolation, 4, 50, nil, 1},
+		{"isolation ignores capacity", SpeedModeIsolation, 4, 50, []float64{1000}, 1},
+		{"parallel", SpeedModeParallel, 4, 50, nil, 4},
+		{"parallel ignores capacity", SpeedModeParallel, 4, 50, []float64{60}, 4},
+		{"parallel with invalid workers", SpeedModeParallel, 0, 50, nil, 1},
+
+		{"auto alone until capacity is known", SpeedModeAuto, 4, 50, nil, 1},
+		{"auto with one worker", SpeedModeAuto, 1, 50, []float64{1000}, 1},
+		{"auto fits the capacity", SpeedModeAuto, 8, 100, []float64{250}, 2},
+		{"auto at exactly the capacity", SpeedModeAuto, 8, 100, []float64{300}, 3},
+		{"auto below the bandwidth", SpeedModeAuto, 4, 100, []float64{60}, 1},
+		{"auto capped at the workers", SpeedModeAuto, 4, 50, []float64{1000}, 4},
+		{"auto keeps the highest capacity", SpeedModeAuto, 8, 100, []float64{400, 150}, 4},
+		{"auto without a bandwidth", SpeedModeAuto, 4, 0, []float64{10}, 4},
+		{"empty mode is auto", "", 4, 100, []float64{200}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := newSpeedScheduler(tt.mode, tt.workers, tt.bandwidth)
+			for _, aggregate := range tt.observed {
+				ss.observe(aggregate)
+			}
+			if got := ss.concurrency(); got != tt.want {
+				t.Errorf("concurrency() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedSchedulerVerifyAlone(t *testing.T) {
+	tests := []struct {
+		mode     SpeedMode
+		waveSize int
+		want     bool
+	}{
+		{SpeedModeAuto, 1, false},
+		{SpeedModeAuto, 2, true},
+		{"", 3, true},
+		{SpeedModeParallel, 4, false},
+		{SpeedModeIsolation, 1, false},
+	}
+
+	for _, tt := range tests {
+		ss := newSpeedScheduler(tt.mode, 4, 50)
+		if got := ss.verifyAlone(tt.waveSize); got != tt.want {
+			t.Errorf("verifyAlone(%d) in mode %q = %t, want %t", tt.waveSize, tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"cloudflare-speedtest/pkg/models"
+	"fmt"
+)
+
+// verifySource returns an IP source yielding the known IPs of a verify run
+func verifySource(ips []string) func(n int) ([]string, error) {
+	return func(n int) ([]string, error) {
+		batch := ips[:min(n, len(ips))]
+		ips = ips[len(batch):]
+		return batch, nil
+	}
+}
+
+// reportDropped emits an EventIPDropped for every retested IP whose latest
+// result is missing, failed or below the bandwidth, score or latency
+// threshold, and returns how many were dropped. IPs the run stopped before
+// retesting are left out.
+func (e *Engine) reportDropped(plan Plan, retested []string, events chan<- Event) int {
+	latest := make(map[string]*models.SpeedTestResult)
+	for _, result := range e.resultManager.GetResults() {
+		latest[result.IP] = result
+	}
+
+	dropped := 0
+	for _, ip := range retested {
+		result, ok := latest[ip]
+
+		var reason string
+		switch {
+		case !ok:
+			reason = "unreachable or filtered out in the datacenter phase"
+		case result.Status == models.StatusInvalid:
+			reason = "speed test failed: " + result.Error
+		case result.Speed < plan.Test.Bandwidth:
+			reason = fmt.Sprintf("speed %.2f Mbps is below %.2f Mbps", result.Speed, plan.Test.Bandwidth)
+		case result.Status == models.StatusUnqualified:
+			reason = plan.scorer().Reject(result)
+		default:
+			continue
+		}
+
+		ev := Event{Type: EventIPDropped, IP: ip, Message: reason}
+		if ok {
+			ev.DataCenter = result.DataCenter
+			ev.Latency = result.Latency
+			ev.Speed = result.Speed
+			ev.Result = result
+		}
+		emit(events, ev)
+		dropped++
+	}
+
+	e.metrics.RecordCounter("ips.dropped", float64(dropped), nil)
+	if skipped := len(plan.VerifyIPs) - len(retested); skipped > 0 {
+		logf(events, "Verified %d of %d IPs: %d still qualified, %d dropped, %d not retested",
+			len(retested), len(plan.VerifyIPs), len(retested)-dropped, dropped, skipped)
+	} else {
+		logf(events, "Verified %d IPs: %d still qualified, %d dropped",
+			len(retested), len(retested)-dropped, dropped)
+	}
+
+	return dropped
+}
+
+// QualifiedIPs returns the distinct IPs of completed results at or above
+// bandwidth, in the order given
+func QualifiedIPs(results []*models.SpeedTestResult, bandwidth float64) []string {
+	seen := make(map[string]bool)
+	ips := make([]string, 0)
+
+	for _, result := range results {
+		if result.Status != models.StatusCompleted || result.Speed < bandwidth || seen[result.IP] {
+			continue
+		}
+		seen[result.IP] = true
+		ips = append(ips, result.IP)
+	}
+
+	return ips
+}
@@ -20,6 +20,7 @@ const (
 	ErrorTypeSpeedTest  ErrorType = "speedtest"
 	ErrorTypeConfig     ErrorType = "config"
 	ErrorTypeFileIO     ErrorType = "fileio"
+	ErrorTypeNotify     ErrorType = "notify"
 )
 
 // ErrorSeverity represents the severity level of an error
@@ -64,6 +65,9 @@ type ErrorHandler struct {
 	logger        *StructuredLogger
 	degraded      bool
 	degradedUntil time.Time
+	outcomes      [degradeWindow]bool // Recent results of Retry, true for success
+	outcomeNext   int
+	outcomeCount  int
 }
 
 // ErrorStats tracks statistics for each error type
@@ -161,6 +165,13 @@ func (eh *ErrorHandler) setDefaultPolicies() {
 			BackoffFactor: 2.0,
 			Jitter:        true,
 		},
+		ErrorTypeNotify: {
+			MaxRetries:    3,
+			InitialDelay:  2 * time.Second,
+			MaxDelay:      30 * time.Second,
+			BackoffFactor: 2.0,
+			Jitter:        true,
+		},
 	}
 
 	for errorType, policy := range policies {
@@ -170,6 +181,25 @@ func (eh *ErrorHandler) setDefaultPolicies() {
 
 // HandleError processes an error with retry logic and logging
 func (eh *ErrorHandler) HandleError(ctx context.Context, errorInfo *ErrorInfo) error {
+	delay, err := eh.nextRetry(errorInfo)
+	if err != nil {
+		return err
+	}
+
+	// Wait for retry delay without holding the lock so concurrent callers are not serialized
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		// Continue with retry
+	}
+
+	return nil // Indicate that retry should be attempted
+}
+
+// nextRetry records the error and returns the delay before the next retry,
+// or an error if the operation should not be retried
+func (eh *ErrorHandler) nextRetry(errorInfo *ErrorInfo) (time.Duration, error) {
 	eh.mu.Lock()
 	defer eh.mu.Unlock()
 
@@ -181,13 +211,13 @@ func (eh *ErrorHandler) HandleError(ctx context.Context, errorInfo *ErrorInfo) e
 
 	// Check if error is retryable
 	if !errorInfo.Retryable {
-		return fmt.Errorf("non-retryable error: %s", errorInfo.Message)
+		return 0, fmt.Errorf("non-retryable error: %s", errorInfo.Message)
 	}
 
 	// Get retry policy for this error type
 	policy, exists := eh.retryPolicies[errorInfo.Type]
 	if !exists || policy.MaxRetries == 0 {
-		return fmt.Errorf("no retry policy or retries exhausted: %s", errorInfo.Message)
+		return 0, fmt.Errorf("no retry policy or retries exhausted: %s", errorInfo.Message)
 	}
 
 	// Check if we've exceeded max retries
@@ -199,7 +229,7 @@ func (eh *ErrorHandler) HandleError(ctx context.Context, errorInfo *ErrorInfo) e
 			"component":   errorInfo.Component,
 			"operation":   errorInfo.Operation,
 		})
-		return fmt.Errorf("max retries (%d) exceeded: %s", policy.MaxRetries, errorInfo.Message)
+		return 0, fmt.Errorf("max retries (%d) exceeded: %s", policy.MaxRetries, errorInfo.Message)
 	}
 
 	// Calculate delay for next retry
@@ -213,15 +243,7 @@ func (eh *ErrorHandler) HandleError(ctx context.Context, errorInfo *ErrorInfo) e
 		"operation":   errorInfo.Operation,
 	})
 
-	// Wait for retry delay
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(delay):
-		// Continue with retry
-	}
-
-	return nil // Indicate that retry should be attempted
+	return delay, nil
 }
 
 // HandleSuccess records a successful operation
@@ -295,8 +317,8 @@ func (eh *ErrorHandler) EnableDegradedMode(duration time.Duration) {
 
 // IsInDegradedMode returns whether the system is in degraded mode
 func (eh *ErrorHandler) IsInDegradedMode() bool {
-	eh.mu.RLock()
-	defer eh.mu.RUnlock()
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
 
 	if !eh.degraded {
 		return false
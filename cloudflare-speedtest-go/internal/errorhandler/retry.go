@@ -0,0 +1,211 @@
+package errorhandler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"time"
+)
+
+// Degraded mode switches on when at least degradeErrorRate of the last
+// degradeWindow operations failed, once degradeMinSamples have been seen
+const (
+	degradeWindow     = 50
+	degradeMinSamples = 20
+	degradeErrorRate  = 0.8
+	degradeDuration   = 2 * time.Minute
+)
+
+// ClassifiedError attaches an error type to an error so Retry knows which
+// policy applies and whether retrying can help
+type ClassifiedError struct {
+	Type      ErrorType
+	Retryable bool
+	Err       error
+}
+
+func (e *ClassifiedError) Error() string { return e.Err.Error() }
+
+func (e *ClassifiedError) Unwrap() error { return e.Err }
+
+// Classify wraps err with an error type. It returns nil for a nil err.
+func Classify(errorType ErrorType, retryable bool, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ClassifiedError{Type: errorType, Retryable: retryable, Err: err}
+}
+
+// ClassifyError returns the error type of err and whether retrying may help.
+// Errors wrapped by Classify keep their type; otherwise network and file
+// errors are recognized and anything else is a non-retryable system error.
+func ClassifyError(err error) (ErrorType, bool) {
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Type, classified.Retryable
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrorTypeSystem, false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTypeTimeout, true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTypeTimeout, true
+		}
+		return ErrorTypeNetwork, true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return ErrorTypeNetwork, true
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ErrorTypeFileIO, true
+	}
+
+	return ErrorTypeSystem, false
+}
+
+// Retry calls fn until it succeeds, returns an error that is not retryable,
+// exhausts the retry policy of its error type or ctx is cancelled. The final
+// outcome feeds the error rate that switches degraded mode on. subject names
+// what is being operated on, such as an IP, for the logs.
+func (eh *ErrorHandler) Retry(ctx context.Context, component, operation, subject string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			eh.recordSuccess(component, operation, subject, attempt)
+			return nil
+		}
+
+		errorType, retryable := ClassifyError(err)
+		if !retryable || ctx.Err() != nil {
+			eh.recordFailure(errorType, attempt)
+			return err
+		}
+
+		retryErr := eh.HandleError(ctx, &ErrorInfo{
+			Type:       errorType,
+			Severity:   SeverityMedium,
+			Message:    err.Error(),
+			Context:    subject,
+			Timestamp:  time.Now(),
+			Retryable:  true,
+			RetryCount: attempt,
+			MaxRetries: eh.maxRetries(errorType),
+			Component:  component,
+			Operation:  operation,
+		})
+		if retryErr != nil {
+			eh.recordOutcome(errorType, false)
+			return err
+		}
+	}
+}
+
+// ErrorRate returns the share of recent operations run through Retry that failed
+func (eh *ErrorHandler) ErrorRate() float64 {
+	eh.mu.RLock()
+	defer eh.mu.RUnlock()
+
+	if eh.outcomeCount == 0 {
+		return 0
+	}
+	failed := 0
+	for _, ok := range eh.outcomes[:eh.outcomeCount] {
+		if !ok {
+			failed++
+		}
+	}
+	return float64(failed) / float64(eh.outcomeCount)
+}
+
+// maxRetries returns the retry limit of the policy for errorType
+func (eh *ErrorHandler) maxRetries(errorType ErrorType) int {
+	if policy := eh.GetRetryPolicy(errorType); policy != nil {
+		return policy.MaxRetries
+	}
+	return 0
+}
+
+// recordSuccess counts a successful operation, logging only those that needed retries
+func (eh *ErrorHandler) recordSuccess(component, operation, subject string, retries int) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	eh.addOutcome(true)
+	if retries > 0 {
+		eh.logger.LogInfo("Operation succeeded after retry", map[string]interface{}{
+			"component": component,
+			"operation": operation,
+			"context":   subject,
+			"retries":   retries,
+		})
+	}
+}
+
+// recordFailure counts an operation that failed without being retried.
+// It is not logged: most such failures are expected, like unreachable IPs.
+func (eh *ErrorHandler) recordFailure(errorType ErrorType, retries int) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	eh.updateErrorStats(&ErrorInfo{Type: errorType, RetryCount: retries})
+	eh.addOutcome(errorType == ErrorTypeValidation)
+}
+
+// recordOutcome counts the final outcome of an operation whose error was
+// already recorded by HandleError
+func (eh *ErrorHandler) recordOutcome(errorType ErrorType, ok bool) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	eh.addOutcome(ok || errorType == ErrorTypeValidation)
+}
+
+// addOutcome adds an outcome to the sliding window and enables degraded mode
+// when the error rate spikes. Validation failures describe the input rather
+// than the system and are passed in as ok. The caller must hold eh.mu.
+func (eh *ErrorHandler) addOutcome(ok bool) {
+	eh.outcomes[eh.outcomeNext] = ok
+	eh.outcomeNext = (eh.outcomeNext + 1) % degradeWindow
+	if eh.outcomeCount < degradeWindow {
+		eh.outcomeCount++
+	}
+
+	if eh.degraded && time.Now().Before(eh.degradedUntil) {
+		return
+	}
+	if eh.outcomeCount < degradeMinSamples {
+		return
+	}
+
+	failed := 0
+	for _, outcome := range eh.outcomes[:eh.outcomeCount] {
+		if !outcome {
+			failed++
+		}
+	}
+	rate := float64(failed) / float64(eh.outcomeCount)
+	if rate < degradeErrorRate {
+		return
+	}
+
+	eh.degraded = true
+	eh.degradedUntil = time.Now().Add(degradeDuration)
+	eh.outcomeCount = 0
+	eh.outcomeNext = 0
+
+	eh.logger.LogWarning("Degraded mode enabled: error rate spiked", map[string]interface{}{
+		"error_rate":       rate,
+		"duration_minutes": degradeDuration.Minutes(),
+		"until":            eh.degradedUntil.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,349 @@
+package history
+
+import (
+	"cloudflare-speedtest/internal/engine"
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	runsBucket    = []byte("runs")
+	resultsBucket = []byte("results")
+)
+
+// ErrNotFound is returned when a run does not exist
+var ErrNotFound = errors.New("run not found")
+
+// Trigger sources recorded on a run
+const (
+	TriggerAPI      = "api"      // Started from the web UI or API
+	TriggerSchedule = "schedule" // Started by the built-in scheduler
+	TriggerCLI      = "cli"      // Started by the run command
+)
+
+// Run is a persisted record of a single test run
+type Run struct {
+	ID          uint64                  `json:"id"`
+	StartedAt   time.Time               `json:"started_at"`
+	Trigger     string                  `json:"trigger,omitempty"`
+	FinishedAt  *time.Time              `json:"finished_at,omitempty"`
+	Reason      string                  `json:"reason,omitempty"` // Empty while the run is in progress
+	Tested      int                     `json:"tested"`
+	Qualified   int                     `json:"qualified"`
+	Expected    int                     `json:"expected"`
+	Dropped     int                     `json:"dropped,omitempty"` // Verify runs only
+	Pruned      int                     `json:"pruned,omitempty"`  // IPs skipped by the latency pre-filter
+	ResultCount int                     `json:"result_count"`
+	Error       string                  `json:"error,omitempty"`
+	Config      *yamlconfig.Config      `json:"config"`
+	DataCenters []string                `json:"datacenters,omitempty"` // Selected data centers, empty for all
+	BestResult  *models.SpeedTestResult `json:"best_result,omitempty"`
+	Traffic     *usage.Usage            `json:"traffic,omitempty"` // Nil for runs recorded before traffic was accounted
+}
+
+// Store persists runs and their results in a bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the history database at path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+
+	// Databases created before 0600 may hold configuration secrets
+	if err := os.Chmod(path, 0600); err != nil {
+		fmt.Printf("Warning: Failed to restrict history database permissions: %v\n", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(runsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(resultsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// decodeRun decodes a stored run. Runs stored before configuration snapshots
+// were redacted get their secrets redacted here.
+func decodeRun(data []byte) (*Run, error) {
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	if run.Config != nil {
+		run.Config = run.Config.Redacted()
+	}
+	return &run, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// StartRun creates a new run record and returns it with its assigned ID.
+// trigger records what started the run, one of the Trigger constants.
+func (s *Store) StartRun(cfg *yamlconfig.Config, dataCenters []string, trigger string) (*Run, error) {
+	run := &Run{
+		StartedAt:   time.Now(),
+		Trigger:     trigger,
+		Expected:    cfg.Test.ExpectedServers,
+		Config:      cfg.Redacted(),
+		DataCenters: dataCenters,
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		id, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+
+		if _, err := tx.Bucket(resultsBucket).CreateBucket(itob(id)); err != nil {
+			return err
+		}
+		return putJSON(runs, itob(id), run)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run: %w", err)
+	}
+
+	return run, nil
+}
+
+// AddResult appends a result to a run
+func (s *Store) AddResult(runID uint64, result *models.SpeedTestResult) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		results := tx.Bucket(resultsBucket).Bucket(itob(runID))
+		if results == nil {
+			return ErrNotFound
+		}
+
+		seq, err := results.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putJSON(results, itob(seq), result)
+	})
+}
+
+// FinishRun records the outcome of a run along with its fastest completed result
+func (s *Store) FinishRun(runID uint64, summary *engine.Summary) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+
+		var run Run
+		data := runs.Get(itob(runID))
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(data, &run); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		run.FinishedAt = &now
+		run.Reason = string(summary.Reason)
+		run.Tested = summary.Tested
+		run.Qualified = summary.Qualified
+		run.Dropped = summary.Dropped
+		run.Pruned = summary.Pruned
+		run.Error = summary.Error
+		traffic := summary.Traffic
+		run.Traffic = &traffic
+		if results := tx.Bucket(resultsBucket).Bucket(itob(runID)); results != nil {
+			best, count, err := bestResult(results)
+			if err != nil {
+				return err
+			}
+			run.BestResult = best
+			run.ResultCount = count
+		}
+
+		return putJSON(runs, itob(runID), &run)
+	})
+}
+
+// Record persists the parts of an engine event that belong in the history
+func (s *Store) Record(runID uint64, ev engine.Event) error {
+	switch ev.Type {
+	case engine.EventResultStored:
+		return s.AddResult(runID, ev.Result)
+	case engine.EventRunFinished:
+		return s.FinishRun(runID, ev.Summary)
+	}
+	return nil
+}
+
+// ListRuns returns up to limit runs, newest first
+func (s *Store) ListRuns(limit int) ([]*Run, error) {
+	runs := make([]*Run, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(runs) < limit); k, v = c.Prev() {
+			run, err := decodeRun(v)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetRun returns a single run
+func (s *Store) GetRun(runID uint64) (*Run, error) {
+	var run *Run
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(runsBucket).Get(itob(runID))
+		if data == nil {
+			return ErrNotFound
+		}
+		var err error
+		run, err = decodeRun(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// LatestQualifiedRun returns the newest finished run that found at least one qualified server
+func (s *Store) LatestQualifiedRun() (*Run, error) {
+	var latest *Run
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			run, err := decodeRun(v)
+			if err != nil {
+				return err
+			}
+			if run.FinishedAt != nil && run.Qualified > 0 {
+				latest = run
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+// LatestQualifiedIPs returns the newest run that found qualified servers and
+// the IPs that qualified in it, judged by that run's bandwidth
+func (s *Store) LatestQualifiedIPs() (*Run, []string, error) {
+	run, err := s.LatestQualifiedRun()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, err := s.GetResults(run.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bandwidth := 0.0
+	if run.Config != nil {
+		bandwidth = run.Config.Test.Bandwidth
+	}
+	return run, engine.QualifiedIPs(results, bandwidth), nil
+}
+
+// GetResults returns all results of a run in the order they were stored
+func (s *Store) GetResults(runID uint64) ([]*models.SpeedTestResult, error) {
+	results := make([]*models.SpeedTestResult, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(resultsBucket).Bucket(itob(runID))
+		if bucket == nil {
+			return ErrNotFound
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var result models.SpeedTestResult
+			if err := json.Unmarshal(v, &result); err != nil {
+				return err
+			}
+			results = append(results, &result)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// bestResult returns the fastest completed result in a results bucket and the bucket size
+func bestResult(bucket *bolt.Bucket) (*models.SpeedTestResult, int, error) {
+	var best *models.SpeedTestResult
+	bestSpeed := -1.0
+	count := 0
+
+	err := bucket.ForEach(func(k, v []byte) error {
+		count++
+
+		var result models.SpeedTestResult
+		if err := json.Unmarshal(v, &result); err != nil {
+			return err
+		}
+
+		if result.Status == models.StatusCompleted && result.Speed > bestSpeed {
+			best = &result
+			bestSpeed = result.Speed
+		}
+		return nil
+	})
+
+	return best, count, err
+}
+
+// putJSON stores v as JSON under key
+func putJSON(bucket *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// itob encodes an ID as a sortable big-endian key
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
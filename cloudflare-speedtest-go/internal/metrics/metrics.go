@@ -66,6 +66,7 @@ type Metrics struct {
 	startTime        time.Time
 	speedSamples     []float64 // For calculating averages
 	latencySamples   []float64 // For calculating averages
+	prom             *promRegistry
 }
 
 // New creates a new metrics manager
@@ -79,6 +80,7 @@ func New() *Metrics {
 		startTime:      time.Now(),
 		speedSamples:   make([]float64, 0),
 		latencySamples: make([]float64, 0),
+		prom:           newPromRegistry(),
 	}
 }
 
@@ -109,6 +111,8 @@ func (m *Metrics) RecordCounter(name string, value float64, tags map[string]stri
 	metric.Value += value
 	metric.Count++
 	metric.LastUpdated = time.Now()
+
+	m.prom.add(MetricTypeCounter, name, value, tags)
 }
 
 // RecordGauge sets a gauge metric value
@@ -129,6 +133,8 @@ func (m *Metrics) RecordGauge(name string, value float64, tags map[string]string
 	metric.Value = value
 	metric.Count++
 	metric.LastUpdated = time.Now()
+
+	m.prom.add(MetricTypeGauge, name, value, tags)
 }
 
 // RecordTimer records a timing metric
@@ -179,8 +185,23 @@ func (m *Metrics) RecordSpeedSample(speed float64, bytes int64, duration float64
 		total += s
 	}
 	m.performanceStats.AverageSpeed = total / float64(len(m.speedSamples))
+	m.performanceStats.LastUpdated = time.Now()
+
+	m.prom.mu.Lock()
+	m.prom.speed.observe(speed)
+	m.prom.mu.Unlock()
+	m.prom.add(MetricTypeCounter, "downloaded.bytes", float64(bytes), nil)
+}
+
+// RecordTraffic counts bytes sent and received by probes or downloads.
+// Unlike RecordSpeedSample it also covers failed and slow downloads.
+func (m *Metrics) RecordTraffic(kind string, bytes int64) {
+	m.mu.Lock()
 	m.performanceStats.TotalDataTransfer += bytes
 	m.performanceStats.LastUpdated = time.Now()
+	m.mu.Unlock()
+
+	m.prom.add(MetricTypeCounter, "traffic.bytes", float64(bytes), map[string]string{"kind": kind})
 }
 
 // RecordLatencySample records a latency measurement
@@ -205,6 +226,10 @@ func (m *Metrics) RecordLatencySample(latency float64) {
 	}
 	m.performanceStats.AverageLatency = total / float64(len(m.latencySamples))
 	m.performanceStats.LastUpdated = time.Now()
+
+	m.prom.mu.Lock()
+	m.prom.latency.observe(latency)
+	m.prom.mu.Unlock()
 }
 
 // RecordTestStart records the start of a test
@@ -214,6 +239,8 @@ func (m *Metrics) RecordTestStart() {
 
 	m.performanceStats.TestsStarted++
 	m.performanceStats.LastUpdated = time.Now()
+
+	m.prom.add(MetricTypeGauge, "run.in_progress", 1, nil)
 }
 
 // RecordTestComplete records the completion of a test
@@ -302,7 +329,7 @@ func (m *Metrics) GetRecentSamples(count int) []SpeedSample {
 	return m.speedWindow.GetRecentSamples(count)
 }
 
-// Reset resets all metrics and statistics
+// Reset resets all metrics and statistics. Prometheus totals are kept.
 func (m *Metrics) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespace prefixes every exported Prometheus metric
+const namespace = "cfst"
+
+// Histogram bucket upper bounds
+var (
+	latencyBuckets     = []float64{10, 25, 50, 75, 100, 150, 200, 300, 500, 1000, 2000}     // ms
+	speedBuckets       = []float64{1, 5, 10, 25, 50, 100, 200, 300, 500, 1000, 2000}        // Mbps
+	runDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 900, 1800, 3600, 7200, 14400} // seconds
+)
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // Per bucket, not cumulative
+	sum     float64
+	count   uint64
+}
+
+// series is one labelled counter or gauge value
+type series struct {
+	labels string // Rendered label set, e.g. {datacenter="LAX"}
+	value  float64
+}
+
+// family groups the series of one metric name
+type family struct {
+	kind   MetricType
+	help   string
+	series map[string]*series
+}
+
+// promRegistry keeps cumulative values for Prometheus scraping. Unlike the
+// other metrics it is never reset between runs, so counters stay monotonic.
+type promRegistry struct {
+	mu          sync.Mutex
+	families    map[string]*family
+	latency     *histogram
+	speed       *histogram
+	runDuration *histogram
+}
+
+// newPromRegistry creates an empty registry
+func newPromRegistry() *promRegistry {
+	return &promRegistry{
+		families:    make(map[string]*family),
+		latency:     newHistogram(latencyBuckets),
+		speed:       newHistogram(speedBuckets),
+		runDuration: newHistogram(runDurationBuckets),
+	}
+}
+
+// newHistogram creates a histogram with the given bucket upper bounds
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(v float64) {
+	h.sum += v
+	h.count++
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// add increments a counter, or sets a gauge, identified by an internal dotted name
+func (r *promRegistry) add(kind MetricType, name string, value float64, tags map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fullName := promName(name)
+	if kind == MetricTypeCounter {
+		fullName += "_total"
+	}
+
+	f, ok := r.families[fullName]
+	if !ok {
+		help := "Current value of " + name
+		if kind == MetricTypeCounter {
+			help = "Total " + name + " since the server started"
+		}
+		f = &family{
+			kind:   kind,
+			help:   help,
+			series: make(map[string]*series),
+		}
+		r.families[fullName] = f
+	}
+
+	labels := renderLabels(tags)
+	s, ok := f.series[labels]
+	if !ok {
+		s = &series{labels: labels}
+		f.series[labels] = s
+	}
+
+	if kind == MetricTypeCounter {
+		s.value += value
+	} else {
+		s.value = value
+	}
+}
+
+// write renders all metrics in the Prometheus text exposition format
+func (r *promRegistry) write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHistogram(&b, promName("latency_milliseconds"), "Latency of tested IPs in milliseconds", r.latency)
+	writeHistogram(&b, promName("download_speed_mbps"), "Download speed of completed tests in Mbps", r.speed)
+	writeHistogram(&b, promName("run_duration_seconds"), "Duration of finished test runs in seconds", r.runDuration)
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+
+		labelSets := make([]string, 0, len(f.series))
+		for labels := range f.series {
+			labelSets = append(labelSets, labels)
+		}
+		sort.Strings(labelSets)
+
+		for _, labels := range labelSets {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatFloat(f.series[labels].value))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHistogram renders a histogram with cumulative buckets
+func writeHistogram(b *strings.Builder, name, help string, h *histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+
+	cumulative := uint64(0)
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// promName converts a dotted internal metric name to a Prometheus name
+func promName(name string) string {
+	var b strings.Builder
+	b.WriteString(namespace)
+	b.WriteByte('_')
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// renderLabels renders tags as a sorted Prometheus label set
+func renderLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%s", k, strconv.Quote(tags[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// formatFloat formats a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// RecordRunFinished records the outcome and duration of a test run
+func (m *Metrics) RecordRunFinished(reason string, duration time.Duration) {
+	m.prom.mu.Lock()
+	m.prom.runDuration.observe(duration.Seconds())
+	m.prom.mu.Unlock()
+
+	m.prom.add(MetricTypeCounter, "runs", 1, map[string]string{"reason": reason})
+	m.prom.add(MetricTypeGauge, "run.in_progress", 0, nil)
+	m.prom.add(MetricTypeGauge, "last_run.duration_seconds", duration.Seconds(), nil)
+	m.prom.add(MetricTypeGauge, "last_run.timestamp_seconds", float64(time.Now().Unix()), nil)
+}
+
+// WritePrometheus writes cumulative metrics in the Prometheus text format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	return m.prom.write(w)
+}
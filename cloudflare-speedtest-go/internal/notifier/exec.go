@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// execChannel runs a local command for each message
+type execChannel struct {
+	command string
+	args    []string
+	timeout time.Duration
+	tmpl    *template.Template
+}
+
+// newExecChannel creates a command notifier
+func newExecChannel(cfg yamlconfig.ExecNotifyConfig) (*execChannel, error) {
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify exec timeout: %w", err)
+	}
+	tmpl, err := parseTemplate("exec", cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execChannel{command: cfg.Command, args: cfg.Args, timeout: timeout, tmpl: tmpl}, nil
+}
+
+// Name returns the notifier name
+func (c *execChannel) Name() string {
+	return "exec"
+}
+
+// Send runs the command with the rendered message on standard input and the
+// message fields in CFST_* environment variables
+func (c *execChannel) Send(ctx context.Context, msg *Message) error {
+	text, err := render(c.tmpl, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Env = append(os.Environ(), messageEnv(msg)...)
+
+	output, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		return &permanentError{fmt.Errorf("notify command not found: %w", err)}
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("notify command failed: %w: %s", err, out)
+		}
+		return fmt.Errorf("notify command failed: %w", err)
+	}
+	return nil
+}
+
+// messageEnv returns the environment variables describing msg
+func messageEnv(msg *Message) []string {
+	env := []string{
+		"CFST_EVENT=" + msg.Event,
+		"CFST_TITLE=" + msg.Title,
+		"CFST_REASON=" + msg.Reason,
+		"CFST_TESTED=" + strconv.Itoa(msg.Tested),
+		"CFST_QUALIFIED=" + strconv.Itoa(msg.Qualified),
+		"CFST_EXPECTED=" + strconv.Itoa(msg.Expected),
+		"CFST_ERROR=" + msg.Error,
+		"CFST_PREVIOUS_BEST_IP=" + msg.PreviousBestIP,
+	}
+	if msg.Best != nil {
+		env = append(env,
+			"CFST_BEST_IP="+msg.Best.IP,
+			"CFST_BEST_SPEED="+strconv.FormatFloat(msg.Best.Speed, 'f', 2, 64),
+			"CFST_BEST_LATENCY="+strconv.FormatFloat(msg.Best.Latency, 'f', 2, 64),
+			"CFST_BEST_DATACENTER="+msg.Best.DataCenter,
+			"CFST_BEST_SCORE="+strconv.FormatFloat(msg.Best.Score, 'f', 1, 64),
+		)
+	}
+	return env
+}
@@ -0,0 +1,399 @@
+package notifier
+
+import (
+	"bytes"
+	"cloudflare-speedtest/internal/engine"
+	"cloudflare-speedtest/internal/errorhandler"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Events accepted in notify.events
+const (
+	EventFinished    = "finished"     // A run ended without an error
+	EventFailed      = "failed"       // A run aborted with an error
+	EventBestChanged = "best_changed" // The fastest IP differs from the previous run
+	EventTest        = "test"         // Sent on request to check the notifier settings
+)
+
+// ErrNoNotifiers is returned by New when no notifier is enabled
+var ErrNoNotifiers = errors.New("no notifiers enabled")
+
+// DefaultTemplate is the message body used when a notifier has no template
+const DefaultTemplate = `{{.Title}}
+{{if .Error}}Error: {{.Error}}
+{{end}}{{if .Reason}}Reason: {{.Reason}}, {{.Qualified}}/{{.Expected}} qualified of {{.Tested}} tested in {{printf "%.0f" .Duration}}s
+{{end}}{{if .Best}}Best IP: {{.Best.IP}} ({{printf "%.2f" .Best.Speed}} Mbps, {{printf "%.0f" .Best.Latency}} ms, {{.Best.DataCenter}})
+{{end}}{{if .PreviousBestIP}}Previous best IP: {{.PreviousBestIP}}
+{{end}}`
+
+// Result is a tested IP included in a message
+type Result struct {
+	IP         string  `json:"ip"`
+	DataCenter string  `json:"datacenter"`
+	Speed      float64 `json:"speed"`   // Mbps
+	Latency    float64 `json:"latency"` // ms
+	Score      float64 `json:"score"`
+}
+
+// Message is the data passed to the notifier templates
+type Message struct {
+	Event          string    `json:"event"`
+	Title          string    `json:"title"`
+	Time           time.Time `json:"time"`
+	Reason         string    `json:"reason,omitempty"`
+	Tested         int       `json:"tested"`
+	Qualified      int       `json:"qualified"`
+	Expected       int       `json:"expected"`
+	Dropped        int       `json:"dropped,omitempty"`
+	Duration       float64   `json:"duration_seconds"`
+	Error          string    `json:"error,omitempty"`
+	Best           *Result   `json:"best,omitempty"`
+	PreviousBestIP string    `json:"previous_best_ip,omitempty"`
+	Results        []Result  `json:"results"` // Fastest completed results, best first
+}
+
+// Channel delivers messages to one destination
+type Channel interface {
+	// Name returns the notifier name
+	Name() string
+	// Send delivers a message; a permanentError is not retried
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Delivery is the outcome of sending one message through one channel
+type Delivery struct {
+	Channel  string `json:"channel"`
+	Event    string `json:"event"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Notifier sends run notifications through every enabled channel
+type Notifier struct {
+	events       []string
+	channels     []Channel
+	errorHandler *errorhandler.ErrorHandler
+	maxRetries   int
+	statePath    string
+}
+
+// maxResults is the number of results included in a message
+const maxResults = 5
+
+// stateMu serializes best IP comparisons sharing a state file
+var stateMu sync.Mutex
+
+// New creates a notifier for cfg. The best IP of the last run is kept in
+// dataDir to detect when it changes.
+func New(cfg yamlconfig.NotifyConfig, dataDir string) (*Notifier, error) {
+	var channels []Channel
+	if cfg.Webhook.Enabled {
+		ch, err := newWebhookChannel(cfg.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	if cfg.Telegram.Enabled {
+		ch, err := newTelegramChannel(cfg.Telegram)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	if cfg.SMTP.Enabled {
+		ch, err := newSMTPChannel(cfg.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	if cfg.Exec.Enabled {
+		ch, err := newExecChannel(cfg.Exec)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	if len(channels) == 0 {
+		return nil, ErrNoNotifiers
+	}
+
+	policy, err := retryPolicy(cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	eh := errorhandler.New()
+	eh.SetRetryPolicy(errorhandler.ErrorTypeNotify, policy)
+
+	return &Notifier{
+		events:       cfg.Events,
+		channels:     channels,
+		errorHandler: eh,
+		maxRetries:   policy.MaxRetries,
+		statePath:    filepath.Join(dataDir, "notify-state.json"),
+	}, nil
+}
+
+// retryPolicy converts the retry settings to an exponential backoff policy
+func retryPolicy(cfg yamlconfig.NotifyRetryConfig) (*errorhandler.RetryPolicy, error) {
+	initialDelay, err := time.ParseDuration(cfg.InitialDelay)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify retry initial_delay: %w", err)
+	}
+	maxDelay, err := time.ParseDuration(cfg.MaxDelay)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify retry max_delay: %w", err)
+	}
+
+	return &errorhandler.RetryPolicy{
+		MaxRetries:    cfg.MaxRetries,
+		InitialDelay:  initialDelay,
+		MaxDelay:      maxDelay,
+		BackoffFactor: 2.0,
+		Jitter:        true,
+	}, nil
+}
+
+// Notify sends the notifications for a finished run. results must already be
+// sorted best first, e.g. by ResultManager.GetSortedResults("speed", false).
+// The best IP is remembered even when best_changed is not a selected event.
+func (n *Notifier) Notify(ctx context.Context, summary *engine.Summary, results []*models.SpeedTestResult) []Delivery {
+	var messages []*Message
+
+	msg := newMessage(EventFinished, summary, results)
+	if summary.Reason == engine.ReasonFailed {
+		msg.Event = EventFailed
+	}
+	msg.Title = title(msg.Event)
+	if n.wants(msg.Event) {
+		messages = append(messages, msg)
+	}
+
+	// A failed or stopped run has not compared enough IPs to tell the best one
+	if msg.Best != nil && summary.Reason != engine.ReasonFailed && summary.Reason != engine.ReasonCancelled {
+		previous, err := n.swapBestIP(msg.Best.IP)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else if previous != "" && previous != msg.Best.IP && n.wants(EventBestChanged) {
+			changed := newMessage(EventBestChanged, summary, results)
+			changed.Title = title(EventBestChanged)
+			changed.PreviousBestIP = previous
+			messages = append(messages, changed)
+		}
+	}
+
+	var deliveries []Delivery
+	for _, msg := range messages {
+		deliveries = append(deliveries, n.send(ctx, msg)...)
+	}
+	return deliveries
+}
+
+// Test sends a test message through every channel without retrying
+func (n *Notifier) Test(ctx context.Context) []Delivery {
+	msg := &Message{
+		Event:   EventTest,
+		Title:   title(EventTest),
+		Time:    time.Now(),
+		Results: []Result{},
+	}
+
+	deliveries := make([]Delivery, len(n.channels))
+	for i, ch := range n.channels {
+		deliveries[i] = Delivery{Channel: ch.Name(), Event: msg.Event, Attempts: 1}
+		if err := ch.Send(ctx, msg); err != nil {
+			deliveries[i].Error = err.Error()
+		}
+	}
+	return deliveries
+}
+
+// wants reports whether event is one of the selected events
+func (n *Notifier) wants(event string) bool {
+	return slices.Contains(n.events, event)
+}
+
+// send delivers msg through every channel in parallel
+func (n *Notifier) send(ctx context.Context, msg *Message) []Delivery {
+	deliveries := make([]Delivery, len(n.channels))
+	var wg sync.WaitGroup
+	for i, ch := range n.channels {
+		wg.Add(1)
+		go func(i int, ch Channel) {
+			defer wg.Done()
+			deliveries[i] = n.sendWithRetry(ctx, ch, msg)
+		}(i, ch)
+	}
+	wg.Wait()
+	return deliveries
+}
+
+// sendWithRetry sends msg through ch, retrying transient failures with the
+// notify retry policy of the error handler
+func (n *Notifier) sendWithRetry(ctx context.Context, ch Channel, msg *Message) Delivery {
+	delivery := Delivery{Channel: ch.Name(), Event: msg.Event}
+
+	for attempt := 0; ; attempt++ {
+		delivery.Attempts = attempt + 1
+
+		err := ch.Send(ctx, msg)
+		if err == nil {
+			n.errorHandler.HandleSuccess(errorhandler.ErrorTypeNotify, "notifier", ch.Name())
+			delivery.Error = ""
+			return delivery
+		}
+		delivery.Error = err.Error()
+
+		var perm *permanentError
+		retryErr := n.errorHandler.HandleError(ctx, &errorhandler.ErrorInfo{
+			Type:       errorhandler.ErrorTypeNotify,
+			Severity:   errorhandler.SeverityMedium,
+			Message:    err.Error(),
+			Context:    msg.Event,
+			Timestamp:  time.Now(),
+			Retryable:  !errors.As(err, &perm),
+			RetryCount: attempt,
+			MaxRetries: n.maxRetries,
+			Component:  "notifier",
+			Operation:  ch.Name(),
+		})
+		if retryErr != nil {
+			return delivery
+		}
+	}
+}
+
+// newMessage builds the message data for a finished run
+func newMessage(event string, summary *engine.Summary, results []*models.SpeedTestResult) *Message {
+	msg := &Message{
+		Event:     event,
+		Time:      time.Now(),
+		Reason:    string(summary.Reason),
+		Tested:    summary.Tested,
+		Qualified: summary.Qualified,
+		Expected:  summary.Expected,
+		Dropped:   summary.Dropped,
+		Duration:  summary.Duration,
+		Error:     summary.Error,
+		Results:   []Result{},
+	}
+
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if len(msg.Results) >= maxResults {
+			break
+		}
+		if result.Status != models.StatusCompleted || seen[result.IP] {
+			continue
+		}
+		seen[result.IP] = true
+		msg.Results = append(msg.Results, Result{
+			IP:         result.IP,
+			DataCenter: result.DataCenter,
+			Speed:      result.Speed,
+			Latency:    result.Latency,
+			Score:      result.Score,
+		})
+	}
+	if len(msg.Results) > 0 {
+		msg.Best = &msg.Results[0]
+	}
+
+	return msg
+}
+
+// title returns the headline of a message for event
+func title(event string) string {
+	switch event {
+	case EventFailed:
+		return "Cloudflare speed test failed"
+	case EventBestChanged:
+		return "Cloudflare speed test: best IP changed"
+	case EventTest:
+		return "Cloudflare speed test: test notification"
+	default:
+		return "Cloudflare speed test finished"
+	}
+}
+
+// notifyState is the data kept between runs
+type notifyState struct {
+	BestIP string    `json:"best_ip"`
+	Time   time.Time `json:"time"`
+}
+
+// swapBestIP records ip as the best IP and returns the previous one
+func (n *Notifier) swapBestIP(ip string) (string, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	var state notifyState
+	data, err := os.ReadFile(n.statePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read notify state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return "", fmt.Errorf("failed to parse notify state: %w", err)
+		}
+	}
+
+	previous := state.BestIP
+	data, err = json.MarshalIndent(notifyState{BestIP: ip, Time: time.Now()}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode notify state: %w", err)
+	}
+	if err := os.WriteFile(n.statePath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write notify state: %w", err)
+	}
+	return previous, nil
+}
+
+// parseTemplate parses a message template, falling back to DefaultTemplate
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// render executes tmpl with msg
+func render(tmpl *template.Template, msg *Message) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, msg); err != nil {
+		return "", &permanentError{fmt.Errorf("failed to render %s template: %w", tmpl.Name(), err)}
+	}
+	return buf.String(), nil
+}
+
+// toJSON encodes v for use inside JSON templates
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// smtpChannel emails each message
+type smtpChannel struct {
+	cfg     yamlconfig.SMTPNotifyConfig
+	subject *template.Template
+	tmpl    *template.Template
+}
+
+// newSMTPChannel creates an email notifier
+func newSMTPChannel(cfg yamlconfig.SMTPNotifyConfig) (*smtpChannel, error) {
+	subject := cfg.Subject
+	if subject == "" {
+		subject = "{{.Title}}"
+	}
+	subjectTmpl, err := parseTemplate("smtp subject", subject)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parseTemplate("smtp", cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &smtpChannel{cfg: cfg, subject: subjectTmpl, tmpl: tmpl}, nil
+}
+
+// Name returns the notifier name
+func (c *smtpChannel) Name() string {
+	return "smtp"
+}
+
+// Send delivers the message as a plain text email to every recipient
+func (c *smtpChannel) Send(ctx context.Context, msg *Message) error {
+	subject, err := render(c.subject, msg)
+	if err != nil {
+		return err
+	}
+	body, err := render(c.tmpl, msg)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if c.cfg.Username != "" {
+		auth := smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return &permanentError{fmt.Errorf("SMTP authentication failed: %w", err)}
+		}
+	}
+
+	if err := client.Mail(c.cfg.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, to := range c.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(c.buildMessage(strings.TrimSpace(subject), body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the server, using implicit TLS on port 465 and STARTTLS
+// elsewhere when the server offers it
+func (c *smtpChannel) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: c.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if c.cfg.Port == 465 {
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 15 * time.Second}, Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{Timeout: 15 * time.Second}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, c.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+
+	if c.cfg.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("SMTP STARTTLS failed: %w", err)
+			}
+		}
+	}
+
+	return client, nil
+}
+
+// buildMessage formats the email headers and body
+func (c *smtpChannel) buildMessage(subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", c.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(c.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"bytes"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// telegramChannel sends each message to a chat through a Telegram bot
+type telegramChannel struct {
+	apiURL   string
+	botToken string
+	chatID   string
+	tmpl     *template.Template
+	client   *http.Client
+}
+
+// newTelegramChannel creates a Telegram notifier
+func newTelegramChannel(cfg yamlconfig.TelegramNotifyConfig) (*telegramChannel, error) {
+	tmpl, err := parseTemplate("telegram", cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &telegramChannel{
+		apiURL:   strings.TrimRight(cfg.APIURL, "/"),
+		botToken: cfg.BotToken,
+		chatID:   cfg.ChatID,
+		tmpl:     tmpl,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// Name returns the notifier name
+func (c *telegramChannel) Name() string {
+	return "telegram"
+}
+
+// Send calls the sendMessage method of the Bot API
+func (c *telegramChannel) Send(ctx context.Context, msg *Message) error {
+	text, err := render(c.tmpl, msg)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  c.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to encode Telegram request: %w", err)}
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", c.apiURL, c.botToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create Telegram request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The URL contains the bot token; keep it out of logs
+		return fmt.Errorf("Telegram request failed: %w", urlErrorCause(err))
+	}
+	defer resp.Body.Close()
+
+	return checkStatus(resp, "Telegram")
+}
+
+// urlErrorCause strips the request URL from a client error
+func urlErrorCause(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
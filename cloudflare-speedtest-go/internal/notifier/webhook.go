@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"bytes"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// webhookChannel posts each message to a URL
+type webhookChannel struct {
+	url     string
+	headers map[string]string
+	tmpl    *template.Template // nil sends the message itself as JSON
+	text    *template.Template
+	client  *http.Client
+}
+
+// newWebhookChannel creates a webhook notifier
+func newWebhookChannel(cfg yamlconfig.WebhookNotifyConfig) (*webhookChannel, error) {
+	ch := &webhookChannel{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+
+	var err error
+	if cfg.Template != "" {
+		if ch.tmpl, err = parseTemplate("webhook", cfg.Template); err != nil {
+			return nil, err
+		}
+	}
+	if ch.text, err = parseTemplate("webhook", ""); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Name returns the notifier name
+func (c *webhookChannel) Name() string {
+	return "webhook"
+}
+
+// Send posts the rendered template, or the message as JSON with the default
+// text in a "text" field
+func (c *webhookChannel) Send(ctx context.Context, msg *Message) error {
+	var body []byte
+	if c.tmpl != nil {
+		text, err := render(c.tmpl, msg)
+		if err != nil {
+			return err
+		}
+		body = []byte(text)
+	} else {
+		text, err := render(c.text, msg)
+		if err != nil {
+			return err
+		}
+		body, err = json.Marshal(struct {
+			*Message
+			Text string `json:"text"`
+		}{msg, text})
+		if err != nil {
+			return &permanentError{fmt.Errorf("failed to encode webhook body: %w", err)}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create webhook request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkStatus(resp, "webhook")
+}
+
+// checkStatus turns a non-2xx response into an error. Client errors other
+// than timeouts and rate limits are permanent.
+func checkStatus(resp *http.Response, name string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s returned HTTP %d: %s", name, resp.StatusCode, strings.TrimSpace(string(data)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package publisher
+
+import (
+	"bytes"
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// cloudflareTokenEnv is read when cloudflare.api_token is not set in the config
+const cloudflareTokenEnv = "CLOUDFLARE_API_TOKEN"
+
+// cloudflareBackend manages records through the Cloudflare DNS API
+type cloudflareBackend struct {
+	client  *http.Client
+	apiURL  string
+	token   string
+	zoneID  string
+	proxied bool
+}
+
+// cloudflareRecord is a DNS record as returned by the API
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// cloudflareResponse is the envelope of every API response
+type cloudflareResponse struct {
+	Success bool            `json:"success"`
+	Errors  []cloudflareMsg `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// cloudflareMsg is an error reported by the API
+type cloudflareMsg struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// newCloudflareBackend creates a Cloudflare API backend
+func newCloudflareBackend(cfg yamlconfig.CloudflarePublishConfig) (*cloudflareBackend, error) {
+	token := cfg.APIToken
+	if token == "" {
+		token = os.Getenv(cloudflareTokenEnv)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("cloudflare.api_token or %s is required", cloudflareTokenEnv)
+	}
+	if cfg.ZoneID == "" {
+		return nil, fmt.Errorf("cloudflare.zone_id is required")
+	}
+
+	return &cloudflareBackend{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		apiURL:  strings.TrimSuffix(cfg.APIURL, "/"),
+		token:   token,
+		zoneID:  cfg.ZoneID,
+		proxied: cfg.Proxied,
+	}, nil
+}
+
+// Name returns the backend name
+func (b *cloudflareBackend) Name() string {
+	return BackendCloudflare
+}
+
+// Get returns the current records of the given type for name
+func (b *cloudflareBackend) Get(ctx context.Context, name, rtype string) ([]Record, error) {
+	existing, err := b.list(ctx, name, rtype)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(existing))
+	for i, r := range existing {
+		records[i] = Record{Name: r.Name, Type: r.Type, Content: r.Content, TTL: r.TTL}
+	}
+	return records, nil
+}
+
+// Set replaces all records of the given type for name. New records are
+// created before stale ones are deleted so the name never stops resolving.
+func (b *cloudflareBackend) Set(ctx context.Context, name, rtype string, records []Record) error {
+	existing, err := b.list(ctx, name, rtype)
+	if err != nil {
+		return err
+	}
+
+	have := make(map[string]bool)
+	for _, r := range existing {
+		have[r.Content] = true
+	}
+
+	want := make(map[string]bool)
+	for _, r := range records {
+		want[r.Content] = true
+		if have[r.Content] {
+			continue
+		}
+
+		body := cloudflareRecord{Type: rtype, Name: name, Content: r.Content, TTL: r.TTL, Proxied: b.proxied}
+		if err := b.do(ctx, http.MethodPost, b.recordsPath(), body, nil); err != nil {
+			return fmt.Errorf("failed to create record %s: %w", r.Content, err)
+		}
+	}
+
+	for _, r := range existing {
+		if want[r.Content] {
+			continue
+		}
+		if err := b.do(ctx, http.MethodDelete, b.recordsPath()+"/"+r.ID, nil, nil); err != nil {
+			return fmt.Errorf("failed to delete record %s: %w", r.Content, err)
+		}
+	}
+
+	return nil
+}
+
+// list returns the records of the given type for name
+func (b *cloudflareBackend) list(ctx context.Context, name, rtype string) ([]cloudflareRecord, error) {
+	query := url.Values{}
+	query.Set("type", rtype)
+	query.Set("name", name)
+	query.Set("per_page", "100")
+
+	var records []cloudflareRecord
+	if err := b.do(ctx, http.MethodGet, b.recordsPath()+"?"+query.Encode(), nil, &records); err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+	return records, nil
+}
+
+// recordsPath returns the DNS records endpoint of the zone
+func (b *cloudflareBackend) recordsPath() string {
+	return "/zones/" + url.PathEscape(b.zoneID) + "/dns_records"
+}
+
+// do sends an API request and decodes the result into out if set
+func (b *cloudflareBackend) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("unexpected response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if !envelope.Success {
+		if len(envelope.Errors) > 0 {
+			return fmt.Errorf("API error %d: %s", envelope.Errors[0].Code, envelope.Errors[0].Message)
+		}
+		return fmt.Errorf("API request failed (HTTP %d)", resp.StatusCode)
+	}
+
+	if out != nil {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
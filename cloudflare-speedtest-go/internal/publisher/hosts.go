@@ -0,0 +1,157 @@
+package publisher
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Markers around the block of the hosts file managed by the publisher.
+// Lines outside the block are never modified.
+const (
+	hostsBlockBegin = "# BEGIN cloudflare-speedtest"
+	hostsBlockEnd   = "# END cloudflare-speedtest"
+)
+
+// hostsBackend writes entries to a local hosts file
+type hostsBackend struct {
+	path string
+}
+
+// newHostsBackend creates a hosts file backend, defaulting to the system hosts file
+func newHostsBackend(cfg yamlconfig.HostsPublishConfig) *hostsBackend {
+	path := cfg.Path
+	if path == "" {
+		path = defaultHostsPath()
+	}
+	return &hostsBackend{path: path}
+}
+
+// defaultHostsPath returns the location of the system hosts file
+func defaultHostsPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// Name returns the backend name
+func (b *hostsBackend) Name() string {
+	return BackendHosts
+}
+
+// Get returns the managed entries of the given type for name
+func (b *hostsBackend) Get(ctx context.Context, name, rtype string) ([]Record, error) {
+	_, block, _, err := b.read()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0)
+	for _, line := range block {
+		if ip, host, ok := parseHostsLine(line); ok && host == name && recordType(ip) == rtype {
+			records = append(records, Record{Name: name, Type: rtype, Content: ip})
+		}
+	}
+	return records, nil
+}
+
+// Set replaces the managed entries of the given type for name
+func (b *hostsBackend) Set(ctx context.Context, name, rtype string, records []Record) error {
+	before, block, after, err := b.read()
+	if err != nil {
+		return err
+	}
+
+	kept := make([]string, 0, len(block)+len(records))
+	for _, line := range block {
+		if ip, host, ok := parseHostsLine(line); ok && host == name && recordType(ip) == rtype {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	for _, r := range records {
+		kept = append(kept, r.Content+"\t"+name)
+	}
+
+	lines := append([]string{}, before...)
+	if len(kept) > 0 {
+		lines = append(lines, hostsBlockBegin)
+		lines = append(lines, kept...)
+		lines = append(lines, hostsBlockEnd)
+	}
+	lines = append(lines, after...)
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(b.path); err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("hosts file %s is not a regular file", b.path)
+		}
+		mode = info.Mode().Perm()
+	}
+
+	// Write in place rather than renaming: the hosts file is often a bind mount
+	if err := os.WriteFile(b.path, []byte(strings.Join(lines, "\n")+"\n"), mode); err != nil {
+		return fmt.Errorf("failed to write hosts file: %w", err)
+	}
+	return nil
+}
+
+// read splits the hosts file into the lines before, inside and after the managed block
+func (b *hostsBackend) read() (before, block, after []string, err error) {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	text := strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil, nil, nil, nil
+	}
+
+	section := 0 // 0 before, 1 inside, 2 after the block
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case section == 0 && strings.TrimSpace(line) == hostsBlockBegin:
+			section = 1
+		case section == 1 && strings.TrimSpace(line) == hostsBlockEnd:
+			section = 2
+		case section == 0:
+			before = append(before, line)
+		case section == 1:
+			block = append(block, line)
+		default:
+			after = append(after, line)
+		}
+	}
+
+	return before, block, after, nil
+}
+
+// parseHostsLine returns the address and first hostname of an entry line
+func parseHostsLine(line string) (ip, host string, ok bool) {
+	line, _, _ = strings.Cut(line, "#")
+	fields := strings.Fields(line)
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
+// recordType returns A for IPv4 and AAAA for IPv6 addresses
+func recordType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+		return "A"
+	}
+	return "AAAA"
+}
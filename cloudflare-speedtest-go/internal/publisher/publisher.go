@@ -0,0 +1,374 @@
+package publisher
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend names accepted in publish.backend
+const (
+	BackendCloudflare = "cloudflare"
+	BackendRFC2136    = "rfc2136"
+	BackendHosts      = "hosts"
+)
+
+var (
+	// ErrNothingToRollback is returned by Rollback when no publish has been recorded
+	ErrNothingToRollback = errors.New("no published records to roll back")
+	// ErrNoResults is returned by Publish when there is no completed result to publish
+	ErrNoResults = errors.New("no completed results to publish")
+)
+
+// Record is a single A or AAAA record
+type Record struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// Backend reads and replaces the A or AAAA record set of a hostname
+type Backend interface {
+	// Name returns the backend name
+	Name() string
+	// Get returns the current records of the given type for name
+	Get(ctx context.Context, name, rtype string) ([]Record, error)
+	// Set replaces all records of the given type for name; an empty list removes them
+	Set(ctx context.Context, name, rtype string, records []Record) error
+}
+
+// Change describes how one record set was, or would be, updated
+type Change struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Previous []Record `json:"previous"`
+	Records  []Record `json:"records"`
+}
+
+// Report is the outcome of a publish or rollback
+type Report struct {
+	Backend    string    `json:"backend"`
+	DryRun     bool      `json:"dry_run"`
+	RolledBack bool      `json:"rolled_back,omitempty"`
+	Time       time.Time `json:"time"`
+	Changes    []Change  `json:"changes"`
+}
+
+// Lines formats the report as human-readable log lines, one per record set
+func (r *Report) Lines() []string {
+	action := "Published"
+	if r.RolledBack {
+		action = "Rolled back"
+	}
+	if r.DryRun {
+		action = "Dry run: would have " + strings.ToLower(action[:1]) + action[1:]
+	}
+
+	lines := make([]string, 0, len(r.Changes))
+	for _, change := range r.Changes {
+		lines = append(lines, fmt.Sprintf("%s %s %s via %s: [%s] -> [%s]",
+			action, change.Name, change.Type, r.Backend, contents(change.Previous), contents(change.Records)))
+	}
+	return lines
+}
+
+// contents joins the addresses of records
+func contents(records []Record) string {
+	addrs := make([]string, len(records))
+	for i, r := range records {
+		addrs[i] = r.Content
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// Publisher points the configured hostnames at the fastest tested IPs
+type Publisher struct {
+	cfg       yamlconfig.PublishConfig
+	backend   Backend
+	statePath string
+}
+
+// stateMu serializes publishes and rollbacks sharing a state file
+var stateMu sync.Mutex
+
+// New creates a publisher for cfg. The previous records of the last publish
+// are kept in dataDir so it can be rolled back.
+func New(cfg yamlconfig.PublishConfig, dataDir string) (*Publisher, error) {
+	if len(cfg.Hostnames) == 0 {
+		return nil, fmt.Errorf("no hostnames configured for publishing")
+	}
+
+	var backend Backend
+	var err error
+	switch cfg.Backend {
+	case BackendCloudflare:
+		backend, err = newCloudflareBackend(cfg.Cloudflare)
+	case BackendRFC2136:
+		backend, err = newRFC2136Backend(cfg.RFC2136)
+	case BackendHosts:
+		backend = newHostsBackend(cfg.Hosts)
+	default:
+		err = fmt.Errorf("unknown publish backend: %q", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Publisher{
+		cfg:       cfg,
+		backend:   backend,
+		statePath: filepath.Join(dataDir, "publish-state.json"),
+	}, nil
+}
+
+// Publish updates the A and AAAA records of every hostname to the top N
+// completed results. results must already be sorted best first, e.g. by
+// ResultManager.GetSortedResults("speed", false). Only the record types
+// present in the selection are touched. With dryRun the changes are only
+// computed; otherwise the previous records are saved for Rollback.
+func (p *Publisher) Publish(ctx context.Context, results []*models.SpeedTestResult, dryRun bool) (*Report, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	selected := p.selectRecords(results)
+	if len(selected) == 0 {
+		return nil, ErrNoResults
+	}
+
+	report := &Report{Backend: p.backend.Name(), DryRun: dryRun, Time: time.Now()}
+
+	for _, name := range p.cfg.Hostnames {
+		for _, rtype := range []string{"A", "AAAA"} {
+			contents, ok := selected[rtype]
+			if !ok {
+				continue
+			}
+
+			previous, err := p.backend.Get(ctx, name, rtype)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s records of %s: %w", rtype, name, err)
+			}
+
+			records := make([]Record, len(contents))
+			for i, content := range contents {
+				records[i] = Record{Name: name, Type: rtype, Content: content, TTL: p.cfg.TTL}
+			}
+
+			report.Changes = append(report.Changes, Change{Name: name, Type: rtype, Previous: previous, Records: records})
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// Publishing the same records again changes nothing, and the saved state
+	// must keep the records from before the last publish
+	if !slices.ContainsFunc(report.Changes, func(change Change) bool {
+		return !sameContents(change.Previous, change.Records)
+	}) {
+		return report, nil
+	}
+
+	// Save the previous records before touching anything so a partial
+	// failure can still be rolled back
+	state, err := p.carryPrevious(report)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.saveState(state); err != nil {
+		return nil, err
+	}
+
+	if err := p.apply(ctx, report.Changes, false); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// Rollback restores the records replaced by the last publish. With dryRun
+// the restore is only computed and the saved state is kept.
+func (p *Publisher) Rollback(ctx context.Context, dryRun bool) (*Report, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	last, err := p.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if last.Backend != p.backend.Name() {
+		return nil, fmt.Errorf("last publish used the %s backend, not %s", last.Backend, p.backend.Name())
+	}
+
+	report := &Report{Backend: p.backend.Name(), DryRun: dryRun, RolledBack: true, Time: time.Now()}
+	for _, change := range last.Changes {
+		report.Changes = append(report.Changes, Change{
+			Name:     change.Name,
+			Type:     change.Type,
+			Previous: change.Records,
+			Records:  change.Previous,
+		})
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if err := p.apply(ctx, report.Changes, true); err != nil {
+		return report, err
+	}
+
+	if err := os.Remove(p.statePath); err != nil {
+		return report, fmt.Errorf("failed to clear publish state: %w", err)
+	}
+	return report, nil
+}
+
+// LastPublish returns the last publish that can be rolled back
+func (p *Publisher) LastPublish() (*Report, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return p.loadState()
+}
+
+// apply sets every record set in changes, stopping at the first failure
+func (p *Publisher) apply(ctx context.Context, changes []Change, rollback bool) error {
+	action := "publish"
+	if rollback {
+		action = "roll back"
+	}
+
+	for _, change := range changes {
+		if sameContents(change.Previous, change.Records) {
+			continue
+		}
+		if err := p.backend.Set(ctx, change.Name, change.Type, change.Records); err != nil {
+			return fmt.Errorf("failed to %s %s records of %s: %w", action, change.Type, change.Name, err)
+		}
+	}
+	return nil
+}
+
+// selectRecords picks the IPs of the top N completed results, grouped by record type
+func (p *Publisher) selectRecords(results []*models.SpeedTestResult) map[string][]string {
+	topN := max(p.cfg.TopN, 1)
+	selected := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	for _, result := range results {
+		if len(seen) >= topN {
+			break
+		}
+		if result.Status != models.StatusCompleted || seen[result.IP] {
+			continue
+		}
+
+		ip := net.ParseIP(result.IP)
+		if ip == nil {
+			continue
+		}
+
+		seen[result.IP] = true
+		rtype := recordType(result.IP)
+		selected[rtype] = append(selected[rtype], ip.String())
+	}
+
+	return selected
+}
+
+// saveState records a publish so it can be rolled back
+func (p *Publisher) saveState(report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode publish state: %w", err)
+	}
+
+	tmpPath := p.statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write publish state: %w", err)
+	}
+	if err := os.Rename(tmpPath, p.statePath); err != nil {
+		return fmt.Errorf("failed to write publish state: %w", err)
+	}
+	return nil
+}
+
+// carryPrevious returns the state to save for report. Record sets that still
+// hold what the last publish set keep the records it replaced, so Rollback
+// restores the records from before the first of successive publishes.
+func (p *Publisher) carryPrevious(report *Report) (*Report, error) {
+	last, err := p.loadState()
+	if errors.Is(err, ErrNothingToRollback) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if last.Backend != report.Backend {
+		return report, nil
+	}
+
+	state := *report
+	state.Changes = slices.Clone(report.Changes)
+	for _, lastChange := range last.Changes {
+		i := slices.IndexFunc(state.Changes, func(change Change) bool {
+			return change.Name == lastChange.Name && change.Type == lastChange.Type
+		})
+		switch {
+		case i < 0:
+			// Not published this time, so still as the last publish left it
+			state.Changes = append(state.Changes, lastChange)
+		case sameContents(lastChange.Records, state.Changes[i].Previous):
+			state.Changes[i].Previous = lastChange.Previous
+		}
+	}
+	return &state, nil
+}
+
+// loadState reads the last recorded publish
+func (p *Publisher) loadState() (*Report, error) {
+	data, err := os.ReadFile(p.statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNothingToRollback
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read publish state: %w", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse publish state: %w", err)
+	}
+	return &report, nil
+}
+
+// sameContents reports whether two record sets hold the same addresses
+func sameContents(a, b []Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	contents := make([]string, 0, len(a))
+	for _, r := range a {
+		contents = append(contents, r.Content)
+	}
+	for _, r := range b {
+		if !slices.Contains(contents, r.Content) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,359 @@
+package publisher
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCloudflare serves the DNS records endpoints of one zone from memory
+type fakeCloudflare struct {
+	mu      sync.Mutex
+	records map[string]cloudflareRecord // By ID
+	nextID  int
+	writes  int // Records created or deleted
+}
+
+func newFakeCloudflare(t *testing.T, contents ...string) (*fakeCloudflare, *httptest.Server) {
+	fake := &fakeCloudflare{records: make(map[string]cloudflareRecord)}
+	for _, content := range contents {
+		fake.add(cloudflareRecord{Type: recordType(content), Name: "edge.example.com", Content: content, TTL: 300})
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeCloudflare) add(record cloudflareRecord) {
+	f.nextID++
+	record.ID = fmt.Sprintf("rec%d", f.nextID)
+	f.records[record.ID] = record
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"errors":  []cloudflareMsg{{Code: 10000, Message: "Authentication error"}},
+		})
+		return
+	}
+
+	path, found := strings.CutPrefix(r.URL.Path, "/zones/zone1/dns_records")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	var result any
+	switch r.Method {
+	case http.MethodGet:
+		matching := []cloudflareRecord{}
+		for _, record := range f.records {
+			if record.Type == r.URL.Query().Get("type") && record.Name == r.URL.Query().Get("name") {
+				matching = append(matching, record)
+			}
+		}
+		result = matching
+	case http.MethodPost:
+		var record cloudflareRecord
+		json.NewDecoder(r.Body).Decode(&record)
+		f.add(record)
+		f.writes++
+	case http.MethodDelete:
+		delete(f.records, strings.TrimPrefix(path, "/"))
+		f.writes++
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []cloudflareMsg{}, "result": result})
+}
+
+// contents returns the addresses of every record, sorted
+func (f *fakeCloudflare) contents() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var contents []string
+	for _, record := range f.records {
+		contents = append(contents, record.Content)
+	}
+	slices.Sort(contents)
+	return contents
+}
+
+func newCloudflarePublisher(t *testing.T, apiURL, dataDir string) *Publisher {
+	t.Helper()
+	p, err := New(yamlconfig.PublishConfig{
+		Backend:   BackendCloudflare,
+		Hostnames: []string{"edge.example.com"},
+		TopN:      2,
+		TTL:       60,
+		Cloudflare: yamlconfig.CloudflarePublishConfig{
+			APIURL:   apiURL,
+			APIToken: "test-token",
+			ZoneID:   "zone1",
+		},
+	}, dataDir)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return p
+}
+
+// completed returns completed results for ips, best first
+func completed(ips ...string) []*models.SpeedTestResult {
+	results := make([]*models.SpeedTestResult, len(ips))
+	for i, ip := range ips {
+		results[i] = &models.SpeedTestResult{IP: ip, Status: models.StatusCompleted}
+	}
+	return results
+}
+
+func TestPublishCloudflare(t *testing.T) {
+	fake, server := newFakeCloudflare(t, "192.0.2.1", "2001:db8::1")
+	p := newCloudflarePublisher(t, server.URL, t.TempDir())
+
+	// The third result is past the top 2 and the AAAA set is left alone
+	results := completed("198.51.100.7", "192.0.2.1", "198.51.100.9")
+	results = append([]*models.SpeedTestResult{{IP: "203.0.113.5", Status: models.StatusSlow}}, results...)
+
+	report, err := p.Publish(context.Background(), results, false)
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	want := []string{"192.0.2.1", "198.51.100.7", "2001:db8::1"}
+	if got := fake.contents(); !slices.Equal(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].Type != "A" || len(report.Changes[0].Previous) != 1 {
+		t.Errorf("report changes = %+v, want one A change replacing one record", report.Changes)
+	}
+	if fake.writes != 1 {
+		t.Errorf("writes = %d, want 1: the kept record must not be recreated", fake.writes)
+	}
+}
+
+func TestPublishDryRun(t *testing.T) {
+	fake, server := newFakeCloudflare(t, "192.0.2.1")
+	p := newCloudflarePublisher(t, server.URL, t.TempDir())
+
+	report, err := p.Publish(context.Background(), completed("198.51.100.7"), true)
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if !report.DryRun || len(report.Changes) != 1 {
+		t.Errorf("report = %+v, want a dry run with one change", report)
+	}
+	if fake.writes != 0 {
+		t.Errorf("writes = %d, want none on a dry run", fake.writes)
+	}
+	if _, err := p.LastPublish(); !errors.Is(err, ErrNothingToRollback) {
+		t.Errorf("LastPublish() error = %v, want ErrNothingToRollback", err)
+	}
+}
+
+func TestRollbackAfterRepeatedPublishes(t *testing.T) {
+	fake, server := newFakeCloudflare(t, "192.0.2.1")
+	p := newCloudflarePublisher(t, server.URL, t.TempDir())
+	ctx := context.Background()
+
+	// Publishing the same records twice, then others, still rolls back to
+	// the records from before the first publish
+	for _, ip := range []string{"198.51.100.7", "198.51.100.7", "203.0.113.5"} {
+		if _, err := p.Publish(ctx, completed(ip), false); err != nil {
+			t.Fatalf("Publish(%s) error = %v", ip, err)
+		}
+	}
+
+	dryRun, err := p.Rollback(ctx, true)
+	if err != nil {
+		t.Fatalf("Rollback(dry run) error = %v", err)
+	}
+	if got := fake.contents(); !slices.Equal(got, []string{"203.0.113.5"}) {
+		t.Errorf("records after dry run = %v, want them unchanged", got)
+	}
+	if !dryRun.RolledBack || len(dryRun.Changes) != 1 || dryRun.Changes[0].Records[0].Content != "192.0.2.1" {
+		t.Errorf("dry run report = %+v, want a rollback to 192.0.2.1", dryRun)
+	}
+
+	if _, err := p.Rollback(ctx, false); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := fake.contents(); !slices.Equal(got, []string{"192.0.2.1"}) {
+		t.Errorf("records after rollback = %v, want [192.0.2.1]", got)
+	}
+	if _, err := p.Rollback(ctx, false); !errors.Is(err, ErrNothingToRollback) {
+		t.Errorf("second Rollback() error = %v, want ErrNothingToRollback", err)
+	}
+}
+
+func TestCloudflareErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "error envelope",
+			status:  http.StatusBadRequest,
+			body:    `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`,
+			wantErr: "API error 9109: Invalid access token",
+		},
+		{
+			name:    "failure without errors",
+			status:  http.StatusTooManyRequests,
+			body:    `{"success":false,"errors":[]}`,
+			wantErr: "API request failed (HTTP 429)",
+		},
+		{
+			name:    "not JSON",
+			status:  http.StatusBadGateway,
+			body:    `<html>Bad gateway</html>`,
+			wantErr: "unexpected response (HTTP 502)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			p := newCloudflarePublisher(t, server.URL, t.TempDir())
+			_, err := p.Publish(context.Background(), completed("198.51.100.7"), false)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Publish() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(p.statePath); err == nil {
+				t.Error("a failed publish left a state to roll back")
+			}
+		})
+	}
+}
+
+func TestCloudflareWrongToken(t *testing.T) {
+	_, server := newFakeCloudflare(t)
+	p := newCloudflarePublisher(t, server.URL, t.TempDir())
+	p.backend.(*cloudflareBackend).token = "expired"
+
+	_, err := p.Publish(context.Background(), completed("198.51.100.7"), false)
+	if err == nil || !strings.Contains(err.Error(), "API error 10000: Authentication error") {
+		t.Errorf("Publish() error = %v, want the authentication error", err)
+	}
+}
+
+func TestAppendName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.com.", "076578616d706c6503636f6d00"},
+		{"example.com", "076578616d706c6503636f6d00"},
+		{"a.b.c", "01610162016300"},
+		{".", "00"},
+	}
+
+	for _, tt := range tests {
+		if got := hex.EncodeToString(appendName(nil, tt.name)); got != tt.want {
+			t.Errorf("appendName(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadName(t *testing.T) {
+	// 12 byte header, then "example.com." at 12 and "www" pointing to it at 25
+	msg := make([]byte, dnsHeaderSize)
+	msg = appendName(msg, "example.com.")
+	msg = append(msg, 3, 'w', 'w', 'w', 0xc0, 12)
+
+	tests := []struct {
+		name     string
+		msg      []byte
+		offset   int
+		want     string
+		wantNext int
+		wantErr  string
+	}{
+		{name: "uncompressed", msg: msg, offset: 12, want: "example.com.", wantNext: 25},
+		{name: "pointer after labels", msg: msg, offset: 25, want: "www.example.com.", wantNext: 31},
+		{name: "root", msg: []byte{0}, offset: 0, want: ".", wantNext: 1},
+		{name: "pointer to itself", msg: []byte{0xc0, 0}, offset: 0, wantErr: "name compression loop"},
+		{name: "pointers to each other", msg: []byte{0xc0, 2, 0xc0, 0}, offset: 0, wantErr: "name compression loop"},
+		{name: "truncated pointer", msg: []byte{3, 'w', 'w', 'w', 0xc0}, offset: 0, wantErr: "truncated name"},
+		{name: "truncated label", msg: []byte{7, 'e', 'x'}, offset: 0, wantErr: "truncated label"},
+		{name: "missing terminator", msg: []byte{1, 'a'}, offset: 0, wantErr: "truncated name"},
+		{name: "pointer past the end", msg: []byte{0xc0, 9}, offset: 0, wantErr: "truncated name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := readName(tt.msg, tt.offset)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("readName() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readName() error = %v", err)
+			}
+			if got != tt.want || next != tt.wantNext {
+				t.Errorf("readName() = %q, %d, want %q, %d", got, next, tt.want, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestSignTSIG(t *testing.T) {
+	b, err := newRFC2136Backend(yamlconfig.RFC2136PublishConfig{
+		Server:        "192.0.2.53",
+		Zone:          "example.com",
+		TSIGKey:       "test-key",
+		TSIGSecret:    "c2VjcmV0LWtleS1mb3ItdGVzdHM=", // "secret-key-for-tests"
+		TSIGAlgorithm: "hmac-sha256",
+	})
+	if err != nil {
+		t.Fatalf("newRFC2136Backend() error = %v", err)
+	}
+
+	msg := newDNSMessage(dnsOpcodeUpdate)
+	msg.header[0], msg.header[1] = 0x12, 0x34
+	msg.question(b.zone, dnsTypeSOA, dnsClassIN)
+
+	// HMAC-SHA256 over the message and the TSIG variables of RFC 8945
+	// section 4.3.3, computed independently of this package
+	const wantMAC = "6be4ec134a72e7a73386239b37922a517c222fb332267c1d6cdfb0e36a0a04d3"
+	const want = "123428000001000000000001076578616d706c6503636f6d0000060001" +
+		"08746573742d6b65790000fa00ff00000000003d" +
+		"0b686d61632d7368613235360000006553f100012c0020" + wantMAC +
+		"123400000000"
+
+	got := hex.EncodeToString(b.sign(msg.bytes(), time.Unix(1700000000, 0)))
+	if !strings.Contains(got, wantMAC) {
+		t.Errorf("sign() MAC does not match the known value")
+	}
+	if got != want {
+		t.Errorf("sign() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,488 @@
+package publisher
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS wire constants used by the RFC 2136 backend
+const (
+	dnsTypeA    = 1
+	dnsTypeSOA  = 6
+	dnsTypeAAAA = 28
+	dnsTypeTSIG = 250
+
+	dnsClassIN  = 1
+	dnsClassAny = 255
+
+	dnsOpcodeQuery  = 0
+	dnsOpcodeUpdate = 5
+
+	dnsHeaderSize = 12
+	tsigFudge     = 300
+)
+
+// dnsRcodes names the response codes an update can fail with
+var dnsRcodes = map[int]string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+// tsigAlgorithms maps configured algorithm names to their hash and wire name
+var tsigAlgorithms = map[string]struct {
+	wireName string
+	hash     func() hash.Hash
+}{
+	"hmac-sha1":   {"hmac-sha1.", sha1.New},
+	"hmac-sha256": {"hmac-sha256.", sha256.New},
+	"hmac-sha512": {"hmac-sha512.", sha512.New},
+}
+
+// rfc2136Backend updates records with RFC 2136 dynamic updates, signed with
+// TSIG (RFC 8945) when a key is configured
+type rfc2136Backend struct {
+	server     string
+	zone       string
+	keyName    string
+	keySecret  []byte
+	algorithm  string
+	timeout    time.Duration
+	defaultTTL int
+}
+
+// newRFC2136Backend creates a dynamic update backend
+func newRFC2136Backend(cfg yamlconfig.RFC2136PublishConfig) (*rfc2136Backend, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("rfc2136.server is required")
+	}
+	if cfg.Zone == "" {
+		return nil, fmt.Errorf("rfc2136.zone is required")
+	}
+
+	server := cfg.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	b := &rfc2136Backend{
+		server:     server,
+		zone:       fqdn(cfg.Zone),
+		algorithm:  cfg.TSIGAlgorithm,
+		timeout:    10 * time.Second,
+		defaultTTL: 60,
+	}
+
+	if cfg.TSIGKey != "" {
+		if _, ok := tsigAlgorithms[cfg.TSIGAlgorithm]; !ok {
+			return nil, fmt.Errorf("unsupported TSIG algorithm: %q", cfg.TSIGAlgorithm)
+		}
+		secret, err := base64.StdEncoding.DecodeString(cfg.TSIGSecret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TSIG secret: %w", err)
+		}
+		b.keyName = fqdn(cfg.TSIGKey)
+		b.keySecret = secret
+	}
+
+	return b, nil
+}
+
+// Name returns the backend name
+func (b *rfc2136Backend) Name() string {
+	return BackendRFC2136
+}
+
+// Get queries the server for the current records of the given type for name
+func (b *rfc2136Backend) Get(ctx context.Context, name, rtype string) ([]Record, error) {
+	qtype, err := dnsType(rtype)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := newDNSMessage(dnsOpcodeQuery)
+	msg.question(fqdn(name), qtype, dnsClassIN)
+
+	resp, err := b.exchange(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if rcode := int(resp[3] & 0x0f); rcode != 0 && rcode != 3 {
+		return nil, fmt.Errorf("query failed: %s", rcodeName(rcode))
+	}
+
+	answers, err := parseAnswers(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	records := make([]Record, 0)
+	for _, rr := range answers {
+		if rr.rtype != qtype || !strings.EqualFold(rr.name, fqdn(name)) {
+			continue
+		}
+		records = append(records, Record{Name: name, Type: rtype, Content: net.IP(rr.data).String(), TTL: int(rr.ttl)})
+	}
+	return records, nil
+}
+
+// Set deletes the record set and adds the new records in a single update,
+// so the change is applied atomically by the server
+func (b *rfc2136Backend) Set(ctx context.Context, name, rtype string, records []Record) error {
+	qtype, err := dnsType(rtype)
+	if err != nil {
+		return err
+	}
+
+	msg := newDNSMessage(dnsOpcodeUpdate)
+	msg.question(b.zone, dnsTypeSOA, dnsClassIN)
+
+	// Delete the whole RRset: class ANY, TTL 0, empty RDATA (RFC 2136 2.5.2)
+	msg.update(fqdn(name), qtype, dnsClassAny, 0, nil)
+
+	for _, r := range records {
+		ip := net.ParseIP(r.Content)
+		if ip == nil {
+			return fmt.Errorf("invalid address: %q", r.Content)
+		}
+
+		data := ip.To4()
+		if qtype == dnsTypeAAAA {
+			data = ip.To16()
+		}
+		if data == nil {
+			return fmt.Errorf("address %s does not fit a %s record", r.Content, rtype)
+		}
+
+		ttl := r.TTL
+		if ttl <= 0 {
+			ttl = b.defaultTTL
+		}
+		msg.update(fqdn(name), qtype, dnsClassIN, uint32(ttl), data)
+	}
+
+	resp, err := b.exchange(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if rcode := int(resp[3] & 0x0f); rcode != 0 {
+		return fmt.Errorf("update rejected: %s", rcodeName(rcode))
+	}
+	return nil
+}
+
+// exchange signs msg if a key is configured and sends it over UDP,
+// retrying over TCP when the response is truncated
+func (b *rfc2136Backend) exchange(ctx context.Context, msg *dnsMessage) ([]byte, error) {
+	packet := msg.bytes()
+	if b.keyName != "" {
+		packet = b.sign(packet, time.Now())
+	}
+
+	resp, err := b.send(ctx, "udp", packet)
+	if err == nil && resp[2]&0x02 != 0 {
+		resp, err = b.send(ctx, "tcp", packet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", b.server, err)
+	}
+
+	if binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(packet) {
+		return nil, fmt.Errorf("response ID does not match the request")
+	}
+	return resp, nil
+}
+
+// send transmits one packet and returns the response
+func (b *rfc2136Backend) send(ctx context.Context, network string, packet []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: b.timeout}
+	conn, err := dialer.DialContext(ctx, network, b.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(b.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		// TCP messages carry a two byte length prefix
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(packet)))
+		if _, err := conn.Write(append(framed, packet...)); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		return checkHeader(resp)
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 65535)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return checkHeader(resp[:n])
+}
+
+// sign appends a TSIG record signed at now to packet (RFC 8945 section 4.3)
+func (b *rfc2136Backend) sign(packet []byte, now time.Time) []byte {
+	alg := tsigAlgorithms[b.algorithm]
+	timeSigned := uint64(now.Unix())
+
+	// TSIG variables covered by the MAC
+	vars := appendName(nil, strings.ToLower(b.keyName))
+	vars = binary.BigEndian.AppendUint16(vars, dnsClassAny)
+	vars = binary.BigEndian.AppendUint32(vars, 0) // TTL
+	vars = appendName(vars, alg.wireName)
+	vars = appendUint48(vars, timeSigned)
+	vars = binary.BigEndian.AppendUint16(vars, tsigFudge)
+	vars = binary.BigEndian.AppendUint16(vars, 0) // Error
+	vars = binary.BigEndian.AppendUint16(vars, 0) // Other length
+
+	mac := hmac.New(alg.hash, b.keySecret)
+	mac.Write(packet)
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	rdata := appendName(nil, alg.wireName)
+	rdata = appendUint48(rdata, timeSigned)
+	rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, packet[0:2]...)           // Original ID
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // Error
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // Other length
+
+	signed := append([]byte{}, packet...)
+	signed = appendName(signed, b.keyName)
+	signed = binary.BigEndian.AppendUint16(signed, dnsTypeTSIG)
+	signed = binary.BigEndian.AppendUint16(signed, dnsClassAny)
+	signed = binary.BigEndian.AppendUint32(signed, 0)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+
+	// Count the TSIG record in ARCOUNT
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+	return signed
+}
+
+// dnsMessage builds a DNS query or update message. For updates the
+// question, answer and authority sections are the zone, prerequisite and
+// update sections.
+type dnsMessage struct {
+	header   [dnsHeaderSize]byte
+	sections []byte
+}
+
+// newDNSMessage creates a message with a random ID and the given opcode
+func newDNSMessage(opcode int) *dnsMessage {
+	m := &dnsMessage{}
+	rand.Read(m.header[0:2])
+	m.header[2] = byte(opcode << 3)
+	return m
+}
+
+// question appends a question (or zone) entry
+func (m *dnsMessage) question(name string, qtype, class uint16) {
+	m.sections = appendName(m.sections, name)
+	m.sections = binary.BigEndian.AppendUint16(m.sections, qtype)
+	m.sections = binary.BigEndian.AppendUint16(m.sections, class)
+	m.addCount(4)
+}
+
+// update appends a resource record to the update (authority) section.
+// It must be called after question.
+func (m *dnsMessage) update(name string, rtype, class uint16, ttl uint32, data []byte) {
+	m.sections = appendName(m.sections, name)
+	m.sections = binary.BigEndian.AppendUint16(m.sections, rtype)
+	m.sections = binary.BigEndian.AppendUint16(m.sections, class)
+	m.sections = binary.BigEndian.AppendUint32(m.sections, ttl)
+	m.sections = binary.BigEndian.AppendUint16(m.sections, uint16(len(data)))
+	m.sections = append(m.sections, data...)
+	m.addCount(8)
+}
+
+// addCount increments the section count at the given header offset
+func (m *dnsMessage) addCount(offset int) {
+	binary.BigEndian.PutUint16(m.header[offset:], binary.BigEndian.Uint16(m.header[offset:])+1)
+}
+
+// bytes returns the encoded message
+func (m *dnsMessage) bytes() []byte {
+	return append(m.header[:], m.sections...)
+}
+
+// dnsRR is a resource record parsed from a response
+type dnsRR struct {
+	name  string
+	rtype uint16
+	ttl   uint32
+	data  []byte
+}
+
+// parseAnswers returns the records in the answer section of a response
+func parseAnswers(msg []byte) ([]dnsRR, error) {
+	qdCount := int(binary.BigEndian.Uint16(msg[4:]))
+	anCount := int(binary.BigEndian.Uint16(msg[6:]))
+	offset := dnsHeaderSize
+
+	for i := 0; i < qdCount; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+
+	answers := make([]dnsRR, 0, anCount)
+	for i := 0; i < anCount; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errors.New("truncated record")
+		}
+
+		rr := dnsRR{
+			name:  name,
+			rtype: binary.BigEndian.Uint16(msg[next:]),
+			ttl:   binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		if start+length > len(msg) {
+			return nil, errors.New("truncated record data")
+		}
+		rr.data = msg[start : start+length]
+		answers = append(answers, rr)
+		offset = start + length
+	}
+
+	return answers, nil
+}
+
+// readName decodes a possibly compressed name at offset and returns it
+// with the offset just past it
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errors.New("truncated name")
+		}
+
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, errors.New("truncated name")
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("name compression loop")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errors.New("truncated label")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+// appendName appends name in uncompressed wire format
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// appendUint48 appends the low 48 bits of v, as used by TSIG time fields
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// checkHeader ensures a response is long enough to hold a DNS header
+func checkHeader(resp []byte) ([]byte, error) {
+	if len(resp) < dnsHeaderSize {
+		return nil, errors.New("short DNS response")
+	}
+	return resp, nil
+}
+
+// dnsType converts a record type name to its wire value
+func dnsType(rtype string) (uint16, error) {
+	switch rtype {
+	case "A":
+		return dnsTypeA, nil
+	case "AAAA":
+		return dnsTypeAAAA, nil
+	}
+	return 0, fmt.Errorf("unsupported record type: %s", rtype)
+}
+
+// rcodeName returns the mnemonic of a response code
+func rcodeName(rcode int) string {
+	if name, ok := dnsRcodes[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE %d", rcode)
+}
+
+// fqdn returns name with a trailing dot
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,401 @@
+package resultmanager
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats that turn the best IPs into ready-to-use configuration
+const (
+	FormatHosts   ExportFormat = "hosts"    // /etc/hosts entries for the domain
+	FormatClash   ExportFormat = "clash"    // Clash/Mihomo proxies and a url-test group
+	FormatSingBox ExportFormat = "sing-box" // sing-box outbounds and a urltest outbound
+	FormatXray    ExportFormat = "xray"     // Xray outbounds
+	FormatDnsmasq ExportFormat = "dnsmasq"  // dnsmasq address= lines for the domain
+)
+
+// groupTag names the proxy group that load-balances over the exported proxies
+const groupTag = "cloudflare-speedtest"
+
+// ProxyTemplate describes the proxy server reachable through the Cloudflare
+// CDN; each exported proxy is this template pointed at one tested IP
+type ProxyTemplate struct {
+	Type     string // vless, vmess or trojan
+	UUID     string // vless and vmess user ID
+	Password string // trojan password
+	Port     int
+	TLS      bool
+	Network  string // ws or tcp
+	Path     string // WebSocket path
+}
+
+// ExportOptions parameterizes the best-IP formats
+type ExportOptions struct {
+	Domain    string // Hostname served through Cloudflare, also the TLS server name
+	TopN      int    // Number of results to export
+	SortBy    string
+	Ascending bool
+	Proxy     ProxyTemplate
+}
+
+// NewExportOptions returns the options configured in the export section, sorted by speed
+func NewExportOptions(cfg yamlconfig.ExportConfig) ExportOptions {
+	return ExportOptions{
+		Domain: cfg.Domain,
+		TopN:   cfg.TopN,
+		SortBy: "speed",
+		Proxy: ProxyTemplate{
+			Type:     cfg.Proxy.Type,
+			UUID:     cfg.Proxy.UUID,
+			Password: cfg.Proxy.Password,
+			Port:     cfg.Proxy.Port,
+			TLS:      cfg.Proxy.TLS,
+			Network:  cfg.Proxy.Network,
+			Path:     cfg.Proxy.Path,
+		},
+	}
+}
+
+// IsBestIPFormat reports whether format exports only the best IPs and needs ExportOptions
+func IsBestIPFormat(format ExportFormat) bool {
+	switch format {
+	case FormatHosts, FormatClash, FormatSingBox, FormatXray, FormatDnsmasq:
+		return true
+	}
+	return false
+}
+
+// Validate checks that opts carries everything format needs
+func (opts ExportOptions) Validate(format ExportFormat) error {
+	if !IsBestIPFormat(format) {
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+	if opts.Domain == "" {
+		return fmt.Errorf("a domain is required for the %s format", format)
+	}
+	if format == FormatHosts || format == FormatDnsmasq {
+		return nil
+	}
+	return validateProxy(opts.Proxy)
+}
+
+// ExportBest writes the top N completed results in one of the best-IP formats
+func (rm *ResultManager) ExportBest(writer io.Writer, format ExportFormat, opts ExportOptions) error {
+	if err := opts.Validate(format); err != nil {
+		return err
+	}
+
+	best := rm.bestResults(opts)
+	if len(best) == 0 {
+		return fmt.Errorf("no completed results to export")
+	}
+
+	switch format {
+	case FormatHosts:
+		return exportHosts(writer, best, opts)
+	case FormatDnsmasq:
+		return exportDnsmasq(writer, best, opts)
+	case FormatClash:
+		return exportClash(writer, best, opts)
+	case FormatSingBox:
+		return exportSingBox(writer, best, opts)
+	default:
+		return exportXray(writer, best, opts)
+	}
+}
+
+// FileExtension returns the file extension used for the given format
+func FileExtension(format ExportFormat) string {
+	switch format {
+	case FormatHosts:
+		return "hosts"
+	case FormatDnsmasq:
+		return "conf"
+	case FormatClash:
+		return "yaml"
+	case FormatSingBox, FormatXray:
+		return "json"
+	}
+	return string(format)
+}
+
+// bestResults returns the first TopN distinct completed results in the requested order
+func (rm *ResultManager) bestResults(opts ExportOptions) []*models.SpeedTestResult {
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = "speed"
+	}
+	topN := max(opts.TopN, 1)
+
+	best := make([]*models.SpeedTestResult, 0, topN)
+	seen := make(map[string]bool)
+	for _, result := range rm.GetSortedResults(sortBy, opts.Ascending) {
+		if len(best) >= topN {
+			break
+		}
+		if result.Status != models.StatusCompleted || seen[result.IP] || net.ParseIP(result.IP) == nil {
+			continue
+		}
+		seen[result.IP] = true
+		best = append(best, result)
+	}
+	return best
+}
+
+// exportHosts writes one hosts entry per IP
+func exportHosts(writer io.Writer, best []*models.SpeedTestResult, opts ExportOptions) error {
+	fmt.Fprintf(writer, "# Cloudflare IP Speed Test - %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	for _, result := range best {
+		if _, err := fmt.Fprintf(writer, "%s\t%s\t# %s Mbps, %s ms, %s\n",
+			result.IP, opts.Domain, result.SpeedString(), result.LatencyString(), result.DataCenter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportDnsmasq writes one address= line per IP; dnsmasq answers with all of them
+func exportDnsmasq(writer io.Writer, best []*models.SpeedTestResult, opts ExportOptions) error {
+	fmt.Fprintf(writer, "# Cloudflare IP Speed Test - %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	for _, result := range best {
+		if _, err := fmt.Fprintf(writer, "address=/%s/%s\n", opts.Domain, result.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateProxy checks the fields each proxy type needs
+func validateProxy(p ProxyTemplate) error {
+	switch p.Type {
+	case "vless", "vmess":
+		if p.UUID == "" {
+			return fmt.Errorf("a UUID is required for %s proxies", p.Type)
+		}
+	case "trojan":
+		if p.Password == "" {
+			return fmt.Errorf("a password is required for trojan proxies")
+		}
+	default:
+		return fmt.Errorf("unsupported proxy type: %q", p.Type)
+	}
+
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("invalid proxy port: %d", p.Port)
+	}
+	if p.Network != "ws" && p.Network != "tcp" {
+		return fmt.Errorf("unsupported proxy network: %q", p.Network)
+	}
+	return nil
+}
+
+// proxyName names the exported proxy for the i-th best result
+func proxyName(i int, result *models.SpeedTestResult) string {
+	return fmt.Sprintf("cf-%02d %s", i+1, result.IP)
+}
+
+// clashProxy is a proxy entry in a Clash/Mihomo config
+type clashProxy struct {
+	Name       string       `yaml:"name"`
+	Type       string       `yaml:"type"`
+	Server     string       `yaml:"server"`
+	Port       int          `yaml:"port"`
+	UUID       string       `yaml:"uuid,omitempty"`
+	AlterID    *int         `yaml:"alterId,omitempty"`
+	Cipher     string       `yaml:"cipher,omitempty"`
+	Password   string       `yaml:"password,omitempty"`
+	UDP        bool         `yaml:"udp"`
+	TLS        bool         `yaml:"tls,omitempty"`
+	ServerName string       `yaml:"servername,omitempty"`
+	SNI        string       `yaml:"sni,omitempty"`
+	Network    string       `yaml:"network"`
+	WSOpts     *clashWSOpts `yaml:"ws-opts,omitempty"`
+}
+
+// clashWSOpts holds the WebSocket transport settings of a Clash proxy
+type clashWSOpts struct {
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// clashGroup is a proxy group in a Clash/Mihomo config
+type clashGroup struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"`
+	Proxies  []string `yaml:"proxies"`
+	URL      string   `yaml:"url"`
+	Interval int      `yaml:"interval"`
+}
+
+// exportClash writes a proxies list and a url-test group over them
+func exportClash(writer io.Writer, best []*models.SpeedTestResult, opts ExportOptions) error {
+	p := opts.Proxy
+	proxies := make([]clashProxy, len(best))
+	names := make([]string, len(best))
+
+	for i, result := range best {
+		proxy := clashProxy{
+			Name:    proxyName(i, result),
+			Type:    p.Type,
+			Server:  result.IP,
+			Port:    p.Port,
+			UDP:     true,
+			Network: p.Network,
+		}
+
+		switch p.Type {
+		case "trojan":
+			// Trojan always uses TLS; Clash takes the server name as sni
+			proxy.Password = p.Password
+			proxy.SNI = opts.Domain
+		case "vmess":
+			alterID := 0
+			proxy.AlterID = &alterID
+			proxy.Cipher = "auto"
+			fallthrough
+		default:
+			proxy.UUID = p.UUID
+			proxy.TLS = p.TLS
+			if p.TLS {
+				proxy.ServerName = opts.Domain
+			}
+		}
+
+		if p.Network == "ws" {
+			proxy.WSOpts = &clashWSOpts{Path: p.Path, Headers: map[string]string{"Host": opts.Domain}}
+		}
+
+		proxies[i] = proxy
+		names[i] = proxy.Name
+	}
+
+	config := struct {
+		Proxies     []clashProxy `yaml:"proxies"`
+		ProxyGroups []clashGroup `yaml:"proxy-groups"`
+	}{
+		Proxies: proxies,
+		ProxyGroups: []clashGroup{{
+			Name:     groupTag,
+			Type:     "url-test",
+			Proxies:  names,
+			URL:      "https://www.gstatic.com/generate_204",
+			Interval: 300,
+		}},
+	}
+
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return fmt.Errorf("failed to encode Clash config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// exportSingBox writes sing-box outbounds and a urltest outbound over them
+func exportSingBox(writer io.Writer, best []*models.SpeedTestResult, opts ExportOptions) error {
+	p := opts.Proxy
+	outbounds := make([]map[string]any, 0, len(best)+1)
+	tags := make([]string, len(best))
+
+	for i, result := range best {
+		outbound := map[string]any{
+			"type":        p.Type,
+			"tag":         proxyName(i, result),
+			"server":      result.IP,
+			"server_port": p.Port,
+		}
+
+		switch p.Type {
+		case "trojan":
+			outbound["password"] = p.Password
+		case "vmess":
+			outbound["uuid"] = p.UUID
+			outbound["security"] = "auto"
+		default:
+			outbound["uuid"] = p.UUID
+		}
+
+		if p.TLS || p.Type == "trojan" {
+			outbound["tls"] = map[string]any{"enabled": true, "server_name": opts.Domain}
+		}
+		if p.Network == "ws" {
+			outbound["transport"] = map[string]any{
+				"type":    "ws",
+				"path":    p.Path,
+				"headers": map[string]string{"Host": opts.Domain},
+			}
+		}
+
+		outbounds = append(outbounds, outbound)
+		tags[i] = proxyName(i, result)
+	}
+
+	outbounds = append(outbounds, map[string]any{
+		"type":      "urltest",
+		"tag":       groupTag,
+		"outbounds": tags,
+	})
+
+	return writeIndentedJSON(writer, map[string]any{"outbounds": outbounds}, "sing-box")
+}
+
+// exportXray writes Xray outbounds, one per IP
+func exportXray(writer io.Writer, best []*models.SpeedTestResult, opts ExportOptions) error {
+	p := opts.Proxy
+	outbounds := make([]map[string]any, 0, len(best))
+
+	for i, result := range best {
+		var settings map[string]any
+		switch p.Type {
+		case "trojan":
+			settings = map[string]any{
+				"servers": []map[string]any{{"address": result.IP, "port": p.Port, "password": p.Password}},
+			}
+		case "vmess":
+			settings = map[string]any{
+				"vnext": []map[string]any{{"address": result.IP, "port": p.Port,
+					"users": []map[string]any{{"id": p.UUID, "alterId": 0, "security": "auto"}}}},
+			}
+		default:
+			settings = map[string]any{
+				"vnext": []map[string]any{{"address": result.IP, "port": p.Port,
+					"users": []map[string]any{{"id": p.UUID, "encryption": "none"}}}},
+			}
+		}
+
+		stream := map[string]any{"network": p.Network, "security": "none"}
+		if p.TLS || p.Type == "trojan" {
+			stream["security"] = "tls"
+			stream["tlsSettings"] = map[string]any{"serverName": opts.Domain}
+		}
+		if p.Network == "ws" {
+			stream["wsSettings"] = map[string]any{"path": p.Path, "headers": map[string]string{"Host": opts.Domain}}
+		}
+
+		outbounds = append(outbounds, map[string]any{
+			"tag":            proxyName(i, result),
+			"protocol":       p.Type,
+			"settings":       settings,
+			"streamSettings": stream,
+		})
+	}
+
+	return writeIndentedJSON(writer, map[string]any{"outbounds": outbounds}, "Xray")
+}
+
+// writeIndentedJSON encodes v as indented JSON
+func writeIndentedJSON(writer io.Writer, v any, name string) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode %s config: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package resultmanager
+
+import (
+	"bytes"
+	"cloudflare-speedtest/pkg/models"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// newTestManager holds a mix of usable and unusable results. By speed the
+// best usable ones are 104.16.1.1, 2606:4700::6810:1 and 172.64.2.2.
+func newTestManager(t *testing.T) *ResultManager {
+	t.Helper()
+	rm := New(100)
+	for _, result := range []*models.SpeedTestResult{
+		{IP: "172.64.2.2", Status: models.StatusCompleted, Speed: 80, Latency: 35, DataCenter: "NRT"},
+		{IP: "104.16.1.1", Status: models.StatusCompleted, Speed: 150, Latency: 48, DataCenter: "HKG"},
+		{IP: "188.114.9.9", Status: models.StatusSlow, Speed: 400, Latency: 20, DataCenter: "SIN"},
+		{IP: "2606:4700::6810:1", Status: models.StatusCompleted, Speed: 120, Latency: 52, DataCenter: "LAX"},
+		{IP: "not-an-ip", Status: models.StatusCompleted, Speed: 300},
+		{IP: "162.159.3.3", Status: models.StatusCompleted, Speed: 20, Latency: 90, DataCenter: "FRA"},
+	} {
+		if err := rm.AddResult(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rm
+}
+
+// dataLines returns the lines of out that are not comments
+func dataLines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestExportBestLines(t *testing.T) {
+	tests := []struct {
+		format ExportFormat
+		topN   int
+		want   []string
+	}{
+		{FormatDnsmasq, 2, []string{"address=/cdn.example.org/104.16.1.1", "address=/cdn.example.org/2606:4700::6810:1"}},
+		{FormatDnsmasq, 0, []string{"address=/cdn.example.org/104.16.1.1"}},
+		{FormatHosts, 3, []string{
+			"104.16.1.1\tcdn.example.org\t# 150.00 Mbps, 48.00 ms, HKG",
+			"2606:4700::6810:1\tcdn.example.org\t# 120.00 Mbps, 52.00 ms, LAX",
+			"172.64.2.2\tcdn.example.org\t# 80.00 Mbps, 35.00 ms, NRT",
+		}},
+	}
+
+	rm := newTestManager(t)
+	for _, tt := range tests {
+		var out bytes.Buffer
+		opts := ExportOptions{Domain: "cdn.example.org", TopN: tt.topN}
+		if err := rm.ExportBest(&out, tt.format, opts); err != nil {
+			t.Fatalf("ExportBest(%s) error = %v", tt.format, err)
+		}
+		if got := dataLines(out.String()); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("ExportBest(%s, top %d) =\n%s\nwant\n%s", tt.format, tt.topN,
+				strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestExportBestSortedByLatency(t *testing.T) {
+	var out bytes.Buffer
+	opts := ExportOptions{Domain: "cdn.example.org", TopN: 1, SortBy: "latency", Ascending: true}
+	if err := newTestManager(t).ExportBest(&out, FormatDnsmasq, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := dataLines(out.String()); len(got) != 1 || got[0] != "address=/cdn.example.org/172.64.2.2" {
+		t.Errorf("lowest latency export = %v, want 172.64.2.2", got)
+	}
+}
+
+func TestExportClash(t *testing.T) {
+	tests := []struct {
+		proxy ProxyTemplate
+		check func(t *testing.T, proxy map[string]any)
+	}{
+		{
+			proxy: ProxyTemplate{Type: "vmess", UUID: "u-1", Port: 443, TLS: true, Network: "ws", Path: "/ray"},
+			check: func(t *testing.T, proxy map[string]any) {
+				if proxy["alterId"] != 0 || proxy["cipher"] != "auto" || proxy["servername"] != "cdn.example.org" {
+					t.Errorf("vmess proxy = %v, want alterId 0, cipher auto and the domain as servername", proxy)
+				}
+				wsOpts, _ := proxy["ws-opts"].(map[string]any)
+				headers, _ := wsOpts["headers"].(map[string]any)
+				if wsOpts["path"] != "/ray" || headers["Host"] != "cdn.example.org" {
+					t.Errorf("ws-opts = %v, want the path and the domain as Host", wsOpts)
+				}
+			},
+		},
+		{
+			proxy: ProxyTemplate{Type: "trojan", Password: "pw", Port: 2053, Network: "tcp"},
+			check: func(t *testing.T, proxy map[string]any) {
+				if proxy["password"] != "pw" || proxy["sni"] != "cdn.example.org" || proxy["uuid"] != nil {
+					t.Errorf("trojan proxy = %v, want the password and the domain as sni", proxy)
+				}
+				if _, ok := proxy["ws-opts"]; ok {
+					t.Error("tcp proxy has ws-opts")
+				}
+			},
+		},
+	}
+
+	rm := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.proxy.Type, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := ExportOptions{Domain: "cdn.example.org", TopN: 2, Proxy: tt.proxy}
+			if err := rm.ExportBest(&out, FormatClash, opts); err != nil {
+				t.Fatalf("ExportBest() error = %v", err)
+			}
+
+			var config struct {
+				Proxies     []map[string]any `yaml:"proxies"`
+				ProxyGroups []clashGroup     `yaml:"proxy-groups"`
+			}
+			if err := yaml.Unmarshal(out.Bytes(), &config); err != nil {
+				t.Fatalf("output is not YAML: %v", err)
+			}
+
+			if len(config.Proxies) != 2 || config.Proxies[1]["server"] != "2606:4700::6810:1" ||
+				config.Proxies[0]["name"] != "cf-01 104.16.1.1" || config.Proxies[0]["port"] != tt.proxy.Port {
+				t.Fatalf("proxies = %v, want the two fastest IPs on port %d", config.Proxies, tt.proxy.Port)
+			}
+			tt.check(t, config.Proxies[0])
+
+			if len(config.ProxyGroups) != 1 || config.ProxyGroups[0].Type != "url-test" ||
+				strings.Join(config.ProxyGroups[0].Proxies, ",") != "cf-01 104.16.1.1,cf-02 2606:4700::6810:1" {
+				t.Errorf("proxy groups = %+v, want one url-test group over both proxies", config.ProxyGroups)
+			}
+		})
+	}
+}
+
+func TestExportSingBoxAndXray(t *testing.T) {
+	tests := []struct {
+		format ExportFormat
+		proxy  ProxyTemplate
+		want   []string // JSON fragments of the first outbound
+	}{
+		{
+			format: FormatSingBox,
+			proxy:  ProxyTemplate{Type: "vless", UUID: "u-2", Port: 8443, TLS: true, Network: "ws", Path: "/v"},
+			want: []string{`"type":"vless"`, `"uuid":"u-2"`, `"server_port":8443`,
+				`"tls":{"enabled":true,"server_name":"cdn.example.org"}`,
+				`"transport":{"headers":{"Host":"cdn.example.org"},"path":"/v","type":"ws"}`},
+		},
+		{
+			format: FormatSingBox,
+			proxy:  ProxyTemplate{Type: "trojan", Password: "pw", Port: 443, Network: "tcp"},
+			want:   []string{`"password":"pw"`, `"tls":{"enabled":true,"server_name":"cdn.example.org"}`},
+		},
+		{
+			format: FormatXray,
+			proxy:  ProxyTemplate{Type: "vless", UUID: "u-3", Port: 80, Network: "ws", Path: "/x"},
+			want: []string{`"protocol":"vless"`, `"users":[{"encryption":"none","id":"u-3"}]`,
+				`"security":"none"`, `"wsSettings":{"headers":{"Host":"cdn.example.org"},"path":"/x"}`},
+		},
+		{
+			format: FormatXray,
+			proxy:  ProxyTemplate{Type: "vmess", UUID: "u-4", Port: 443, TLS: true, Network: "tcp"},
+			want: []string{`"users":[{"alterId":0,"id":"u-4","security":"auto"}]`,
+				`"security":"tls"`, `"tlsSettings":{"serverName":"cdn.example.org"}`},
+		},
+	}
+
+	rm := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(string(tt.format)+" "+tt.proxy.Type, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := ExportOptions{Domain: "cdn.example.org", TopN: 3, Proxy: tt.proxy}
+			if err := rm.ExportBest(&out, tt.format, opts); err != nil {
+				t.Fatalf("ExportBest() error = %v", err)
+			}
+
+			var config struct {
+				Outbounds []json.RawMessage `json:"outbounds"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &config); err != nil {
+				t.Fatalf("output is not JSON: %v", err)
+			}
+
+			wantOutbounds := 3
+			if tt.format == FormatSingBox {
+				wantOutbounds++ // The urltest outbound
+				last := string(config.Outbounds[len(config.Outbounds)-1])
+				if !strings.Contains(compact(t, last), `"type":"urltest"`) {
+					t.Errorf("last outbound = %s, want the urltest group", last)
+				}
+			}
+			if len(config.Outbounds) != wantOutbounds {
+				t.Fatalf("got %d outbounds, want %d", len(config.Outbounds), wantOutbounds)
+			}
+
+			first := compact(t, string(config.Outbounds[0]))
+			for _, fragment := range append(tt.want, `"cf-01 104.16.1.1"`) {
+				if !strings.Contains(first, fragment) {
+					t.Errorf("first outbound %s does not contain %s", first, fragment)
+				}
+			}
+		})
+	}
+}
+
+// compact removes the indentation of a JSON document
+func compact(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestExportOptionsValidate(t *testing.T) {
+	vless := ProxyTemplate{Type: "vless", UUID: "u", Port: 443, Network: "ws"}
+
+	tests := []struct {
+		format  ExportFormat
+		opts    ExportOptions
+		wantErr string
+	}{
+		{FormatHosts, ExportOptions{Domain: "a.example"}, ""},
+		{FormatHosts, ExportOptions{}, "a domain is required for the hosts format"},
+		{FormatCSV, ExportOptions{Domain: "a.example"}, "unsupported export format: csv"},
+		{FormatClash, ExportOptions{Domain: "a.example", Proxy: vless}, ""},
+		{FormatClash, ExportOptions{Domain: "a.example"}, `unsupported proxy type: ""`},
+		{FormatXray, ExportOptions{Domain: "a.example", Proxy: ProxyTemplate{Type: "vmess", Port: 443, Network: "ws"}},
+			"a UUID is required for vmess proxies"},
+		{FormatSingBox, ExportOptions{Domain: "a.example", Proxy: ProxyTemplate{Type: "trojan", Port: 443, Network: "tcp"}},
+			"a password is required for trojan proxies"},
+		{FormatSingBox, ExportOptions{Domain: "a.example", Proxy: ProxyTemplate{Type: "vless", UUID: "u", Port: 70000, Network: "ws"}},
+			"invalid proxy port: 70000"},
+		{FormatSingBox, ExportOptions{Domain: "a.example", Proxy: ProxyTemplate{Type: "vless", UUID: "u", Port: 443, Network: "grpc"}},
+			`unsupported proxy network: "grpc"`},
+	}
+
+	for _, tt := range tests {
+		err := tt.opts.Validate(tt.format)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("Validate(%s) error = %v", tt.format, err)
+		}
+		if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("Validate(%s) error = %v, want %q", tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExportBestWithoutResults(t *testing.T) {
+	rm := New(10)
+	rm.AddResult(&models.SpeedTestResult{IP: "104.16.1.1", Status: models.StatusSlow, Speed: 2})
+
+	var out bytes.Buffer
+	err := rm.ExportBest(&out, FormatHosts, ExportOptions{Domain: "cdn.example.org", TopN: 5})
+	if err == nil || err.Error() != "no completed results to export" {
+		t.Errorf("ExportBest() error = %v, want no completed results", err)
+	}
+}
+
+func TestExportToCSV(t *testing.T) {
+	rm := New(10)
+	rm.AddResult(&models.SpeedTestResult{IP: "104.16.1.1", Status: models.StatusCompleted, Speed: 150, UploadSpeed: 42.5, UploadBytes: 1 << 20})
+	rm.AddResult(&models.SpeedTestResult{IP: "104.16.2.2", Status: models.StatusInvalid, Error: "connection reset"})
+
+	var out bytes.Buffer
+	if err := rm.Export(&out, FormatCSV, "speed", false, "en"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 results", len(records))
+	}
+
+	header := records[0]
+	column := func(record []string, name string) string {
+		for i, h := range header {
+			if h == name {
+				return record[i]
+			}
+		}
+		t.Fatalf("no %s column", name)
+		return ""
+	}
+
+	// Older columns keep their position for existing consumers
+	if header[0] != "IP" || header[3] != "Speed(Mbps)" || header[10] != "StatusCode" {
+		t.Errorf("header = %v, want the original columns first", header)
+	}
+	if got := column(records[1], "Upload(Mbps)"); got != "42.50" {
+		t.Errorf("Upload(Mbps) = %q, want 42.50", got)
+	}
+	if got := column(records[1], "UploadBytes"); got != "1048576" {
+		t.Errorf("UploadBytes = %q, want 1048576", got)
+	}
+	if got := column(records[2], "Speed(Mbps)"); got != "timeout" {
+		t.Errorf("failed result speed = %q, want timeout", got)
+	}
+	if got := column(records[2], "Upload(Mbps)"); got != "" {
+		t.Errorf("unmeasured upload = %q, want an empty column", got)
+	}
+}
@@ -114,21 +114,19 @@ func (rm *ResultManager) GetSortedResults(sortBy string, ascending bool) []*mode
 		var less bool
 		switch sortBy {
 		case "speed":
-			speedI, _ := strconv.ParseFloat(results[i].Speed, 64)
-			speedJ, _ := strconv.ParseFloat(results[j].Speed, 64)
-			less = speedI < speedJ
+			less = results[i].Speed < results[j].Speed
 		case "latency":
-			latencyI, _ := strconv.ParseFloat(results[i].Latency, 64)
-			latencyJ, _ := strconv.ParseFloat(results[j].Latency, 64)
-			less = latencyI < latencyJ
+			less = results[i].EffectiveLatency() < results[j].EffectiveLatency()
+		case "score":
+			less = results[i].Score < results[j].Score
+		case "upload":
+			less = results[i].UploadSpeed < results[j].UploadSpeed
 		case "datacenter":
 			less = results[i].DataCenter < results[j].DataCenter
 		case "ip":
 			less = results[i].IP < results[j].IP
 		default: // Default sort by speed
-			speedI, _ := strconv.ParseFloat(results[i].Speed, 64)
-			speedJ, _ := strconv.ParseFloat(results[j].Speed, 64)
-			less = speedI < speedJ
+			less = results[i].Speed < results[j].Speed
 		}
 
 		if ascending {
@@ -147,7 +145,7 @@ func (rm *ResultManager) GetQualifiedResults() []*models.SpeedTestResult {
 
 	qualified := make([]*models.SpeedTestResult, 0)
 	for _, result := range rm.results {
-		if result.Status == "已完成" {
+		if result.Status == models.StatusCompleted {
 			qualified = append(qualified, result)
 		}
 	}
@@ -205,15 +203,20 @@ func (rm *ResultManager) Clear() {
 	rm.statsMu.Unlock()
 }
 
-// ExportToCSV exports results to CSV format
-func (rm *ResultManager) ExportToCSV(writer io.Writer, sortBy string, ascending bool) error {
+// ExportToCSV exports results to CSV format with status labels in lang
+func (rm *ResultManager) ExportToCSV(writer io.Writer, sortBy string, ascending bool, lang string) error {
 	results := rm.GetSortedResults(sortBy, ascending)
 
 	csvWriter := csv.NewWriter(writer)
 	defer csvWriter.Flush()
 
 	// Write header
-	header := []string{"IP", "Status", "Latency(ms)", "Speed(Mbps)", "PeakSpeed(Mbps)", "DataCenter"}
+	// New columns are appended so existing consumers keep working
+	header := []string{"IP", "Status", "Latency(ms)", "Speed(Mbps)", "PeakSpeed(Mbps)", "DataCenter",
+		"TTFB(ms)", "Bytes", "TestedAt", "Error", "StatusCode",
+		"LatencyMin(ms)", "LatencyAvg(ms)", "LatencyMedian(ms)", "LatencyP95(ms)", "Jitter(ms)", "Loss(%)",
+		"Connect(ms)", "TLSHandshake(ms)", "FirstByte(ms)", "Transfer(ms)", "Score",
+		"Upload(Mbps)", "UploadBytes"}
 	if err := csvWriter.Write(header); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
@@ -222,12 +225,21 @@ func (rm *ResultManager) ExportToCSV(writer io.Writer, sortBy string, ascending
 	for _, result := range results {
 		record := []string{
 			result.IP,
-			result.Status,
-			result.Latency,
-			result.Speed,
+			result.Status.Label(lang),
+			result.LatencyString(),
+			result.SpeedString(),
 			fmt.Sprintf("%.2f", result.PeakSpeed),
 			result.DataCenter,
+			formatMs(result.TTFB),
+			strconv.FormatInt(result.Bytes, 10),
+			formatTestedAt(result.TestedAt),
+			result.Error,
+			string(result.Status),
 		}
+		record = append(record, latencyStatsRecord(result.LatencyStats)...)
+		record = append(record, timingRecord(result.Timing)...)
+		record = append(record, fmt.Sprintf("%.1f", result.Score))
+		record = append(record, uploadRecord(result)...)
 		if err := csvWriter.Write(record); err != nil {
 			return fmt.Errorf("failed to write CSV record: %w", err)
 		}
@@ -236,8 +248,8 @@ func (rm *ResultManager) ExportToCSV(writer io.Writer, sortBy string, ascending
 	return nil
 }
 
-// ExportToJSON exports results to JSON format
-func (rm *ResultManager) ExportToJSON(writer io.Writer, sortBy string, ascending bool) error {
+// ExportToJSON exports results to JSON format with status labels in lang
+func (rm *ResultManager) ExportToJSON(writer io.Writer, sortBy string, ascending bool, lang string) error {
 	results := rm.GetSortedResults(sortBy, ascending)
 
 	encoder := json.NewEncoder(writer)
@@ -247,7 +259,7 @@ func (rm *ResultManager) ExportToJSON(writer io.Writer, sortBy string, ascending
 		"timestamp":       time.Now().Format(time.RFC3339),
 		"total_count":     len(results),
 		"qualified_count": len(rm.GetQualifiedResults()),
-		"results":         results,
+		"results":         models.Localize(results, lang),
 		"statistics":      rm.GetStats(),
 	}
 
@@ -258,8 +270,8 @@ func (rm *ResultManager) ExportToJSON(writer io.Writer, sortBy string, ascending
 	return nil
 }
 
-// ExportToTXT exports results to human-readable text format
-func (rm *ResultManager) ExportToTXT(writer io.Writer, sortBy string, ascending bool) error {
+// ExportToTXT exports results to human-readable text format with status labels in lang
+func (rm *ResultManager) ExportToTXT(writer io.Writer, sortBy string, ascending bool, lang string) error {
 	results := rm.GetSortedResults(sortBy, ascending)
 	stats := rm.GetStats()
 
@@ -272,38 +284,105 @@ func (rm *ResultManager) ExportToTXT(writer io.Writer, sortBy string, ascending
 	fmt.Fprintf(writer, "\n")
 
 	// Write table header
-	fmt.Fprintf(writer, "%-15s %-8s %-12s %-12s %-12s %-20s\n",
-		"IP", "Status", "Latency(ms)", "Speed(Mbps)", "Peak(Mbps)", "DataCenter")
-	fmt.Fprintf(writer, "%s\n", strings.Repeat("-", 85))
+	fmt.Fprintf(writer, "%-15s %-8s %-12s %-12s %-12s %-13s %-20s %-11s %-8s %-6s\n",
+		"IP", "Status", "Latency(ms)", "Speed(Mbps)", "Peak(Mbps)", "Upload(Mbps)", "DataCenter", "Jitter(ms)", "Loss(%)", "Score")
+	fmt.Fprintf(writer, "%s\n", strings.Repeat("-", 126))
 
 	// Write results
 	for _, result := range results {
-		fmt.Fprintf(writer, "%-15s %-8s %-12s %-12s %-12.2f %-20s\n",
+		jitter, loss, upload := "-", "-", "-"
+		if stats := result.LatencyStats; stats != nil {
+			jitter = fmt.Sprintf("%.2f", stats.Jitter)
+			loss = fmt.Sprintf("%.0f", stats.Loss)
+		}
+		if result.UploadSpeed > 0 {
+			upload = fmt.Sprintf("%.2f", result.UploadSpeed)
+		}
+		fmt.Fprintf(writer, "%-15s %-8s %-12s %-12s %-12.2f %-13s %-20s %-11s %-8s %-6.1f\n",
 			result.IP,
-			result.Status,
-			result.Latency,
-			result.Speed,
+			result.Status.Label(lang),
+			result.LatencyString(),
+			result.SpeedString(),
 			result.PeakSpeed,
-			result.DataCenter)
+			upload,
+			result.DataCenter,
+			jitter,
+			loss,
+			result.Score)
 	}
 
 	return nil
 }
 
-// Export exports results in the specified format
-func (rm *ResultManager) Export(writer io.Writer, format ExportFormat, sortBy string, ascending bool) error {
+// Export exports results in the specified format with status labels in lang
+func (rm *ResultManager) Export(writer io.Writer, format ExportFormat, sortBy string, ascending bool, lang string) error {
 	switch format {
 	case FormatCSV:
-		return rm.ExportToCSV(writer, sortBy, ascending)
+		return rm.ExportToCSV(writer, sortBy, ascending, lang)
 	case FormatJSON:
-		return rm.ExportToJSON(writer, sortBy, ascending)
+		return rm.ExportToJSON(writer, sortBy, ascending, lang)
 	case FormatTXT:
-		return rm.ExportToTXT(writer, sortBy, ascending)
+		return rm.ExportToTXT(writer, sortBy, ascending, lang)
 	default:
 		return fmt.Errorf("unsupported export format: %s", format)
 	}
 }
 
+// latencyStatsRecord formats the latency statistics columns of a CSV record,
+// leaving them empty if no repeated probes were made
+func latencyStatsRecord(stats *models.LatencyStats) []string {
+	if stats == nil {
+		return make([]string, 6)
+	}
+	return []string{
+		fmt.Sprintf("%.2f", stats.Min),
+		fmt.Sprintf("%.2f", stats.Avg),
+		fmt.Sprintf("%.2f", stats.Median),
+		fmt.Sprintf("%.2f", stats.P95),
+		fmt.Sprintf("%.2f", stats.Jitter),
+		fmt.Sprintf("%.0f", stats.Loss),
+	}
+}
+
+// timingRecord formats the connection timing columns of a CSV record,
+// leaving them empty if the download failed
+func timingRecord(timing *models.ConnectionTiming) []string {
+	if timing == nil {
+		return make([]string, 4)
+	}
+	return []string{
+		formatMs(timing.Connect),
+		formatMs(timing.TLSHandshake),
+		formatMs(timing.FirstByte),
+		formatMs(timing.Transfer),
+	}
+}
+
+// uploadRecord returns the upload columns of a CSV record, empty if the
+// upload was not measured
+func uploadRecord(result *models.SpeedTestResult) []string {
+	if result.UploadSpeed == 0 {
+		return make([]string, 2)
+	}
+	return []string{
+		fmt.Sprintf("%.2f", result.UploadSpeed),
+		strconv.FormatInt(result.UploadBytes, 10),
+	}
+}
+
+// formatMs formats a duration in milliseconds
+func formatMs(d time.Duration) string {
+	return fmt.Sprintf("%.2f", float64(d)/float64(time.Millisecond))
+}
+
+// formatTestedAt formats a result timestamp for CSV, leaving it empty if unknown
+func formatTestedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
 // GetMemoryUsage returns current memory usage information
 func (rm *ResultManager) GetMemoryUsage() map[string]interface{} {
 	rm.mu.RLock()
@@ -323,7 +402,7 @@ func (rm *ResultManager) updateStats(result *models.SpeedTestResult) {
 	defer rm.statsMu.Unlock()
 
 	rm.stats.Completed++
-	if result.Status == "已完成" {
+	if result.Status == models.StatusCompleted {
 		rm.stats.Qualified++
 	}
 }
@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Thursday
+	thursday := time.Date(2026, 1, 15, 10, 7, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want string
+	}{
+		{"*/15 * * * *", thursday, "2026-01-15 10:15"},
+		{"0 */6 * * *", thursday, "2026-01-15 12:00"},
+		{"30 8-18/4 * * *", thursday, "2026-01-15 12:30"},
+		{"5,40 9,10 * * *", thursday, "2026-01-15 10:40"},
+		{"5 10 * * *", thursday, "2026-01-16 10:05"},
+		{"7 10 15 1 *", thursday, "2027-01-15 10:07"},
+		{"@monthly", thursday, "2026-02-01 00:00"},
+		{"@hourly", time.Date(2026, 12, 31, 23, 59, 30, 0, time.UTC), "2027-01-01 00:00"},
+
+		// Sunday as 0 and as 7
+		{"0 0 * * 0", thursday, "2026-01-18 00:00"},
+		{"0 0 * * 7", thursday, "2026-01-18 00:00"},
+		{"0 0 * * 5-7", thursday, "2026-01-16 00:00"},
+
+		// With one day field left as *, the other must match
+		{"0 0 13 * *", thursday, "2026-02-13 00:00"},
+		{"0 0 * * */2", thursday, "2026-01-17 00:00"},
+		// With both restricted, either may match: the 13th or a Friday
+		{"0 0 13 * 5", thursday, "2026-01-16 00:00"},
+		{"0 0 20 * 1", thursday, "2026-01-19 00:00"},
+		{"0 0 */10 * 1", time.Date(2026, 1, 19, 12, 0, 0, 0, time.UTC), "2026-01-21 00:00"},
+
+		// Leap days and short months are skipped until they exist
+		{"0 9 29 2 *", thursday, "2028-02-29 09:00"},
+		{"0 0 31 * *", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), "2026-03-31 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.from).Format("2006-01-02 15:04"); got != tt.want {
+				t.Errorf("Next(%s) = %s, want %s", tt.from.Format(time.DateTime), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "must have 5 fields, got 0"},
+		{"0 * * *", "must have 5 fields, got 4"},
+		{"@every 5m", "must have 5 fields, got 2"},
+		{"60 * * * *", "invalid minute field"},
+		{"* 24 * * *", "invalid hour field"},
+		{"* * 0 * *", "invalid day of month field"},
+		{"* * * 13 *", "invalid month field"},
+		{"* * * * 8", "invalid day of week field"},
+		{"*/0 * * * *", `invalid step "0"`},
+		{"*/x * * * *", `invalid step "x"`},
+		{"30-10 * * * *", "value out of range 0-59"},
+		{"1-x * * * *", `invalid value "x"`},
+		{"mon * * * *", `invalid value "mon"`},
+		{"0 0 31 2 *", "never matches a date"},
+		{"0 0 30,31 2 *", "never matches a date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCron(%q) error = %v, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	from := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		cron, interval string
+		want           time.Time
+		wantErr        string
+	}{
+		{interval: "6h", want: from.Add(6 * time.Hour)},
+		{cron: "@daily", want: time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{interval: "30s", wantErr: "at least 1m0s"},
+		{interval: "daily", wantErr: "invalid interval"},
+		{cron: "@daily", interval: "6h", wantErr: "not both"},
+		{wantErr: "either cron or interval is required"},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.cron, tt.interval)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse(%q, %q) error = %v, want it to contain %q", tt.cron, tt.interval, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q, %q) error = %v", tt.cron, tt.interval, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q, %q).Next() = %v, want %v", tt.cron, tt.interval, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Schedule computes when the next run is due
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule runs at a fixed interval
+type intervalSchedule struct {
+	every time.Duration
+}
+
+// minInterval keeps interval schedules from hammering the test endpoints
+const minInterval = time.Minute
+
+// Every returns a schedule that runs every d
+func Every(d time.Duration) (Schedule, error) {
+	if d < minInterval {
+		return nil, fmt.Errorf("interval must be at least %s", minInterval)
+	}
+	return intervalSchedule{every: d}, nil
+}
+
+// Next returns t plus the interval
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.every)
+}
+
+// Parse builds a schedule from either a cron expression or an interval such
+// as "6h"; exactly one of them must be set
+func Parse(cronExpr, interval string) (Schedule, error) {
+	switch {
+	case cronExpr != "" && interval != "":
+		return nil, fmt.Errorf("set either cron or interval, not both")
+	case cronExpr != "":
+		return ParseCron(cronExpr)
+	case interval != "":
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", interval, err)
+		}
+		return Every(d)
+	default:
+		return nil, fmt.Errorf("either cron or interval is required")
+	}
+}
+
+// Scheduler calls a trigger function each time its schedule fires
+type Scheduler struct {
+	mu      sync.Mutex
+	trigger func()
+	stop    chan struct{}
+	next    time.Time
+}
+
+// New creates a stopped scheduler that calls trigger when a run is due
+func New(trigger func()) *Scheduler {
+	return &Scheduler{trigger: trigger}
+}
+
+// Start runs the scheduler on schedule, replacing any schedule already running
+func (s *Scheduler) Start(schedule Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopLocked()
+
+	stop := make(chan struct{})
+	s.stop = stop
+	s.next = schedule.Next(time.Now())
+
+	go s.loop(schedule, stop)
+}
+
+// Stop stops the scheduler; a run already triggered is not affected
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+// NextRun returns when the next run is due, or the zero time if stopped
+func (s *Scheduler) NextRun() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next
+}
+
+// IsRunning returns whether a schedule is active
+func (s *Scheduler) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stop != nil
+}
+
+// stopLocked stops the loop (must be called with lock held)
+func (s *Scheduler) stopLocked() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.next = time.Time{}
+}
+
+// loop waits for each due time and fires the trigger until stopped
+func (s *Scheduler) loop(schedule Schedule, stop chan struct{}) {
+	s.mu.Lock()
+	next := s.next
+	s.mu.Unlock()
+
+	for !next.IsZero() {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// Compute the following run before triggering so a long run
+		// cannot push the schedule back
+		next = schedule.Next(time.Now())
+		s.mu.Lock()
+		if s.stop != stop {
+			s.mu.Unlock()
+			return
+		}
+		s.next = next
+		s.mu.Unlock()
+
+		s.trigger()
+	}
+}
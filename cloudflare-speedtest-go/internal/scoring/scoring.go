@@ -0,0 +1,134 @@
+package scoring
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"fmt"
+	"strings"
+)
+
+// Values at which the speed, latency and jitter terms score one half
+const (
+	defaultBandwidth = 100.0 // Mbps, used when no bandwidth is required
+	latencyReference = 100.0 // ms
+	jitterReference  = 20.0  // ms
+)
+
+// Scorer scores results and decides which of them qualify
+type Scorer struct {
+	weights          yamlconfig.ScoringWeights
+	preferred        map[string]bool
+	bandwidth        float64
+	minScore         float64
+	latencyCeilingMs float64
+}
+
+// New creates a scorer for cfg. bandwidth is the speed a result must reach
+// to qualify, as in test.bandwidth.
+func New(cfg yamlconfig.ScoringConfig, bandwidth float64) *Scorer {
+	preferred := make(map[string]bool)
+	for _, code := range cfg.PreferredDataCenters {
+		preferred[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+
+	return &Scorer{
+		weights:          cfg.Weights,
+		preferred:        preferred,
+		bandwidth:        bandwidth,
+		minScore:         cfg.MinScore,
+		latencyCeilingMs: cfg.LatencyCeilingMs,
+	}
+}
+
+// Score returns the score of result from 0 to 100: the weighted average of
+// its terms, each rated from 0 to 1. Jitter and loss only count when the
+// latency was probed repeatedly, and the data center only when preferred
+// data centers are set. Failed results score 0.
+func (s *Scorer) Score(result *models.SpeedTestResult) float64 {
+	if result.Status == models.StatusInvalid || result.Speed <= 0 {
+		return 0
+	}
+
+	reference := s.bandwidth
+	if reference <= 0 {
+		reference = defaultBandwidth
+	}
+
+	var total, weights float64
+	add := func(weight, term float64) {
+		total += weight * term
+		weights += weight
+	}
+
+	add(s.weights.Speed, result.Speed/(result.Speed+reference))
+	add(s.weights.PeakSpeed, result.PeakSpeed/(result.PeakSpeed+reference))
+	add(s.weights.Latency, latencyReference/(latencyReference+max(result.Latency, 0)))
+
+	if stats := result.LatencyStats; stats != nil {
+		add(s.weights.Jitter, jitterReference/(jitterReference+stats.Jitter))
+		add(s.weights.Loss, 1-stats.Loss/100)
+	}
+
+	if len(s.preferred) > 0 {
+		term := 0.0
+		if s.preferred[dataCenterCode(result.DataCenter)] {
+			term = 1
+		}
+		add(s.weights.DataCenter, term)
+	}
+
+	if weights == 0 {
+		return 0
+	}
+	return total / weights * 100
+}
+
+// Reject returns why a completed result misses the score or latency
+// threshold, or an empty string if it meets both
+func (s *Scorer) Reject(result *models.SpeedTestResult) string {
+	if s.latencyCeilingMs > 0 && result.Latency > s.latencyCeilingMs {
+		return fmt.Sprintf("latency %.2f ms is above %.2f ms", result.Latency, s.latencyCeilingMs)
+	}
+	if result.Score < s.minScore {
+		return fmt.Sprintf("score %.1f is below %.1f", result.Score, s.minScore)
+	}
+	return ""
+}
+
+// Apply scores result and downgrades a completed result that misses the
+// score or latency threshold to unqualified. It returns why, or an empty
+// string if the result was not downgraded.
+func (s *Scorer) Apply(result *models.SpeedTestResult) string {
+	result.Score = s.Score(result)
+	if result.Status != models.StatusCompleted {
+		return ""
+	}
+
+	reason := s.Reject(result)
+	if reason != "" {
+		result.Status = models.StatusUnqualified
+	}
+	return reason
+}
+
+// Describe returns the thresholds besides bandwidth a result must meet, for
+// logs, or an empty string if there are none
+func (s *Scorer) Describe() string {
+	var parts []string
+	if s.minScore > 0 {
+		parts = append(parts, fmt.Sprintf("score >= %.1f", s.minScore))
+	}
+	if s.latencyCeilingMs > 0 {
+		parts = append(parts, fmt.Sprintf("latency <= %g ms", s.latencyCeilingMs))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dataCenterCode extracts the colo code from a friendly name such as
+// "Hong Kong (HKG)", or returns the name itself if it is a bare code
+func dataCenterCode(name string) string {
+	if open := strings.LastIndex(name, "("); open >= 0 && strings.HasSuffix(name, ")") {
+		name = name[open+1 : len(name)-1]
+	}
+	return strings.ToUpper(strings.TrimSpace(name))
+}
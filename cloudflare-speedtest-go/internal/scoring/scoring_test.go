@@ -0,0 +1,167 @@
+package scoring
+
+import (
+	"cloudflare-speedtest/internal/yamlconfig"
+	"cloudflare-speedtest/pkg/models"
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	speedOnly := yamlconfig.ScoringWeights{Speed: 1}
+	steady := &models.LatencyStats{Jitter: 20, Loss: 0}
+
+	tests := []struct {
+		name      string
+		weights   yamlconfig.ScoringWeights
+		preferred []string
+		bandwidth float64
+		result    models.SpeedTestResult
+		want      float64
+	}{
+		{
+			name:      "speed at the required bandwidth scores half",
+			weights:   speedOnly,
+			bandwidth: 50,
+			result:    models.SpeedTestResult{Speed: 50},
+			want:      50,
+		},
+		{
+			name:    "speed without a bandwidth is rated against 100 Mbps",
+			weights: speedOnly,
+			result:  models.SpeedTestResult{Speed: 300},
+			want:    75,
+		},
+		{
+			name:    "latency",
+			weights: yamlconfig.ScoringWeights{Latency: 1},
+			result:  models.SpeedTestResult{Speed: 1, Latency: 300},
+			want:    25,
+		},
+		{
+			name:    "jitter and loss count only with latency stats",
+			weights: yamlconfig.ScoringWeights{Speed: 1, Jitter: 3},
+			result:  models.SpeedTestResult{Speed: 100},
+			want:    50,
+		},
+		{
+			name:    "jitter and loss",
+			weights: yamlconfig.ScoringWeights{Jitter: 1, Loss: 1},
+			result:  models.SpeedTestResult{Speed: 1, LatencyStats: steady},
+			want:    75,
+		},
+		{
+			name:    "loss",
+			weights: yamlconfig.ScoringWeights{Loss: 1},
+			result:  models.SpeedTestResult{Speed: 1, LatencyStats: &models.LatencyStats{Loss: 40}},
+			want:    60,
+		},
+		{
+			name:      "preferred data center by friendly name",
+			weights:   yamlconfig.ScoringWeights{Speed: 1, DataCenter: 1},
+			preferred: []string{" hkg "},
+			result:    models.SpeedTestResult{Speed: 100, DataCenter: "Hong Kong (HKG)"},
+			want:      75,
+		},
+		{
+			name:      "other data center",
+			weights:   yamlconfig.ScoringWeights{Speed: 1, DataCenter: 1},
+			preferred: []string{"HKG"},
+			result:    models.SpeedTestResult{Speed: 100, DataCenter: "SJC"},
+			want:      25,
+		},
+		{
+			name:    "data center ignored without preferred ones",
+			weights: yamlconfig.ScoringWeights{Speed: 1, DataCenter: 1},
+			result:  models.SpeedTestResult{Speed: 100, DataCenter: "SJC"},
+			want:    50,
+		},
+		{
+			name:    "weighted average",
+			weights: yamlconfig.ScoringWeights{Speed: 3, Latency: 1},
+			result:  models.SpeedTestResult{Speed: 300, Latency: 100},
+			want:    (3*0.75 + 0.5) / 4 * 100,
+		},
+		{
+			name:    "no data",
+			weights: speedOnly,
+			result:  models.SpeedTestResult{Speed: 0, Latency: 10},
+			want:    0,
+		},
+		{
+			name:    "invalid",
+			weights: speedOnly,
+			result:  models.SpeedTestResult{Speed: 500, Status: models.StatusInvalid},
+			want:    0,
+		},
+		{
+			name:    "all weights zero",
+			weights: yamlconfig.ScoringWeights{},
+			result:  models.SpeedTestResult{Speed: 500},
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(yamlconfig.ScoringConfig{Weights: tt.weights, PreferredDataCenters: tt.preferred}, tt.bandwidth)
+			if got := s.Score(&tt.result); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	cfg := yamlconfig.ScoringConfig{
+		Weights:          yamlconfig.ScoringWeights{Speed: 1},
+		MinScore:         40,
+		LatencyCeilingMs: 150,
+	}
+
+	tests := []struct {
+		name       string
+		status     models.Status
+		speed      float64
+		latency    float64
+		wantStatus models.Status
+		wantReason string
+	}{
+		{"qualifies", models.StatusCompleted, 100, 80, models.StatusCompleted, ""},
+		{"latency at the ceiling", models.StatusCompleted, 100, 150, models.StatusCompleted, ""},
+		{"latency above the ceiling", models.StatusCompleted, 100, 150.5, models.StatusUnqualified, "latency 150.50 ms is above 150.00 ms"},
+		{"score below the minimum", models.StatusCompleted, 60, 80, models.StatusUnqualified, "score 37.5 is below 40.0"},
+		{"slow results keep their status", models.StatusSlow, 10, 900, models.StatusSlow, ""},
+	}
+
+	s := New(cfg, 100)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &models.SpeedTestResult{Status: tt.status, Speed: tt.speed, Latency: tt.latency}
+			reason := s.Apply(result)
+			if result.Status != tt.wantStatus || reason != tt.wantReason {
+				t.Errorf("Apply() = %q with status %s, want %q with status %s", reason, result.Status, tt.wantReason, tt.wantStatus)
+			}
+			if result.Score == 0 {
+				t.Error("Apply() did not set the score")
+			}
+		})
+	}
+
+	if got, want := s.Describe(), "score >= 40.0, latency <= 150 ms"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
+
+func TestDataCenterCode(t *testing.T) {
+	for name, want := range map[string]string{
+		"Hong Kong (HKG)":    "HKG",
+		"San Jose, CA (sjc)": "SJC",
+		" nrt ":              "NRT",
+		"Unknown (":          "UNKNOWN (",
+	} {
+		if got := dataCenterCode(name); got != want {
+			t.Errorf("dataCenterCode(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/engine"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+const subscriberBuffer = 64
+
+// eventHub fans out engine events to SSE subscribers
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan engine.Event]struct{}
+}
+
+// newEventHub creates an empty event hub
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan engine.Event]struct{}),
+	}
+}
+
+// subscribe registers a new subscriber channel
+func (h *eventHub) subscribe() chan engine.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan engine.Event, subscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes and closes a subscriber channel
+func (h *eventHub) unsubscribe(ch chan engine.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, exists := h.subscribers[ch]; exists {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish delivers an event to all subscribers. A subscriber whose buffer is
+// full is removed and closed instead of stalling the run, so its client
+// reconnects and catches up from the status event rather than silently
+// missing events such as run_finished.
+func (h *eventHub) publish(ev engine.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/engine"
+	"testing"
+)
+
+func TestEventHubDropsSlowSubscribers(t *testing.T) {
+	hub := newEventHub()
+	slow := hub.subscribe()
+	fast := hub.subscribe()
+
+	received := 0
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.publish(engine.Event{Type: engine.EventSpeedSample})
+		<-fast
+		received++
+	}
+	hub.publish(engine.Event{Type: engine.EventRunFinished})
+
+	if ev := <-fast; ev.Type != engine.EventRunFinished {
+		t.Errorf("fast subscriber got %s, want %s", ev.Type, engine.EventRunFinished)
+	}
+	if received != subscriberBuffer+1 {
+		t.Errorf("fast subscriber got %d samples, want %d", received, subscriberBuffer+1)
+	}
+
+	// The slow subscriber keeps its buffered events, then sees the close
+	for range subscriberBuffer {
+		if _, ok := <-slow; !ok {
+			t.Fatal("slow subscriber closed before its buffered events")
+		}
+	}
+	if _, ok := <-slow; ok {
+		t.Error("slow subscriber still open after its buffer overflowed")
+	}
+
+	// Unsubscribing a dropped subscriber is harmless
+	hub.unsubscribe(slow)
+	hub.unsubscribe(fast)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"cloudflare-speedtest/pkg/models"
 	"encoding/json"
 	"net/http"
 )
@@ -29,6 +30,11 @@ func (s *Server) getQueryParam(r *http.Request, key, defaultValue string) string
 	return defaultValue
 }
 
+// getLanguage returns the status label language from ?lang= or Accept-Language
+func (s *Server) getLanguage(r *http.Request) string {
+	return models.MatchLanguage(s.getQueryParam(r, "lang", r.Header.Get("Accept-Language")))
+}
+
 // indexHandler serves the main HTML page
 func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
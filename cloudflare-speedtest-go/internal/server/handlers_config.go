@@ -2,33 +2,33 @@ package server
 
 import (
 	"cloudflare-speedtest/internal/yamlconfig"
+	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-// getConfig returns the current configuration
+// getConfig returns the current configuration with its secrets redacted
 func (s *Server) getConfig(w http.ResponseWriter, r *http.Request) {
-	s.writeJSON(w, http.StatusOK, s.config)
+	s.writeJSON(w, http.StatusOK, s.config.Redacted())
 }
 
 // updateConfig updates the configuration in memory
 func (s *Server) updateConfig(w http.ResponseWriter, r *http.Request) {
-	var cfg yamlconfig.Config
-	if err := s.readJSON(r, &cfg); err != nil {
+	cfg, err := s.readConfigUpdate(r)
+	if err != nil {
 		fmt.Printf("JSON binding error: %v\n", err)
 		s.writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
 		return
 	}
 
-	fmt.Printf("Received config: %+v\n", cfg)
-
 	if err := cfg.Validate(); err != nil {
 		fmt.Printf("Validation error: %v\n", err)
 		s.writeError(w, http.StatusBadRequest, "Configuration validation failed: "+err.Error())
 		return
 	}
 
-	s.config = &cfg
+	s.config = cfg
+	s.applySchedule()
 	fmt.Println("Configuration updated successfully in memory")
 
 	s.writeJSON(w, http.StatusOK, map[string]string{"message": "config updated in memory"})
@@ -37,7 +37,6 @@ func (s *Server) updateConfig(w http.ResponseWriter, r *http.Request) {
 // saveConfig saves the configuration to file
 func (s *Server) saveConfig(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Saving config to file: %s\n", s.configPath)
-	fmt.Printf("Config to save: %+v\n", s.config)
 
 	if err := yamlconfig.SaveWithValidation(s.configPath, s.config); err != nil {
 		fmt.Printf("Save error: %v\n", err)
@@ -51,8 +50,8 @@ func (s *Server) saveConfig(w http.ResponseWriter, r *http.Request) {
 
 // validateConfig validates a configuration without saving it
 func (s *Server) validateConfig(w http.ResponseWriter, r *http.Request) {
-	var cfg yamlconfig.Config
-	if err := s.readJSON(r, &cfg); err != nil {
+	cfg, err := s.readConfigUpdate(r)
+	if err != nil {
 		s.writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
 		return
 	}
@@ -71,6 +70,16 @@ func (s *Server) validateConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// readConfigUpdate applies the configuration in the request body to the
+// current one. Commands and written files can only be set in the config file.
+func (s *Server) readConfigUpdate(r *http.Request) (*yamlconfig.Config, error) {
+	var data json.RawMessage
+	if err := s.readJSON(r, &data); err != nil {
+		return nil, err
+	}
+	return s.config.Update(data)
+}
+
 // getDataCenters returns all available data centers
 func (s *Server) getDataCenters(w http.ResponseWriter, r *http.Request) {
 	if !s.coloManager.HasColos() {
@@ -2,39 +2,95 @@ package server
 
 import (
 	"cloudflare-speedtest/internal/downloader"
+	"cloudflare-speedtest/internal/engine"
+	"cloudflare-speedtest/internal/history"
+	"cloudflare-speedtest/internal/usage"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 // startTest starts the speed test
 func (s *Server) startTest(w http.ResponseWriter, r *http.Request) {
-	s.testMu.Lock()
-	if s.testing {
-		s.testMu.Unlock()
-		s.writeError(w, http.StatusBadRequest, "test already running")
+	if err := s.startRun(engine.NewPlan(s.config), history.TriggerAPI); err != nil {
+		s.writeError(w, startRunStatus(err), err.Error())
 		return
 	}
-	s.testing = true
-	s.testMu.Unlock()
 
-	s.resultManager.Clear()
-	s.metrics.Reset()
-	s.metrics.RecordTestStart()
+	s.writeJSON(w, http.StatusOK, map[string]string{"message": "test started"})
+}
 
-	go s.runTest()
+// startRunStatus returns the HTTP status for an error starting a run
+func startRunStatus(err error) int {
+	switch {
+	case errors.Is(err, engine.ErrRunning):
+		return http.StatusBadRequest
+	case errors.Is(err, usage.ErrQuotaExceeded):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
 
-	s.writeJSON(w, http.StatusOK, map[string]string{"message": "test started"})
+// verifyTest starts a verify run that retests known IPs instead of discovering
+// new ones. The body may list the IPs as {"ips": [...]}; without it the
+// qualified IPs of the last run are retested.
+func (s *Server) verifyTest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IPs []string `json:"ips"`
+	}
+	if err := s.readJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
+
+	ips := req.IPs
+	if len(ips) == 0 {
+		var err error
+		if ips, err = s.lastQualifiedIPs(); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		seen := make(map[string]bool)
+		ips = make([]string, 0, len(req.IPs))
+		for _, value := range req.IPs {
+			ip := net.ParseIP(strings.TrimSpace(value))
+			if ip == nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP address: %q", value))
+				return
+			}
+			if !seen[ip.String()] {
+				seen[ip.String()] = true
+				ips = append(ips, ip.String())
+			}
+		}
+	}
+
+	plan := engine.NewPlan(s.config)
+	plan.VerifyIPs = ips
+
+	if err := s.startRun(plan, history.TriggerAPI); err != nil {
+		s.writeError(w, startRunStatus(err), err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"message": "verify started",
+		"ips":     ips,
+		"count":   len(ips),
+	})
 }
 
 // stopTest stops the speed test
 func (s *Server) stopTest(w http.ResponseWriter, r *http.Request) {
-	s.testMu.Lock()
-	s.testing = false
-	s.testMu.Unlock()
+	s.StopTest()
 
 	s.writeJSON(w, http.StatusOK, map[string]string{"message": "test stopped"})
 }
@@ -63,6 +119,38 @@ func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// getSchedule returns the scheduled testing settings and when the next run is due
+func (s *Server) getSchedule(w http.ResponseWriter, r *http.Request) {
+	var nextRun *time.Time
+	if next := s.scheduler.NextRun(); !next.IsZero() {
+		nextRun = &next
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"enabled":  s.config.Schedule.Enabled,
+		"cron":     s.config.Schedule.Cron,
+		"interval": s.config.Schedule.Interval,
+		"running":  s.scheduler.IsRunning(),
+		"next_run": nextRun,
+		"testing":  s.IsTesting(),
+	})
+}
+
+// getURLHealth returns the rotation strategy and the health of each test URL
+func (s *Server) getURLHealth(w http.ResponseWriter, r *http.Request) {
+	urlManager := s.engine.URLManager()
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"strategy": urlManager.GetStrategy(),
+		"active":   urlManager.ActiveCount(),
+		"urls":     urlManager.GetHealth(),
+	})
+}
+
+// getIPPoolHealth returns the health and learned subnet scores of the IP pools
+func (s *Server) getIPPoolHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.engine.IPReader().GetHealthStatus())
+}
+
 // updateData updates data files from upstream
 func (s *Server) updateData(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/engine"
+	"cloudflare-speedtest/pkg/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// localizedEvent encodes an event with status labels in the subscriber's language
+type localizedEvent struct {
+	engine.Event
+	Result *models.LocalizedResult `json:"result,omitempty"`
+}
+
+// localizeResult wraps an optional event result for encoding in lang
+func localizeResult(result *models.SpeedTestResult, lang string) *models.LocalizedResult {
+	if result == nil {
+		return nil
+	}
+	return &models.LocalizedResult{SpeedTestResult: result, Lang: lang}
+}
+
+// streamEvents streams live test progress as Server-Sent Events
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	lang := s.getLanguage(r)
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	// Tell new clients whether a run is already in progress
+	fmt.Fprintf(w, "event: status\ndata: {\"testing\":%t}\n\n", s.IsTesting())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				// Dropped for falling behind; the client reconnects
+				return
+			}
+			data, err := json.Marshal(localizedEvent{Event: ev, Result: localizeResult(ev.Result, lang)})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
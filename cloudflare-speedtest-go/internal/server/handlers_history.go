@@ -0,0 +1,87 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/history"
+	"cloudflare-speedtest/internal/resultmanager"
+	"cloudflare-speedtest/pkg/models"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// getRuns returns recorded runs, newest first
+func (s *Server) getRuns(w http.ResponseWriter, r *http.Request) {
+	if s.history == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "run history is not available")
+		return
+	}
+
+	limit, err := strconv.Atoi(s.getQueryParam(r, "limit", "50"))
+	if err != nil || limit < 0 {
+		limit = 50
+	}
+
+	runs, err := s.history.ListRuns(limit)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"runs":  runs,
+		"count": len(runs),
+	})
+}
+
+// getRunResults returns the stored results of a single run
+func (s *Server) getRunResults(w http.ResponseWriter, r *http.Request) {
+	if s.history == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "run history is not available")
+		return
+	}
+
+	runID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid run id")
+		return
+	}
+
+	run, err := s.history.GetRun(runID)
+	if err != nil {
+		s.writeHistoryError(w, err)
+		return
+	}
+
+	results, err := s.history.GetResults(runID)
+	if err != nil {
+		s.writeHistoryError(w, err)
+		return
+	}
+
+	sortBy := s.getQueryParam(r, "sort", "speed")
+	ascending := s.getQueryParam(r, "order", "desc") == "asc"
+
+	// Reuse the result manager's ordering for stored results
+	rm := resultmanager.New(len(results) + 1)
+	for _, result := range results {
+		rm.AddResultAllowDuplicate(result)
+	}
+	results = rm.GetSortedResults(sortBy, ascending)
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"run":       run,
+		"results":   models.Localize(results, s.getLanguage(r)),
+		"sort_by":   sortBy,
+		"ascending": ascending,
+		"count":     len(results),
+	})
+}
+
+// writeHistoryError maps history store errors to HTTP responses
+func (s *Server) writeHistoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, history.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.writeError(w, http.StatusInternalServerError, err.Error())
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,6 +16,19 @@ func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// prometheusMetrics exposes cumulative metrics in the Prometheus text format
+func (s *Server) prometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.config.Advanced.EnableMetrics {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.WritePrometheus(w); err != nil {
+		fmt.Printf("Failed to write Prometheus metrics: %v\n", err)
+	}
+}
+
 // getPerformanceStats returns performance statistics
 func (s *Server) getPerformanceStats(w http.ResponseWriter, r *http.Request) {
 	stats := s.metrics.GetPerformanceStats()
@@ -51,6 +65,7 @@ func (s *Server) getErrorStats(w http.ResponseWriter, r *http.Request) {
 	stats := s.errorHandler.GetErrorStats()
 	s.writeJSON(w, http.StatusOK, map[string]any{
 		"error_stats":   stats,
+		"error_rate":    s.errorHandler.ErrorRate(),
 		"degraded_mode": s.errorHandler.IsInDegradedMode(),
 	})
 }
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/notifier"
+	"context"
+	"net/http"
+	"time"
+)
+
+// testNotify sends a test message through every enabled notifier
+func (s *Server) testNotify(w http.ResponseWriter, r *http.Request) {
+	// Never run a command that did not come from the config file
+	if s.config.Notify.Exec.Enabled && !s.config.FileOnly().Equal(s.fileOnly) {
+		s.writeError(w, http.StatusForbidden, "the exec hook command can only be set in the config file")
+		return
+	}
+
+	n, err := notifier.New(s.config.Notify, s.dataDir)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	deliveries := n.Test(ctx)
+	status := http.StatusOK
+	for _, d := range deliveries {
+		if d.Error != "" {
+			status = http.StatusBadGateway
+		}
+	}
+	s.writeJSON(w, status, map[string]any{"deliveries": deliveries})
+}
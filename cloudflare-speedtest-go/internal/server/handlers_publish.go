@@ -0,0 +1,106 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/publisher"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// getPublish returns the publish settings and the last publish that can be rolled back
+func (s *Server) getPublish(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config.Publish
+	response := map[string]any{
+		"enabled":   cfg.Enabled,
+		"backend":   cfg.Backend,
+		"hostnames": cfg.Hostnames,
+		"top_n":     cfg.TopN,
+		"dry_run":   cfg.DryRun,
+		"last":      nil,
+	}
+
+	if pub, err := s.newPublisher(); err == nil {
+		if last, err := pub.LastPublish(); err == nil {
+			response["last"] = last
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// newPublisher creates a publisher for the current settings, writing only
+// the hosts file named in the config file
+func (s *Server) newPublisher() (*publisher.Publisher, error) {
+	cfg := s.config.Publish
+	cfg.Hosts.Path = s.fileOnly.HostsPath
+	return publisher.New(cfg, s.dataDir)
+}
+
+// publishResults points the configured hostnames at the best current results.
+// ?dry_run=true only reports the changes; it defaults to publish.dry_run.
+func (s *Server) publishResults(w http.ResponseWriter, r *http.Request) {
+	pub, err := s.newPublisher()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.IsTesting() {
+		s.writeError(w, http.StatusConflict, "cannot publish while a test is running")
+		return
+	}
+
+	report, err := pub.Publish(r.Context(), s.resultManager.GetSortedResults("speed", false), s.getDryRun(r))
+	if errors.Is(err, publisher.ErrNoResults) {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writePublishReport(w, report, err)
+}
+
+// rollbackPublish restores the records replaced by the last publish
+func (s *Server) rollbackPublish(w http.ResponseWriter, r *http.Request) {
+	pub, err := s.newPublisher()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := pub.Rollback(r.Context(), s.getDryRun(r))
+	if errors.Is(err, publisher.ErrNothingToRollback) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.writePublishReport(w, report, err)
+}
+
+// getDryRun reads ?dry_run=, falling back to publish.dry_run
+func (s *Server) getDryRun(r *http.Request) bool {
+	dryRun, err := strconv.ParseBool(s.getQueryParam(r, "dry_run", strconv.FormatBool(s.config.Publish.DryRun)))
+	if err != nil {
+		return true
+	}
+	return dryRun
+}
+
+// writePublishReport writes a publish or rollback report, including the
+// partial report if applying the changes failed part way
+func (s *Server) writePublishReport(w http.ResponseWriter, report *publisher.Report, err error) {
+	if err != nil {
+		s.metrics.RecordCounter("publish.failed", 1, nil)
+		if report == nil {
+			s.writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusBadGateway, map[string]any{
+			"error":  err.Error(),
+			"report": report,
+		})
+		return
+	}
+
+	if !report.DryRun {
+		s.metrics.RecordCounter("publish.succeeded", 1, nil)
+	}
+	s.writeJSON(w, http.StatusOK, report)
+}
@@ -1,16 +1,19 @@
 package server
 
 import (
+	"bytes"
 	"cloudflare-speedtest/internal/resultmanager"
+	"cloudflare-speedtest/pkg/models"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 // getResults returns all test results
 func (s *Server) getResults(w http.ResponseWriter, r *http.Request) {
 	results := s.resultManager.GetResults()
-	s.writeJSON(w, http.StatusOK, results)
+	s.writeJSON(w, http.StatusOK, models.Localize(results, s.getLanguage(r)))
 }
 
 // getSortedResults returns sorted test results
@@ -20,7 +23,7 @@ func (s *Server) getSortedResults(w http.ResponseWriter, r *http.Request) {
 
 	results := s.resultManager.GetSortedResults(sortBy, ascending)
 	s.writeJSON(w, http.StatusOK, map[string]any{
-		"results":   results,
+		"results":   models.Localize(results, s.getLanguage(r)),
 		"sort_by":   sortBy,
 		"ascending": ascending,
 		"count":     len(results),
@@ -31,11 +34,20 @@ func (s *Server) getSortedResults(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getQualifiedResults(w http.ResponseWriter, r *http.Request) {
 	results := s.resultManager.GetQualifiedResults()
 	s.writeJSON(w, http.StatusOK, map[string]any{
-		"results": results,
+		"results": models.Localize(results, s.getLanguage(r)),
 		"count":   len(results),
 	})
 }
 
+// bestIPContentTypes maps each best-IP export format to its content type
+var bestIPContentTypes = map[resultmanager.ExportFormat]string{
+	resultmanager.FormatHosts:   "text/plain",
+	resultmanager.FormatClash:   "application/yaml",
+	resultmanager.FormatSingBox: "application/json",
+	resultmanager.FormatXray:    "application/json",
+	resultmanager.FormatDnsmasq: "text/plain",
+}
+
 // exportResults exports results in specified format
 func (s *Server) exportResults(w http.ResponseWriter, r *http.Request) {
 	format := r.PathValue("format")
@@ -60,19 +72,52 @@ func (s *Server) exportResults(w http.ResponseWriter, r *http.Request) {
 		contentType = "text/plain"
 		filename = fmt.Sprintf("cloudflare-speedtest-%s.txt", time.Now().Format("20060102-150405"))
 	default:
-		s.writeError(w, http.StatusBadRequest, "Unsupported format. Use csv, json, or txt")
+		if resultmanager.IsBestIPFormat(resultmanager.ExportFormat(format)) {
+			s.exportBest(w, r, resultmanager.ExportFormat(format), sortBy, ascending)
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, "Unsupported format. Use csv, json, txt, hosts, clash, sing-box, xray or dnsmasq")
 		return
 	}
 
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
 
-	if err := s.resultManager.Export(w, exportFormat, sortBy, ascending); err != nil {
+	if err := s.resultManager.Export(w, exportFormat, sortBy, ascending, s.getLanguage(r)); err != nil {
 		s.writeError(w, http.StatusInternalServerError, "Failed to export results: "+err.Error())
 		return
 	}
 }
 
+// exportBest exports the best IPs as hosts, DNS or proxy configuration.
+// ?domain= and ?top_n= override export.domain and export.top_n.
+func (s *Server) exportBest(w http.ResponseWriter, r *http.Request, format resultmanager.ExportFormat, sortBy string, ascending bool) {
+	topN, err := strconv.Atoi(s.getQueryParam(r, "top_n", strconv.Itoa(s.config.Export.TopN)))
+	if err != nil || topN < 1 {
+		s.writeError(w, http.StatusBadRequest, "top_n must be a positive number")
+		return
+	}
+
+	opts := resultmanager.NewExportOptions(s.config.Export)
+	opts.Domain = s.getQueryParam(r, "domain", opts.Domain)
+	opts.TopN = topN
+	opts.SortBy = sortBy
+	opts.Ascending = ascending
+
+	// Render first so a missing domain or empty result set is reported as an error, not a download
+	var buf bytes.Buffer
+	if err := s.resultManager.ExportBest(&buf, format, opts); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to export results: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("cloudflare-speedtest-%s-%s.%s",
+		format, time.Now().Format("20060102-150405"), resultmanager.FileExtension(format))
+	w.Header().Set("Content-Type", bestIPContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
+
 // getStats returns test statistics
 func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
 	stats := s.resultManager.GetStats()
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"cloudflare-speedtest/internal/usage"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// usagePeriods is how many quota periods getUsage reports
+const usagePeriods = 12
+
+// getUsage returns the traffic of the current and past quota periods, of
+// each recorded day and of the last run, along with the monthly quota
+func (s *Server) getUsage(w http.ResponseWriter, r *http.Request) {
+	tracker := s.engine.Usage()
+	quota := s.config.Quota
+	now := time.Now()
+
+	current := tracker.Period(now, quota.ResetDay)
+	response := map[string]any{
+		"current_period":  current,
+		"periods":         tracker.Periods(now, quota.ResetDay, usagePeriods),
+		"days":            tracker.Days(),
+		"total":           tracker.Total(),
+		"last_run":        tracker.RunUsage(),
+		"quota_bytes":     quota.MonthlyBytes,
+		"reset_day":       quota.ResetDay,
+		"remaining_bytes": nil,
+		"quota_exceeded":  false,
+	}
+
+	if quota.MonthlyBytes > 0 {
+		response["remaining_bytes"] = max(0, quota.MonthlyBytes-current.Total())
+
+		// Also true when what is left would not cover an average run
+		if _, err := tracker.CheckQuota(now, quota.MonthlyBytes, quota.ResetDay); errors.Is(err, usage.ErrQuotaExceeded) {
+			response["quota_exceeded"] = true
+			response["reason"] = err.Error()
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
@@ -3,12 +3,16 @@ package server
 import (
 	"cloudflare-speedtest/internal/colomanager"
 	"cloudflare-speedtest/internal/downloader"
+	"cloudflare-speedtest/internal/engine"
 	"cloudflare-speedtest/internal/errorhandler"
+	"cloudflare-speedtest/internal/history"
 	"cloudflare-speedtest/internal/metrics"
 	"cloudflare-speedtest/internal/resultmanager"
+	"cloudflare-speedtest/internal/scheduler"
 	"cloudflare-speedtest/internal/tester"
 	"cloudflare-speedtest/internal/urlmanager"
 	"cloudflare-speedtest/internal/yamlconfig"
+	"context"
 	"embed"
 	"fmt"
 	"html/template"
@@ -22,16 +26,21 @@ import (
 type Server struct {
 	mux           *http.ServeMux
 	config        *yamlconfig.Config
+	fileOnly      yamlconfig.FileOnlySettings // As read from the config file
 	resultManager *resultmanager.ResultManager
 	errorHandler  *errorhandler.ErrorHandler
 	metrics       *metrics.Metrics
 	mu            sync.RWMutex
 	testing       bool
+	cancelTest    context.CancelFunc
 	testMu        sync.RWMutex
+	engine        *engine.Engine
+	events        *eventHub
+	history       *history.Store
+	scheduler     *scheduler.Scheduler
+	schedule      yamlconfig.ScheduleConfig // Schedule the scheduler was last started with
 	downloader    *downloader.Downloader
-	urlManager    *urlmanager.URLManager
 	coloManager   *colomanager.ColoManager
-	ipReader      *tester.IPReader
 	dataDir       string
 	configPath    string
 	staticFS      embed.FS
@@ -50,28 +59,55 @@ func New(cfg *yamlconfig.Config, dataDir string, configPath string, staticFS emb
 	coloManager := colomanager.New(dataDir)
 
 	// Create enhanced downloader with cache
+	// Probes, speed tests and data file downloads share one error handler so
+	// /api/errors/stats and degraded mode see all of their failures
+	errorHandler := errorhandler.New()
+
 	downloader := downloader.New()
+	downloader.SetErrorHandler(errorHandler)
 	cacheDir := filepath.Join(dataDir, "cache")
 	if err := downloader.SetCacheDir(cacheDir); err != nil {
 		fmt.Printf("Warning: Failed to set cache directory: %v\n", err)
 	}
 
+	// The engine shares result storage and metrics with the HTTP handlers
+	resultManager := resultmanager.New(1000)
+	metrics := metrics.New()
+	testEngine := engine.New(dataDir, engine.Components{
+		ResultManager: resultManager,
+		Metrics:       metrics,
+		ColoManager:   coloManager,
+		URLManager:    urlmanager.New(dataDir),
+		IPReader:      tester.NewIPReader(dataDir),
+		ErrorHandler:  errorHandler,
+	})
+
+	historyStore, err := history.Open(filepath.Join(dataDir, "history.db"))
+	if err != nil {
+		fmt.Printf("Warning: Run history disabled: %v\n", err)
+	}
+
 	s := &Server{
 		mux:           http.NewServeMux(),
 		config:        cfg,
-		resultManager: resultmanager.New(1000),
-		errorHandler:  errorhandler.New(),
-		metrics:       metrics.New(),
+		fileOnly:      cfg.FileOnly(),
+		resultManager: resultManager,
+		errorHandler:  errorHandler,
+		metrics:       metrics,
+		engine:        testEngine,
+		events:        newEventHub(),
+		history:       historyStore,
 		downloader:    downloader,
-		urlManager:    urlmanager.New(dataDir),
 		coloManager:   coloManager,
-		ipReader:      tester.NewIPReader(dataDir),
 		dataDir:       dataDir,
 		configPath:    configPath,
 		staticFS:      staticFS,
 		templates:     tmpl,
 	}
 
+	s.scheduler = scheduler.New(s.runScheduled)
+	s.applySchedule()
+
 	s.setupRoutes()
 	return s
 }
@@ -125,11 +161,24 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("GET /api/metrics/speed/smoothed", s.getSmoothedSpeed)
 	s.mux.HandleFunc("GET /api/metrics/speed/samples", s.getSpeedSamples)
 	s.mux.HandleFunc("GET /api/errors/stats", s.getErrorStats)
+	s.mux.HandleFunc("GET /metrics", s.prometheusMetrics)
 	s.mux.HandleFunc("POST /api/start", s.startTest)
+	s.mux.HandleFunc("POST /api/verify", s.verifyTest)
 	s.mux.HandleFunc("POST /api/stop", s.stopTest)
 	s.mux.HandleFunc("DELETE /api/results", s.clearResults)
 	s.mux.HandleFunc("POST /api/update", s.updateData)
 	s.mux.HandleFunc("GET /api/status", s.getStatus)
+	s.mux.HandleFunc("GET /api/schedule", s.getSchedule)
+	s.mux.HandleFunc("GET /api/events", s.streamEvents)
+	s.mux.HandleFunc("GET /api/urls", s.getURLHealth)
+	s.mux.HandleFunc("GET /api/ippool", s.getIPPoolHealth)
+	s.mux.HandleFunc("GET /api/publish", s.getPublish)
+	s.mux.HandleFunc("POST /api/publish", s.publishResults)
+	s.mux.HandleFunc("POST /api/publish/rollback", s.rollbackPublish)
+	s.mux.HandleFunc("POST /api/notify/test", s.testNotify)
+	s.mux.HandleFunc("GET /api/runs", s.getRuns)
+	s.mux.HandleFunc("GET /api/runs/{id}/results", s.getRunResults)
+	s.mux.HandleFunc("GET /api/usage", s.getUsage)
 
 	// HTML routes
 	s.mux.HandleFunc("GET /", s.indexHandler)
@@ -176,6 +225,16 @@ func (s *Server) IsTesting() bool {
 	return s.testing
 }
 
+// StopTest cancels the running test, if any
+func (s *Server) StopTest() {
+	s.testMu.Lock()
+	defer s.testMu.Unlock()
+
+	if s.cancelTest != nil {
+		s.cancelTest()
+	}
+}
+
 // Run starts the HTTP server
 func (s *Server) Run(addr string) error {
 	return http.ListenAndServe(addr, s.mux)
@@ -1,344 +1,219 @@
 package server
 
 import (
-	"cloudflare-speedtest/internal/tester"
+	"cloudflare-speedtest/internal/engine"
+	"cloudflare-speedtest/internal/history"
+	"cloudflare-speedtest/internal/notifier"
+	"cloudflare-speedtest/internal/scheduler"
+	"cloudflare-speedtest/internal/usage"
 	"cloudflare-speedtest/pkg/models"
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
-	"strings"
-	"sync"
 	"time"
 )
 
-// runTest runs the two-phase speed test
-func (s *Server) runTest() {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Test panic: %v\n", r)
-		}
-		s.testMu.Lock()
-		s.testing = false
-		s.testMu.Unlock()
-
-		fmt.Println("Test execution completed, testing flag set to false")
-	}()
+// startRun starts a test run of plan on the engine and consumes its events in the
+// background. trigger records what started the run, one of the history.Trigger constants.
+func (s *Server) startRun(plan engine.Plan, trigger string) error {
+	s.testMu.Lock()
+	defer s.testMu.Unlock()
 
-	fmt.Println("Starting runTest function")
-
-	if !s.urlManager.HasURLs() {
-		fmt.Println("Loading URLs...")
-		if err := s.urlManager.LoadURLs(); err != nil {
-			fmt.Printf("Failed to load URLs: %v\n", err)
-			return
-		}
+	if s.testing {
+		return engine.ErrRunning
 	}
 
-	if !s.coloManager.HasColos() {
-		fmt.Println("Loading data centers...")
-		if err := s.coloManager.LoadColos(); err != nil {
-			fmt.Printf("Failed to load data centers: %v\n", err)
-			return
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := s.engine.Run(ctx, plan)
+	if err != nil {
+		cancel()
+		return err
 	}
 
-	urls := s.urlManager.GetURLs()
-	if len(urls) == 0 {
-		fmt.Println("No URLs available for testing")
-		return
-	}
+	s.testing = true
+	s.cancelTest = cancel
 
-	url := urls[0]
-	fmt.Printf("Using URL: %s\n", url)
-
-	url, _ = strings.CutPrefix(url, "http://")
-	url, _ = strings.CutPrefix(url, "https://")
-
-	parts := strings.SplitN(url, "/", 2)
-	domain := parts[0]
-	filePath := ""
-	if len(parts) > 1 {
-		filePath = parts[1]
-	}
-
-	fmt.Printf("Domain: %s, FilePath: %s\n", domain, filePath)
-	fmt.Printf("Data center filter mode: %s\n", s.coloManager.GetFilterMode())
-	if s.coloManager.GetFilterMode() == "selected" {
-		fmt.Printf("Selected data centers: %v\n", s.coloManager.GetSelectedDataCenters())
-	}
-
-	expectedServers := s.config.Test.ExpectedServers
-	expectedBandwidth := s.config.Test.Bandwidth
-	fmt.Printf("Target: %d servers with speed >= %.2f Mbps\n", expectedServers, expectedBandwidth)
-
-	totalIPsTested := 0
-	batchNumber := 0
-
-	for {
-		s.testMu.RLock()
-		if !s.testing {
-			s.testMu.RUnlock()
-			fmt.Println("Testing stopped by user")
-			return
-		}
-		s.testMu.RUnlock()
-
-		batchNumber++
-		fmt.Printf("\n=== Batch %d: Reading IPs ===\n", batchNumber)
-
-		fmt.Printf("Reading IPs from %s...\n", s.config.Test.IPType)
-		ips, err := s.ipReader.ReadIPs(s.config.Test.IPType, 100)
+	var runID uint64
+	if s.history != nil {
+		run, err := s.history.StartRun(s.config, s.coloManager.GetSelectedDataCenters(), trigger)
 		if err != nil {
-			fmt.Printf("Failed to read IPs: %v\n", err)
-			break
-		}
-
-		if len(ips) == 0 {
-			fmt.Println("No more IPs available for testing")
-			break
+			fmt.Printf("Warning: Failed to record run: %v\n", err)
+		} else {
+			runID = run.ID
 		}
+	}
 
-		totalIPsTested += len(ips)
-		fmt.Printf("Batch %d: Read %d IPs (total tested so far: %d)\n", batchNumber, len(ips), totalIPsTested)
-
-		s.resultManager.SetTotal(totalIPsTested)
-
-		fmt.Printf("\n=== Batch %d - Phase 1: Concurrent Datacenter Detection ===\n", batchNumber)
-		validIPs := s.runDataCenterPhase(ips, domain, filePath)
+	go s.runTest(events, runID)
+	return nil
+}
 
-		if len(validIPs) == 0 {
-			fmt.Printf("Batch %d: No valid IPs found after datacenter filtering\n", batchNumber)
-			continue
+// runTest logs, broadcasts and persists the events of a run until it finishes.
+// A zero runID means the run is not recorded in the history.
+func (s *Server) runTest(events <-chan engine.Event, runID uint64) {
+	defer func() {
+		s.testMu.Lock()
+		s.testing = false
+		if s.cancelTest != nil {
+			s.cancelTest()
+			s.cancelTest = nil
 		}
+		s.testMu.Unlock()
 
-		fmt.Printf("Batch %d - Phase 1 completed: %d valid IPs found\n", batchNumber, len(validIPs))
-
-		fmt.Printf("\n=== Batch %d - Phase 2: Serial Speed Testing ===\n", batchNumber)
-		s.runSpeedTestPhase(validIPs, domain, filePath)
+		fmt.Println("Test execution completed, testing flag set to false")
+	}()
 
-		qualifiedResults := s.resultManager.GetQualifiedResults()
-		qualifiedCount := 0
+	var summary *engine.Summary
+	for ev := range events {
+		if ev.Type == engine.EventRunFinished {
+			summary = ev.Summary
+		}
 
-		for _, r := range qualifiedResults {
-			speedVal, err := strconv.ParseFloat(r.Speed, 64)
-			if err == nil && speedVal >= expectedBandwidth {
-				qualifiedCount++
+		s.events.publish(ev)
+		if runID != 0 {
+			if err := s.history.Record(runID, ev); err != nil {
+				fmt.Printf("Warning: Failed to record %s event: %v\n", ev.Type, err)
 			}
 		}
-
-		fmt.Printf("\nCurrent progress: %d servers with speed >= %.2f Mbps (need %d)\n",
-			qualifiedCount, expectedBandwidth, expectedServers)
-
-		if qualifiedCount >= expectedServers {
-			fmt.Printf("\n✓ Found %d qualified servers (speed >= %.2f Mbps). Expected: %d. Test completed.\n",
-				qualifiedCount, expectedBandwidth, expectedServers)
-
-			stats := s.resultManager.GetStats()
-			s.resultManager.SetTotal(stats.Completed)
-
-			break
+		if ev.Type != engine.EventSpeedSample {
+			fmt.Println(ev)
 		}
+	}
 
-		fmt.Printf("Batch %d completed. Need more qualified servers, reading next batch...\n", batchNumber)
+	// Publish while the testing flag is still set so a new run cannot
+	// clear the results underneath
+	if summary != nil && s.config.Publish.Enabled &&
+		(summary.Reason == engine.ReasonCompleted || summary.Reason == engine.ReasonVerified) {
+		s.autoPublish()
 	}
 
-	fmt.Println("Two-phase speed test completed")
+	// Notifications may be retried for minutes; send them without holding up the next run
+	if summary != nil {
+		go s.notify(summary, s.resultManager.GetSortedResults("speed", false))
+	}
 }
 
-// runDataCenterPhase runs the concurrent datacenter detection phase
-func (s *Server) runDataCenterPhase(ips []string, domain, filePath string) []string {
-	fmt.Printf("Starting datacenter detection for %d IPs using %d workers\n", len(ips), s.config.Advanced.ConcurrentWorkers)
-
-	enhancedTester := tester.NewEnhanced(s.config.Test.Timeout)
-	enhancedTester.SetConfig(domain, filePath, float64(s.config.Test.DownloadTime))
-
-	type DataCenterResult struct {
-		IP         string
-		DataCenter string
-		Latency    float64
-		Error      error
+// notify sends the notifications for a finished run through the enabled notifiers
+func (s *Server) notify(summary *engine.Summary, results []*models.SpeedTestResult) {
+	n, err := notifier.New(s.config.Notify, s.dataDir)
+	if errors.Is(err, notifier.ErrNoNotifiers) {
+		return
 	}
-
-	resultChan := make(chan DataCenterResult, len(ips))
-	semaphore := make(chan struct{}, s.config.Advanced.ConcurrentWorkers)
-
-	var wg sync.WaitGroup
-	for _, ip := range ips {
-		s.testMu.RLock()
-		if !s.testing {
-			s.testMu.RUnlock()
-			break
-		}
-		s.testMu.RUnlock()
-
-		wg.Add(1)
-		go func(testIP string) {
-			defer wg.Done()
-
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			fmt.Printf("Testing datacenter for IP: %s\n", testIP)
-			datacenter, latency, err := enhancedTester.TestDataCenterOnly(testIP, s.config.Test.UseTLS, s.config.Test.Timeout)
-
-			resultChan <- DataCenterResult{
-				IP:         testIP,
-				DataCenter: datacenter,
-				Latency:    latency,
-				Error:      err,
-			}
-		}(ip)
+	if err != nil {
+		fmt.Printf("Warning: Notifications skipped: %v\n", err)
+		return
 	}
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	validIPs := make([]string, 0)
-	testedCount := 0
-	filteredCount := 0
-
-	for result := range resultChan {
-		testedCount++
-
-		if result.Error != nil {
-			fmt.Printf("Datacenter test failed for %s: %v\n", result.IP, result.Error)
-			continue
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
 
-		if result.DataCenter == "" {
-			fmt.Printf("No datacenter info found for %s\n", result.IP)
-			continue
-		}
+	s.recordDeliveries(n.Notify(ctx, summary, results))
+}
 
-		if !s.coloManager.FilterByDataCenter(result.DataCenter) {
-			fmt.Printf("IP %s filtered out (datacenter: %s not in selected list)\n", result.IP, result.DataCenter)
-			filteredCount++
+// recordDeliveries logs failed notifications and counts every delivery
+func (s *Server) recordDeliveries(deliveries []notifier.Delivery) {
+	for _, d := range deliveries {
+		tags := map[string]string{"channel": d.Channel}
+		if d.Error != "" {
+			fmt.Printf("Warning: %s notification via %s failed after %d attempts: %s\n", d.Event, d.Channel, d.Attempts, d.Error)
+			s.metrics.RecordCounter("notify.failed", 1, tags)
 			continue
 		}
+		fmt.Printf("Sent %s notification via %s\n", d.Event, d.Channel)
+		s.metrics.RecordCounter("notify.sent", 1, tags)
+	}
+}
 
-		fmt.Printf("Valid IP found: %s (datacenter: %s, latency: %.2f ms)\n", result.IP, result.DataCenter, result.Latency)
-		validIPs = append(validIPs, result.IP)
+// autoPublish points the configured hostnames at the best results of the finished run
+func (s *Server) autoPublish() {
+	pub, err := s.newPublisher()
+	if err != nil {
+		fmt.Printf("Warning: Publishing skipped: %v\n", err)
+		return
 	}
 
-	fmt.Printf("Datacenter phase summary: Tested=%d, Filtered=%d, Valid=%d\n", testedCount, filteredCount, len(validIPs))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
 
-	if len(validIPs) == 0 && filteredCount > 0 {
-		fmt.Printf("WARNING: All %d IPs were filtered out due to datacenter selection. No IPs match the selected datacenters.\n", filteredCount)
+	report, err := pub.Publish(ctx, s.resultManager.GetSortedResults("speed", false), s.config.Publish.DryRun)
+	if err != nil {
+		fmt.Printf("Warning: Publishing failed: %v\n", err)
+		s.metrics.RecordCounter("publish.failed", 1, nil)
+		return
 	}
 
-	return validIPs
+	if !report.DryRun {
+		s.metrics.RecordCounter("publish.succeeded", 1, nil)
+	}
+	for _, line := range report.Lines() {
+		fmt.Println(line)
+	}
 }
 
-// runSpeedTestPhase runs the serial speed testing phase
-func (s *Server) runSpeedTestPhase(validIPs []string, domain, filePath string) {
-	fmt.Printf("Starting serial speed testing for %d valid IPs\n", len(validIPs))
-
-	enhancedTester := tester.NewEnhanced(s.config.Test.Timeout)
-	enhancedTester.SetConfig(domain, filePath, float64(s.config.Test.DownloadTime))
-
-	expectedBandwidth := s.config.Test.Bandwidth
-
-	for i, ip := range validIPs {
-		s.testMu.RLock()
-		if !s.testing {
-			s.testMu.RUnlock()
-			fmt.Println("Speed testing stopped by user")
-			break
-		}
-		s.testMu.RUnlock()
-
-		fmt.Printf("Speed testing IP %d/%d: %s\n", i+1, len(validIPs), ip)
-
-		s.resultManager.UpdateCurrentTest(ip, "")
-
-		datacenter, latency, err := enhancedTester.TestDataCenterOnly(ip, s.config.Test.UseTLS, s.config.Test.Timeout)
-		if err != nil {
-			fmt.Printf("Failed to get datacenter info for %s: %v\n", ip, err)
-			continue
-		}
-
-		speedResult, err := enhancedTester.TestSpeedOnly(ip, s.config.Test.UseTLS, s.config.Test.Timeout, float64(s.config.Test.DownloadTime))
-		if err != nil {
-			fmt.Printf("Speed test failed for %s: %v\n", ip, err)
-
-			result := &models.SpeedTestResult{
-				IP:         ip,
-				Status:     "无效",
-				Latency:    fmt.Sprintf("%.2f", latency),
-				Speed:      "timeout",
-				DataCenter: s.coloManager.GetFriendlyName(datacenter),
-				PeakSpeed:  0,
-			}
-
-			s.storeResult(result)
-			continue
-		}
-
-		speedVal, _ := strconv.ParseFloat(speedResult.Speed, 64)
-		if expectedBandwidth > 0 && speedVal < expectedBandwidth {
-			speedResult.Status = "低速"
+// runScheduled starts a run when the schedule fires, skipping it if a run is
+// already in progress or the monthly quota is used up
+func (s *Server) runScheduled() {
+	if err := s.startRun(engine.NewPlan(s.config), history.TriggerSchedule); err != nil {
+		if errors.Is(err, engine.ErrRunning) {
+			fmt.Println("Scheduled run skipped: a test is already running")
+			s.metrics.RecordCounter("schedule.skipped", 1, nil)
+			return
 		}
-
-		result := &models.SpeedTestResult{
-			IP:         ip,
-			Status:     speedResult.Status,
-			Latency:    fmt.Sprintf("%.2f", latency),
-			Speed:      speedResult.Speed,
-			DataCenter: s.coloManager.GetFriendlyName(datacenter),
-			PeakSpeed:  speedResult.PeakSpeed,
+		if errors.Is(err, usage.ErrQuotaExceeded) {
+			fmt.Printf("Scheduled run skipped: %v\n", err)
+			s.metrics.RecordCounter("schedule.over_quota", 1, nil)
+			return
 		}
+		fmt.Printf("Scheduled run failed to start: %v\n", err)
+		s.metrics.RecordCounter("schedule.failed", 1, nil)
+		return
+	}
 
-		s.storeResult(result)
-
-		s.resultManager.UpdateCurrentTest(result.IP, result.Speed)
-
-		fmt.Printf("Speed test completed for %s: Status=%s, Speed=%s Mbps, Latency=%s ms, DataCenter=%s\n",
-			ip, result.Status, result.Speed, result.Latency, result.DataCenter)
-
-		time.Sleep(100 * time.Millisecond)
+	fmt.Printf("Scheduled run started, next run at %s\n", s.scheduler.NextRun().Format(time.RFC3339))
+	s.metrics.RecordCounter("schedule.started", 1, nil)
+}
 
-		qualifiedResults := s.resultManager.GetQualifiedResults()
-		qualifiedCount := 0
+// applySchedule starts, restarts or stops the scheduler to match the
+// current configuration. An unchanged schedule keeps its timer running.
+func (s *Server) applySchedule() {
+	cfg := s.config.Schedule
+	if cfg == s.schedule && cfg.Enabled == s.scheduler.IsRunning() {
+		return
+	}
+	s.schedule = cfg
 
-		for _, r := range qualifiedResults {
-			speedVal, err := strconv.ParseFloat(r.Speed, 64)
-			if err == nil && speedVal >= expectedBandwidth {
-				qualifiedCount++
-			}
+	if !cfg.Enabled {
+		if s.scheduler.IsRunning() {
+			s.scheduler.Stop()
+			fmt.Println("Scheduled testing disabled")
 		}
+		return
+	}
 
-		if qualifiedCount >= s.config.Test.ExpectedServers {
-			fmt.Printf("\nFound %d qualified servers (speed >= %.2f Mbps). Expected: %d. Stopping speed test phase.\n",
-				qualifiedCount, expectedBandwidth, s.config.Test.ExpectedServers)
-			break
-		}
+	schedule, err := scheduler.Parse(cfg.Cron, cfg.Interval)
+	if err != nil {
+		fmt.Printf("Warning: Scheduled testing disabled: %v\n", err)
+		s.scheduler.Stop()
+		return
 	}
 
-	s.resultManager.UpdateCurrentTest("", "")
+	s.scheduler.Start(schedule)
+	fmt.Printf("Scheduled testing enabled, next run at %s\n", s.scheduler.NextRun().Format(time.RFC3339))
 }
 
-// storeResult stores a test result using ResultManager and updates metrics
-func (s *Server) storeResult(result *models.SpeedTestResult) {
-	s.resultManager.AddResultAllowDuplicate(result)
-
-	if result.Status == "已完成" {
-		s.resultManager.UpdateCurrentTest(result.IP, result.Speed)
-
-		speed, _ := strconv.ParseFloat(result.Speed, 64)
-		latency, _ := strconv.ParseFloat(result.Latency, 64)
+// lastQualifiedIPs returns the IPs that qualified in the last run: the results
+// still in memory if there are any, otherwise the newest run in the history
+func (s *Server) lastQualifiedIPs() ([]string, error) {
+	if ips := engine.QualifiedIPs(s.resultManager.GetResults(), s.config.Test.Bandwidth); len(ips) > 0 {
+		return ips, nil
+	}
 
-		s.metrics.RecordSpeedSample(speed, 0, 0)
-		s.metrics.RecordLatencySample(latency)
-		s.metrics.RecordTestComplete(true)
+	if s.history == nil {
+		return nil, fmt.Errorf("no qualified results to verify")
+	}
 
-		s.metrics.RecordCounter("tests.successful", 1, map[string]string{
-			"datacenter": result.DataCenter,
-		})
-	} else {
-		s.metrics.RecordTestComplete(false)
-		s.metrics.RecordCounter("tests.failed", 1, map[string]string{
-			"status": result.Status,
-		})
+	_, ips, err := s.history.LatestQualifiedIPs()
+	if err != nil {
+		return nil, fmt.Errorf("no qualified results to verify: %w", err)
 	}
+	return ips, nil
 }
@@ -1,8 +1,12 @@
 package tester
 
 import (
+	"cloudflare-speedtest/internal/errorhandler"
+	"cloudflare-speedtest/internal/usage"
 	"cloudflare-speedtest/pkg/models"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -20,6 +24,15 @@ type SpeedSample struct {
 	Duration  float64   `json:"duration"` // Duration in seconds
 }
 
+// StatusError is returned when a download request is answered with a non-200 status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
 // EnhancedSpeedTester provides advanced speed testing with sliding window algorithm
 type EnhancedSpeedTester struct {
 	client     *http.Client
@@ -28,7 +41,11 @@ type EnhancedSpeedTester struct {
 	timeout    time.Duration
 	sampleRate time.Duration // How often to take samples
 	windowSize int           // Number of samples in sliding window
-	mu         sync.Mutex    // Protect concurrent access
+	onSample   func(SpeedSample)
+	onTraffic  func(usage.Kind, int64)
+	retryCtx   context.Context
+	errHandler *errorhandler.ErrorHandler // Nil disables retries
+	mu         sync.Mutex                 // Protect concurrent access
 }
 
 // NewEnhanced creates a new enhanced speed tester
@@ -49,8 +66,75 @@ func (est *EnhancedSpeedTester) SetConfig(domain, filePath string, downloadTime
 	est.filePath = filePath
 }
 
-// TestDataCenterOnly tests only the data center information (for concurrent phase)
+// SetSampleCallback registers a function called with each windowed speed
+// sample taken during a download. Pass nil to disable.
+func (est *EnhancedSpeedTester) SetSampleCallback(fn func(SpeedSample)) {
+	est.mu.Lock()
+	defer est.mu.Unlock()
+
+	est.onSample = fn
+}
+
+// SetTrafficCounter registers a function called with the bytes each probe and
+// download sends and receives. Pass nil to disable.
+func (est *EnhancedSpeedTester) SetTrafficCounter(fn func(kind usage.Kind, bytes int64)) {
+	est.mu.Lock()
+	defer est.mu.Unlock()
+
+	est.onTraffic = fn
+}
+
+// SetRetry makes failed probes and downloads retry with the policies of eh,
+// until ctx is cancelled. Pass a nil eh to disable retries.
+func (est *EnhancedSpeedTester) SetRetry(ctx context.Context, eh *errorhandler.ErrorHandler) {
+	est.mu.Lock()
+	defer est.mu.Unlock()
+
+	est.retryCtx = ctx
+	est.errHandler = eh
+}
+
+// retry runs fn through the error handler, or once if retries are disabled
+func (est *EnhancedSpeedTester) retry(operation, ip string, fn func() error) error {
+	est.mu.Lock()
+	ctx, eh := est.retryCtx, est.errHandler
+	est.mu.Unlock()
+
+	if eh == nil {
+		return fn()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return eh.Retry(ctx, "tester", operation, ip, fn)
+}
+
+// notifySample passes a sample to the registered callback, if any
+func (est *EnhancedSpeedTester) notifySample(sample SpeedSample) {
+	est.mu.Lock()
+	fn := est.onSample
+	est.mu.Unlock()
+
+	if fn != nil {
+		fn(sample)
+	}
+}
+
+// TestDataCenterOnly tests only the data center information (for concurrent phase).
+// Failures that may be transient are retried; unreachable IPs are not.
 func (est *EnhancedSpeedTester) TestDataCenterOnly(ip string, useTLS bool, timeout int) (string, float64, error) {
+	var datacenter string
+	latency := -1.0
+	err := est.retry("datacenter_probe", ip, func() error {
+		var err error
+		datacenter, latency, err = est.probeDataCenter(ip, useTLS, timeout)
+		return err
+	})
+	return datacenter, latency, err
+}
+
+// probeDataCenter reads the data center from /cdn-cgi/trace once, classifying failures
+func (est *EnhancedSpeedTester) probeDataCenter(ip string, useTLS bool, timeout int) (string, float64, error) {
 	protocol := "http"
 	port := "80"
 	if useTLS {
@@ -68,7 +152,7 @@ func (est *EnhancedSpeedTester) TestDataCenterOnly(ip string, useTLS bool, timeo
 	start := time.Now()
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to create request: %w", err)
+		return "", -1, errorhandler.Classify(errorhandler.ErrorTypeValidation, false, fmt.Errorf("failed to create request: %w", err))
 	}
 
 	req.Host = est.domain
@@ -77,22 +161,24 @@ func (est *EnhancedSpeedTester) TestDataCenterOnly(ip string, useTLS bool, timeo
 	req.Header.Set("Accept", "*/*")
 	req.Header.Set("Cache-Control", "no-cache")
 
-	client := est.createHTTPClient(useTLS, timeout, timeout)
+	client := est.createHTTPClient(usage.KindProbe, useTLS, timeout, timeout)
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to get datacenter info: %w", err)
+		// An IP that refuses or never answers the connection is not worth retrying
+		return "", -1, errorhandler.Classify(errorhandler.ErrorTypeDataCenter, !isDialError(err), fmt.Errorf("failed to get datacenter info: %w", err))
 	}
 	defer resp.Body.Close()
 
 	latency := time.Since(start).Seconds() * 1000 // Convert to milliseconds
 
 	if resp.StatusCode != 200 {
-		return "", latency, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", latency, errorhandler.Classify(errorhandler.ErrorTypeDataCenter, isTransientStatus(resp.StatusCode),
+			fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", latency, fmt.Errorf("failed to read response: %w", err)
+		return "", latency, errorhandler.Classify(errorhandler.ErrorTypeDataCenter, true, fmt.Errorf("failed to read response: %w", err))
 	}
 
 	// Parse response to find colo
@@ -108,11 +194,24 @@ func (est *EnhancedSpeedTester) TestDataCenterOnly(ip string, useTLS bool, timeo
 		}
 	}
 
-	return "", latency, fmt.Errorf("no datacenter info found")
+	return "", latency, errorhandler.Classify(errorhandler.ErrorTypeValidation, false, fmt.Errorf("no datacenter info found"))
 }
 
-// TestSpeedOnly tests only the download speed (for serial phase)
-func (est *EnhancedSpeedTester) TestSpeedOnly(ip string, useTLS bool, timeout int, downloadTime float64) (*models.SpeedTestResult, error) {
+// TestSpeedOnly tests only the download speed (for serial phase).
+// Interrupted downloads are retried; HTTP error statuses are returned at once
+// so the caller can switch URLs. Cancelling ctx aborts the download.
+func (est *EnhancedSpeedTester) TestSpeedOnly(ctx context.Context, ip string, useTLS bool, timeout int, downloadTime float64) (*models.SpeedTestResult, error) {
+	var result *models.SpeedTestResult
+	err := est.retry("speed_test", ip, func() error {
+		var err error
+		result, err = est.downloadSpeed(ctx, ip, useTLS, timeout, downloadTime)
+		return err
+	})
+	return result, err
+}
+
+// downloadSpeed measures the download speed once, classifying failures
+func (est *EnhancedSpeedTester) downloadSpeed(ctx context.Context, ip string, useTLS bool, timeout int, downloadTime float64) (*models.SpeedTestResult, error) {
 	protocol := "http"
 	port := "80"
 	if useTLS {
@@ -127,37 +226,47 @@ func (est *EnhancedSpeedTester) TestSpeedOnly(ip string, useTLS bool, timeout in
 
 	url := fmt.Sprintf("%s://%s:%s/%s", protocol, ip, port, est.filePath)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create download request: %w", err)
+		return nil, errorhandler.Classify(errorhandler.ErrorTypeValidation, false, fmt.Errorf("failed to create download request: %w", err))
 	}
 
 	req.Host = est.domain
 	req.Header.Set("Host", est.domain)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
 
-	client := est.createHTTPClient(useTLS, timeout, 0)
+	var trace timingTrace
+	req = trace.trace(req)
+
+	client := est.createHTTPClient(usage.KindDownload, useTLS, timeout, 0)
+	requestStart := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start download: %w", err)
+		errorType := errorhandler.ErrorTypeSpeedTest
+		if t, _ := errorhandler.ClassifyError(err); t == errorhandler.ErrorTypeTimeout {
+			errorType = errorhandler.ErrorTypeTimeout
+		}
+		return nil, errorhandler.Classify(errorType, true, fmt.Errorf("failed to start download: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, errorhandler.Classify(errorhandler.ErrorTypeValidation, false, &StatusError{StatusCode: resp.StatusCode})
 	}
 
 	// Perform speed test with sliding window algorithm
-	result, err := est.performSpeedTest(resp.Body, downloadTime)
+	result, err := est.performSpeedTest(resp.Body, downloadTime, requestStart)
 	if err != nil {
-		return nil, fmt.Errorf("speed test failed: %w", err)
+		return nil, errorhandler.Classify(errorhandler.ErrorTypeSpeedTest, true, fmt.Errorf("speed test failed: %w", err))
 	}
+	result.Timing = trace.timing(time.Now())
 
 	return result, nil
 }
 
-// performSpeedTest performs the actual speed test with sliding window algorithm
-func (est *EnhancedSpeedTester) performSpeedTest(reader io.Reader, downloadTime float64) (*models.SpeedTestResult, error) {
+// performSpeedTest performs the actual speed test with sliding window algorithm.
+// requestStart is when the download request was sent, used to measure TTFB.
+func (est *EnhancedSpeedTester) performSpeedTest(reader io.Reader, downloadTime float64, requestStart time.Time) (*models.SpeedTestResult, error) {
 	initialStartTime := time.Now()
 	endTime := initialStartTime.Add(time.Duration(downloadTime) * time.Second)
 
@@ -224,6 +333,13 @@ func (est *EnhancedSpeedTester) performSpeedTest(reader io.Reader, downloadTime
 					peakSpeed = windowedSpeed
 				}
 
+				est.notifySample(SpeedSample{
+					Timestamp: currentTime,
+					Speed:     windowedSpeed,
+					Bytes:     totalBytes,
+					Duration:  elapsed,
+				})
+
 				lastSampleTime = currentTime
 			}
 		}
@@ -241,9 +357,11 @@ func (est *EnhancedSpeedTester) performSpeedTest(reader io.Reader, downloadTime
 	}
 
 	result := &models.SpeedTestResult{
-		Status:    "已完成",
-		Speed:     fmt.Sprintf("%.2f", finalSpeed),
+		Status:    models.StatusCompleted,
+		Speed:     finalSpeed,
 		PeakSpeed: peakSpeed,
+		TTFB:      startTime.Sub(requestStart),
+		Bytes:     totalBytes,
 	}
 
 	return result, nil
@@ -279,13 +397,12 @@ func (est *EnhancedSpeedTester) calculateWindowedSpeed(samples []SpeedSample) fl
 }
 
 // createHTTPClient creates an HTTP client with proper configuration
+// kind: how the traffic of the client's connections is counted
 // connectTimeout: timeout for establishing connection
 // totalTimeout: timeout for the entire request (0 for no timeout/infinite)
-func (est *EnhancedSpeedTester) createHTTPClient(useTLS bool, connectTimeout int, totalTimeout int) *http.Client {
+func (est *EnhancedSpeedTester) createHTTPClient(kind usage.Kind, useTLS bool, connectTimeout int, totalTimeout int) *http.Client {
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: time.Duration(connectTimeout) * time.Second,
-		}).DialContext,
+		DialContext:       est.countingDialer(kind, connectTimeout),
 		DisableKeepAlives: false, // Enable keep-alives for better performance
 		MaxIdleConns:      10,
 		IdleConnTimeout:   30 * time.Second,
@@ -305,6 +422,17 @@ func (est *EnhancedSpeedTester) createHTTPClient(useTLS bool, connectTimeout int
 	}
 }
 
+// isDialError reports whether err happened while connecting
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTransientStatus reports whether an HTTP status may succeed on retry
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
 // TestSpeedWithSamples tests speed and returns detailed samples (for analysis)
 func (est *EnhancedSpeedTester) TestSpeedWithSamples(ip string, useTLS bool, timeout int, downloadTime float64) (*models.SpeedTestResult, []SpeedSample, error) {
 	protocol := "http"
@@ -330,7 +458,11 @@ func (est *EnhancedSpeedTester) TestSpeedWithSamples(ip string, useTLS bool, tim
 	req.Header.Set("Host", est.domain)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
 
-	client := est.createHTTPClient(useTLS, timeout, 0)
+	var trace timingTrace
+	req = trace.trace(req)
+
+	client := est.createHTTPClient(usage.KindDownload, useTLS, timeout, 0)
+	requestStart := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to start download: %w", err)
@@ -338,20 +470,21 @@ func (est *EnhancedSpeedTester) TestSpeedWithSamples(ip string, useTLS bool, tim
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// Perform speed test and collect samples
-	result, samples, err := est.performSpeedTestWithSamples(resp.Body, downloadTime)
+	result, samples, err := est.performSpeedTestWithSamples(resp.Body, downloadTime, requestStart)
 	if err != nil {
 		return nil, nil, fmt.Errorf("speed test failed: %w", err)
 	}
+	result.Timing = trace.timing(time.Now())
 
 	return result, samples, nil
 }
 
 // performSpeedTestWithSamples performs speed test and returns all samples
-func (est *EnhancedSpeedTester) performSpeedTestWithSamples(reader io.Reader, downloadTime float64) (*models.SpeedTestResult, []SpeedSample, error) {
+func (est *EnhancedSpeedTester) performSpeedTestWithSamples(reader io.Reader, downloadTime float64, requestStart time.Time) (*models.SpeedTestResult, []SpeedSample, error) {
 	initialStartTime := time.Now()
 	endTime := initialStartTime.Add(time.Duration(downloadTime) * time.Second)
 
@@ -431,9 +564,11 @@ func (est *EnhancedSpeedTester) performSpeedTestWithSamples(reader io.Reader, do
 	}
 
 	result := &models.SpeedTestResult{
-		Status:    "已完成",
-		Speed:     fmt.Sprintf("%.2f", finalSpeed),
+		Status:    models.StatusCompleted,
+		Speed:     finalSpeed,
 		PeakSpeed: peakSpeed,
+		TTFB:      startTime.Sub(requestStart),
+		Bytes:     totalBytes,
 	}
 
 	return result, allSamples, nil
@@ -2,12 +2,23 @@ package tester
 
 import (
 	"cloudflare-speedtest/internal/generator"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math/rand"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
 
+const (
+	defaultSubnetScore = 0.5  // Score of a subnet without test results
+	subnetScoreDecay   = 0.7  // Weight of the previous score when a new result arrives
+	minSubnetWeight    = 0.05 // Keeps poorly scored subnets selectable so they can recover
+)
+
 // SubnetMetrics tracks performance metrics for a subnet
 type SubnetMetrics struct {
 	Subnet         string
@@ -19,7 +30,16 @@ type SubnetMetrics struct {
 	AverageRetries int
 	Capacity       int
 	IsExhausted    bool
-	Priority       int // Higher priority = prefer this subnet
+	Priority       int     // Higher priority = prefer this subnet
+	Score          float64 // Learned result quality, 0 (unreachable) to 1 (much faster than required)
+	Samples        int     // Number of test results folded into Score
+}
+
+// subnetScore is the persisted part of SubnetMetrics
+type subnetScore struct {
+	Score    float64   `json:"score"`
+	Samples  int       `json:"samples"`
+	LastUsed time.Time `json:"last_used"`
 }
 
 // IPPoolManager manages IP generation with intelligent pooling and retry strategies
@@ -32,6 +52,7 @@ type IPPoolManager struct {
 	maxRetries          int
 	exhaustionThreshold float64 // Percentage threshold for marking subnet as exhausted
 	fallbackMode        bool    // Allow fallback to other datacenters
+	rng                 *rand.Rand
 }
 
 // NewIPPoolManager creates a new IP pool manager
@@ -44,6 +65,7 @@ func NewIPPoolManager(ipType string) *IPPoolManager {
 		maxRetries:          200,  // Increased from 100
 		exhaustionThreshold: 0.85, // 85% instead of 90%
 		fallbackMode:        false,
+		rng:                 rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
@@ -67,6 +89,7 @@ func (ipm *IPPoolManager) RegisterSubnets(subnets []string) {
 				Capacity:    capacity,
 				Priority:    100, // Default priority
 				IsExhausted: false,
+				Score:       defaultSubnetScore,
 			}
 		}
 	}
@@ -92,6 +115,7 @@ func (ipm *IPPoolManager) GenerateIPWithRetry(subnets []string) (string, string,
 				Subnet:   subnet,
 				Capacity: ipm.calculateSubnetCapacity(subnet),
 				Priority: 100,
+				Score:    defaultSubnetScore,
 			}
 			ipm.subnetMetrics[subnet] = metrics
 		}
@@ -245,6 +269,8 @@ func (ipm *IPPoolManager) GetMetrics() map[string]*SubnetMetrics {
 			Capacity:       metrics.Capacity,
 			IsExhausted:    metrics.IsExhausted,
 			Priority:       metrics.Priority,
+			Score:          metrics.Score,
+			Samples:        metrics.Samples,
 		}
 	}
 	return result
@@ -264,7 +290,7 @@ func (ipm *IPPoolManager) ResetSubnet(subnet string) {
 	}
 }
 
-// ResetAll resets all metrics
+// ResetAll resets all metrics. Learned subnet scores are kept.
 func (ipm *IPPoolManager) ResetAll() {
 	ipm.mu.Lock()
 	defer ipm.mu.Unlock()
@@ -295,15 +321,26 @@ func (ipm *IPPoolManager) GetHealthStatus() map[string]interface{} {
 
 	totalSubnets := len(ipm.subnetMetrics)
 	exhaustedSubnets := 0
+	scoredSubnets := 0
 	totalAttempts := 0
 	totalSuccess := 0
+	totalScore := 0.0
 
 	for _, metrics := range ipm.subnetMetrics {
 		if metrics.IsExhausted {
 			exhaustedSubnets++
 		}
+		if metrics.Samples > 0 {
+			scoredSubnets++
+		}
 		totalAttempts += metrics.TotalAttempts
 		totalSuccess += metrics.SuccessCount
+		totalScore += metrics.Score
+	}
+
+	averageScore := 0.0
+	if totalSubnets > 0 {
+		averageScore = totalScore / float64(totalSubnets)
 	}
 
 	overallSuccessRate := 0.0
@@ -318,5 +355,156 @@ func (ipm *IPPoolManager) GetHealthStatus() map[string]interface{} {
 		"total_success":        totalSuccess,
 		"overall_success_rate": overallSuccessRate,
 		"generated_ips":        len(ipm.generatedIPs),
+		"scored_subnets":       scoredSubnets,
+		"average_score":        averageScore,
+	}
+}
+
+// SelectSubnets picks up to n distinct, non-exhausted subnets at random,
+// weighted by their learned score
+func (ipm *IPPoolManager) SelectSubnets(subnets []string, n int) []string {
+	ipm.mu.RLock()
+	defer ipm.mu.RUnlock()
+
+	candidates := make([]string, 0, len(subnets))
+	weights := make([]float64, 0, len(subnets))
+	total := 0.0
+	for _, subnet := range subnets {
+		weight := defaultSubnetScore
+		if metrics := ipm.subnetMetrics[subnet]; metrics != nil {
+			if metrics.IsExhausted {
+				continue
+			}
+			weight = metrics.Score
+		}
+		weight = max(weight, minSubnetWeight)
+
+		candidates = append(candidates, subnet)
+		weights = append(weights, weight)
+		total += weight
+	}
+
+	selected := make([]string, 0, min(n, len(candidates)))
+	for len(selected) < n && len(candidates) > 0 {
+		r := ipm.rng.Float64() * total
+		idx := len(candidates) - 1
+		for i, weight := range weights {
+			r -= weight
+			if r < 0 {
+				idx = i
+				break
+			}
+		}
+
+		selected = append(selected, candidates[idx])
+		total -= weights[idx]
+
+		// Remove the pick so each subnet is used at most once
+		last := len(candidates) - 1
+		candidates[idx], weights[idx] = candidates[last], weights[last]
+		candidates, weights = candidates[:last], weights[:last]
+	}
+
+	return selected
+}
+
+// ReportResult folds the quality of a test result (0 to 1) into the score of
+// the subnet that generated ip. It returns false if ip did not come from this pool.
+func (ipm *IPPoolManager) ReportResult(ip string, quality float64) bool {
+	ipm.mu.Lock()
+	defer ipm.mu.Unlock()
+
+	subnet, ok := ipm.generatedIPs[ip]
+	if !ok {
+		return false
+	}
+
+	metrics := ipm.subnetMetrics[subnet]
+	if metrics == nil {
+		return false
+	}
+
+	metrics.Score = metrics.Score*subnetScoreDecay + quality*(1-subnetScoreDecay)
+	metrics.Samples++
+	return true
+}
+
+// LoadScores restores learned subnet scores from path. A missing file is not an error.
+func (ipm *IPPoolManager) LoadScores(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read subnet scores: %w", err)
 	}
+
+	var scores map[string]subnetScore
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return fmt.Errorf("failed to parse subnet scores: %w", err)
+	}
+
+	ipm.mu.Lock()
+	defer ipm.mu.Unlock()
+
+	for subnet, score := range scores {
+		metrics := ipm.subnetMetrics[subnet]
+		if metrics == nil {
+			metrics = &SubnetMetrics{
+				Subnet:   subnet,
+				Capacity: ipm.calculateSubnetCapacity(subnet),
+				Priority: 100,
+			}
+			ipm.subnetMetrics[subnet] = metrics
+		}
+		metrics.Score = score.Score
+		metrics.Samples = score.Samples
+		metrics.LastUsed = score.LastUsed
+	}
+
+	return nil
+}
+
+// SaveScores writes the scores of all subnets with test results to path
+func (ipm *IPPoolManager) SaveScores(path string) error {
+	ipm.mu.RLock()
+	scores := make(map[string]subnetScore)
+	for subnet, metrics := range ipm.subnetMetrics {
+		if metrics.Samples > 0 {
+			scores[subnet] = subnetScore{
+				Score:    metrics.Score,
+				Samples:  metrics.Samples,
+				LastUsed: metrics.LastUsed,
+			}
+		}
+	}
+	ipm.mu.RUnlock()
+
+	data, err := json.MarshalIndent(scores, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode subnet scores: %w", err)
+	}
+
+	// Write to a temporary file first so a crash cannot leave a truncated file
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write subnet scores: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write subnet scores: %w", err)
+	}
+
+	return nil
+}
+
+// GetGeneratedCount returns the number of IPs generated since the last reset
+func (ipm *IPPoolManager) GetGeneratedCount() int {
+	ipm.mu.RLock()
+	defer ipm.mu.RUnlock()
+	return len(ipm.generatedIPs)
+}
+
+// GetGeneratorStats returns statistics about IP generation
+func (ipm *IPPoolManager) GetGeneratorStats() map[string]*generator.SubnetStats {
+	return ipm.ipGen.GetSubnetStats()
 }
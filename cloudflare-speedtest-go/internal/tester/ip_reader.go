@@ -3,30 +3,33 @@ package tester
 import (
 	"bufio"
 	"cloudflare-speedtest/internal/generator"
-	"crypto/rand"
 	"fmt"
-	"math/big"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // IPReader reads IP addresses from files
 type IPReader struct {
 	dataDir string
-	ipGen   *generator.IPGenerator
+	pools   map[string]*IPPoolManager // One pool per IP type
+	mu      sync.Mutex
 }
 
 // NewIPReader creates a new IP reader
 func NewIPReader(dataDir string) *IPReader {
 	return &IPReader{
 		dataDir: dataDir,
-		ipGen:   generator.New(),
+		pools:   make(map[string]*IPPoolManager),
 	}
 }
 
-// ReadIPs reads IP addresses from file based on IP type
-// Returns up to batchSize IPs randomly selected from the file
+// ReadIPs reads IP addresses from file based on IP type.
+// Returns up to batchSize IPs from distinct subnets, favouring subnets that
+// produced fast results. IPs are not repeated until Reset is called.
 func (ir *IPReader) ReadIPs(ipType string, batchSize int) ([]string, error) {
 	var filename string
 	switch ipType {
@@ -65,64 +68,164 @@ func (ir *IPReader) ReadIPs(ipType string, batchSize int) ([]string, error) {
 		return nil, fmt.Errorf("no subnets found in %s", filename)
 	}
 
-	// Clear previous generation history for fresh start
-	ir.ipGen.ClearGenerated()
+	pool := ir.pool(ipType)
+	pool.RegisterSubnets(subnets)
 
-	// Randomly select subnets and generate IPs
-	selectedIndices := make(map[int]bool)
+	// Pick subnets weighted by score and generate one IP from each
 	var ips []string
-	maxAttempts := batchSize * 3 // Allow more attempts to find unique IPs
-
-	for len(ips) < batchSize && len(selectedIndices) < len(subnets) && maxAttempts > 0 {
-		maxAttempts--
-
-		// Generate cryptographically secure random index
-		idx, err := ir.generateSecureRandomInt(len(subnets))
+	for _, subnet := range pool.SelectSubnets(subnets, batchSize) {
+		ip, _, err := pool.GenerateIPWithRetry([]string{subnet})
 		if err != nil {
-			// Fallback to simple selection if crypto random fails
-			idx = len(selectedIndices) % len(subnets)
+			fmt.Printf("Failed to generate IP from subnet %s: %v\n", subnet, err)
+			continue
 		}
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// ReadIPList reads a list of known IPs from a file, see ParseIPList
+func ReadIPList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP list: %w", err)
+	}
+	defer file.Close()
+
+	return ParseIPList(file)
+}
+
+// ParseIPList reads one IP per line, taking the first comma or whitespace
+// separated field so result CSV and TXT files can be reused as input.
+// Comments, duplicates and lines that do not start with an IP (such as a
+// CSV header) are skipped.
+func ParseIPList(r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	ips := make([]string, 0)
 
-		// Skip if already selected
-		if selectedIndices[idx] {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
-		selectedIndices[idx] = true
-		subnet := subnets[idx]
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 {
+			continue
+		}
 
-		// Generate a random IP from the CIDR subnet
-		result := ir.ipGen.GenerateIP(subnet, ipType)
-		if result.Success {
-			ips = append(ips, result.IP)
-		} else {
-			fmt.Printf("Failed to generate IP from subnet %s: %v\n", subnet, result.Error)
+		ip := net.ParseIP(fields[0])
+		if ip == nil || seen[ip.String()] {
+			continue
 		}
+
+		seen[ip.String()] = true
+		ips = append(ips, ip.String())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading IP list: %w", err)
 	}
 
 	return ips, nil
 }
 
-// generateSecureRandomInt generates a cryptographically secure random integer
-func (ir *IPReader) generateSecureRandomInt(max int) (int, error) {
-	if max <= 0 {
-		return 0, fmt.Errorf("max must be positive")
+// Reset forgets which IPs were generated so a new run can test them again.
+// Learned subnet scores are kept.
+func (ir *IPReader) Reset() {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	for _, pool := range ir.pools {
+		pool.ResetAll()
+	}
+}
+
+// ReportResult feeds the quality of a test result (0 to 1) back into the
+// score of the subnet that produced ip
+func (ir *IPReader) ReportResult(ip string, quality float64) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	for _, pool := range ir.pools {
+		if pool.ReportResult(ip, quality) {
+			return
+		}
 	}
+}
 
-	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
-	if err != nil {
-		return 0, err
+// SaveScores persists the learned subnet scores of every IP type to the data directory
+func (ir *IPReader) SaveScores() error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	for ipType, pool := range ir.pools {
+		if err := pool.SaveScores(ir.scoresPath(ipType)); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// GetHealthStatus returns the pool health for each IP type read so far
+func (ir *IPReader) GetHealthStatus() map[string]map[string]interface{} {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
 
-	return int(n.Int64()), nil
+	status := make(map[string]map[string]interface{})
+	for ipType, pool := range ir.pools {
+		status[ipType] = pool.GetHealthStatus()
+	}
+	return status
 }
 
 // GetGeneratorStats returns statistics about IP generation
 func (ir *IPReader) GetGeneratorStats() map[string]*generator.SubnetStats {
-	return ir.ipGen.GetSubnetStats()
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	stats := make(map[string]*generator.SubnetStats)
+	for _, pool := range ir.pools {
+		for subnet, s := range pool.GetGeneratorStats() {
+			stats[subnet] = s
+		}
+	}
+	return stats
 }
 
 // GetGeneratedCount returns the total number of generated IPs
 func (ir *IPReader) GetGeneratedCount() int {
-	return ir.ipGen.GetGeneratedCount()
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	count := 0
+	for _, pool := range ir.pools {
+		count += pool.GetGeneratedCount()
+	}
+	return count
+}
+
+// pool returns the pool for ipType, creating it from saved scores on first use
+func (ir *IPReader) pool(ipType string) *IPPoolManager {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	pool, ok := ir.pools[ipType]
+	if !ok {
+		pool = NewIPPoolManager(ipType)
+		if err := pool.LoadScores(ir.scoresPath(ipType)); err != nil {
+			fmt.Printf("Warning: Starting with fresh subnet scores: %v\n", err)
+		}
+		ir.pools[ipType] = pool
+	}
+	return pool
+}
+
+// scoresPath returns the file holding the subnet scores of ipType
+func (ir *IPReader) scoresPath(ipType string) string {
+	return filepath.Join(ir.dataDir, fmt.Sprintf("subnet-scores-%s.json", ipType))
 }
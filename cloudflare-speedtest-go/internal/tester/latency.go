@@ -0,0 +1,125 @@
+package tester
+
+import (
+	"cloudflare-speedtest/internal/usage"
+	"cloudflare-speedtest/pkg/models"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Latency probe methods accepted in test.latency_method
+const (
+	LatencyMethodTCP  = "tcp"  // Time the TCP handshake
+	LatencyMethodHead = "head" // Time HEAD requests over one kept-alive connection
+)
+
+// latencyProbeInterval spaces the probes so they sample different moments
+const latencyProbeInterval = 100 * time.Millisecond
+
+// MeasureLatency sends probes latency probes to ip and summarizes them.
+// tcp times the TCP handshake alone; head opens a connection first, so the
+// TLS handshake is left out, then times HEAD requests over it. Probes that
+// fail or time out count as lost. Cancelling ctx stops probing early.
+func (est *EnhancedSpeedTester) MeasureLatency(ctx context.Context, ip string, useTLS bool, timeout, probes int, method string) *models.LatencyStats {
+	probe := est.tcpProbe(ip, useTLS, timeout)
+	if method == LatencyMethodHead {
+		var closeIdle func()
+		probe, closeIdle = est.headProbe(ip, useTLS, timeout)
+		defer closeIdle()
+
+		// Warm up the connection; a failure here shows up in the probes
+		probe(ctx)
+	}
+
+	samples := make([]float64, 0, probes)
+	sent := 0
+	for sent < probes {
+		if sent > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(latencyProbeInterval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		sent++
+		if rtt, err := probe(ctx); err == nil {
+			samples = append(samples, float64(rtt)/float64(time.Millisecond))
+		}
+	}
+
+	return models.NewLatencyStats(method, sent, samples)
+}
+
+// tcpProbe returns a probe timing a TCP connect to ip. Its connections are
+// counted as probe traffic like any other, though a bare handshake sends no
+// payload
+func (est *EnhancedSpeedTester) tcpProbe(ip string, useTLS bool, timeout int) func(context.Context) (time.Duration, error) {
+	port := "80"
+	if useTLS {
+		port = "443"
+	}
+	addr := net.JoinHostPort(ip, port)
+	dial := est.countingDialer(usage.KindProbe, timeout)
+
+	return func(ctx context.Context) (time.Duration, error) {
+		start := time.Now()
+		conn, err := dial(ctx, "tcp", addr)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		return rtt, nil
+	}
+}
+
+// headProbe returns a probe timing a HEAD request for /cdn-cgi/trace on ip,
+// reusing one connection, and a function closing that connection
+func (est *EnhancedSpeedTester) headProbe(ip string, useTLS bool, timeout int) (func(context.Context) (time.Duration, error), func()) {
+	protocol := "http"
+	port := "80"
+	if useTLS {
+		protocol = "https"
+		port = "443"
+	}
+
+	// Handle IPv6 addresses
+	if strings.Contains(ip, ":") {
+		ip = "[" + ip + "]"
+	}
+
+	url := fmt.Sprintf("%s://%s:%s/cdn-cgi/trace", protocol, ip, port)
+	client := est.createHTTPClient(usage.KindProbe, useTLS, timeout, timeout)
+
+	probe := func(ctx context.Context) (time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Host = est.domain
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+		req.Header.Set("Cache-Control", "no-cache")
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+
+		// Any status is an answer; drain the body so the connection is reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return rtt, nil
+	}
+
+	return probe, client.CloseIdleConnections
+}
@@ -0,0 +1,75 @@
+package tester
+
+import (
+	"cloudflare-speedtest/pkg/models"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timingTrace records when the phases of one request start and end
+type timingTrace struct {
+	mu           sync.Mutex
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// trace attaches a client trace recording into t to req
+func (t *timingTrace) trace(req *http.Request) *http.Request {
+	ct := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mark(&t.connectDone)
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mark(&t.tlsDone)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mark(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.mark(&t.firstByte)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+}
+
+// mark sets field to the current time
+func (t *timingTrace) mark(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	*field = time.Now()
+}
+
+// timing returns the phase durations of a download that finished at end
+func (t *timingTrace) timing(end time.Time) *models.ConnectionTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &models.ConnectionTiming{
+		Connect:      between(t.connectStart, t.connectDone),
+		TLSHandshake: between(t.tlsStart, t.tlsDone),
+		FirstByte:    between(t.wroteRequest, t.firstByte),
+		Transfer:     between(t.firstByte, end),
+	}
+}
+
+// between returns the time from start to end, or zero if either is unknown
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
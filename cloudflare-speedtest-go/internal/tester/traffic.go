@@ -0,0 +1,50 @@
+package tester
+
+import (
+	"cloudflare-speedtest/internal/usage"
+	"context"
+	"net"
+	"time"
+)
+
+// countingConn reports the bytes read and written through a connection
+type countingConn struct {
+	net.Conn
+	count func(n int64)
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.count(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.count(int64(n))
+	}
+	return n, err
+}
+
+// countingDialer returns a dial function whose connections report their
+// traffic as kind to the traffic counter set when it is created
+func (est *EnhancedSpeedTester) countingDialer(kind usage.Kind, connectTimeout int) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: time.Duration(connectTimeout) * time.Second,
+	}
+
+	est.mu.Lock()
+	onTraffic := est.onTraffic
+	est.mu.Unlock()
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || onTraffic == nil {
+			return conn, err
+		}
+		return &countingConn{Conn: conn, count: func(n int64) { onTraffic(kind, n) }}, nil
+	}
+}
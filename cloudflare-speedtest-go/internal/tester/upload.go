@@ -0,0 +1,181 @@
+package tester
+
+import (
+	"cloudflare-speedtest/internal/errorhandler"
+	"cloudflare-speedtest/internal/usage"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadChunk is the data repeated as the upload payload. Random bytes keep
+// compressing proxies from inflating the measured speed.
+var uploadChunk = func() []byte {
+	chunk := make([]byte, 65536) // 64KB, the download chunk size
+	rand.Read(chunk)
+	return chunk
+}()
+
+// UploadResult is the outcome of an upload test
+type UploadResult struct {
+	Speed     float64 // Mbps
+	PeakSpeed float64 // Mbps, the fastest sliding window
+	Bytes     int64   // Bytes of payload sent
+}
+
+// TestUploadOnly measures the upload speed by POSTing generated data to the
+// configured domain and path for uploadTime seconds. Interrupted uploads are
+// retried; HTTP error statuses are returned at once. Cancelling ctx aborts
+// the upload.
+func (est *EnhancedSpeedTester) TestUploadOnly(ctx context.Context, ip string, useTLS bool, timeout int, uploadTime float64) (*UploadResult, error) {
+	var result *UploadResult
+	err := est.retry("upload_test", ip, func() error {
+		var err error
+		result, err = est.uploadSpeed(ctx, ip, useTLS, timeout, uploadTime)
+		return err
+	})
+	return result, err
+}
+
+// uploadSpeed measures the upload speed once, classifying failures
+func (est *EnhancedSpeedTester) uploadSpeed(ctx context.Context, ip string, useTLS bool, timeout int, uploadTime float64) (*UploadResult, error) {
+	protocol := "http"
+	port := "80"
+	if useTLS {
+		protocol = "https"
+		port = "443"
+	}
+
+	// Handle IPv6 addresses
+	if strings.Contains(ip, ":") {
+		ip = "[" + ip + "]"
+	}
+
+	url := fmt.Sprintf("%s://%s:%s/%s", protocol, ip, port, est.filePath)
+
+	body := est.newUploadBody(time.Duration(uploadTime * float64(time.Second)))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, errorhandler.Classify(errorhandler.ErrorTypeValidation, false, fmt.Errorf("failed to create upload request: %w", err))
+	}
+
+	// The payload is generated while it is sent, so its length is unknown
+	// and the body goes out chunked
+	req.ContentLength = -1
+	req.Host = est.domain
+	req.Header.Set("Host", est.domain)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	// The body ends after uploadTime; timeout more covers a stalled reply
+	client := est.createHTTPClient(usage.KindUpload, useTLS, timeout, int(uploadTime)+timeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		errorType := errorhandler.ErrorTypeSpeedTest
+		if t, _ := errorhandler.ClassifyError(err); t == errorhandler.ErrorTypeTimeout {
+			errorType = errorhandler.ErrorTypeTimeout
+		}
+		return nil, errorhandler.Classify(errorType, true, fmt.Errorf("failed to upload: %w", err))
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// Upload endpoints commonly answer 200 or 204
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errorhandler.Classify(errorhandler.ErrorTypeValidation, false, &StatusError{StatusCode: resp.StatusCode})
+	}
+
+	result, err := body.result(time.Now())
+	if err != nil {
+		return nil, errorhandler.Classify(errorhandler.ErrorTypeSpeedTest, true, fmt.Errorf("upload test failed: %w", err))
+	}
+	return result, nil
+}
+
+// uploadBody generates the payload of an upload test until its time is up,
+// sampling the speed with the same sliding window as downloads
+type uploadBody struct {
+	est      *EnhancedSpeedTester
+	duration time.Duration
+
+	mu         sync.Mutex // The transport reads the body in its own goroutine
+	offset     int        // Position in uploadChunk
+	totalBytes int64
+	startTime  time.Time // First read, zero until then
+	lastSample time.Time
+	samples    []SpeedSample
+	peakSpeed  float64
+}
+
+// newUploadBody creates a payload sent for duration
+func (est *EnhancedSpeedTester) newUploadBody(duration time.Duration) *uploadBody {
+	return &uploadBody{est: est, duration: duration}
+}
+
+// Read fills p with payload, or returns io.EOF once the time is up
+func (b *uploadBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	currentTime := time.Now()
+	if b.startTime.IsZero() {
+		b.startTime = currentTime
+		b.lastSample = currentTime
+	}
+	if currentTime.Sub(b.startTime) >= b.duration {
+		return 0, io.EOF
+	}
+
+	// Take sample if enough time has passed
+	if currentTime.Sub(b.lastSample) >= b.est.sampleRate {
+		elapsed := currentTime.Sub(b.startTime).Seconds()
+		b.samples = append(b.samples, SpeedSample{
+			Timestamp: currentTime,
+			Speed:     (float64(b.totalBytes) * 8) / (elapsed * 1000000),
+			Bytes:     b.totalBytes,
+			Duration:  elapsed,
+		})
+
+		// Maintain sliding window
+		if len(b.samples) > b.est.windowSize {
+			b.samples = b.samples[1:]
+		}
+
+		if windowedSpeed := b.est.calculateWindowedSpeed(b.samples); windowedSpeed > b.peakSpeed {
+			b.peakSpeed = windowedSpeed
+		}
+		b.lastSample = currentTime
+	}
+
+	n := copy(p, uploadChunk[b.offset:])
+	b.offset = (b.offset + n) % len(uploadChunk)
+	b.totalBytes += int64(n)
+	return n, nil
+}
+
+// result computes the upload speed from the first read to answeredAt, when
+// the server confirmed it received the whole payload
+func (b *uploadBody) result(answeredAt time.Time) (*UploadResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.totalBytes == 0 {
+		return nil, fmt.Errorf("no data sent")
+	}
+
+	finalSpeed := 0.0
+	if totalDuration := answeredAt.Sub(b.startTime).Seconds(); totalDuration > 0 {
+		finalSpeed = (float64(b.totalBytes) * 8) / (totalDuration * 1000000)
+	}
+
+	return &UploadResult{
+		Speed:     finalSpeed,
+		PeakSpeed: max(b.peakSpeed, finalSpeed),
+		Bytes:     b.totalBytes,
+	}, nil
+}
@@ -3,22 +3,61 @@ package urlmanager
 import (
 	"bufio"
 	"fmt"
+	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Strategy selects which URL serves the next download
+type Strategy string
+
+const (
+	StrategyRoundRobin Strategy = "round_robin"
+	StrategyRandom     Strategy = "random"
+	StrategyWeighted   Strategy = "weighted" // Random, weighted by recent success rate
+)
+
+// successDecay controls how quickly the success score follows recent results
+const successDecay = 0.7
+
+// minWeight keeps failing URLs selectable so they can recover
+const minWeight = 0.05
+
+// URLHealth tracks how a test URL has behaved during the current run
+type URLHealth struct {
+	URL            string    `json:"url"`
+	Successes      int       `json:"successes"`
+	Failures       int       `json:"failures"`
+	Score          float64   `json:"score"` // Exponentially weighted success rate, 1 = always succeeds
+	LastStatus     int       `json:"last_status,omitempty"`
+	LastUsed       time.Time `json:"last_used,omitempty"`
+	Disabled       bool      `json:"disabled"`
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+}
+
 // URLManager manages test URLs
 type URLManager struct {
-	dataDir string
-	urls    []string
+	dataDir  string
+	urls     []string
+	health   map[string]*URLHealth
+	strategy Strategy
+	next     int
+	rng      *rand.Rand
+	mu       sync.Mutex
 }
 
 // New creates a new URL manager
 func New(dataDir string) *URLManager {
 	return &URLManager{
-		dataDir: dataDir,
-		urls:    make([]string, 0),
+		dataDir:  dataDir,
+		urls:     make([]string, 0),
+		health:   make(map[string]*URLHealth),
+		strategy: StrategyRoundRobin,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
@@ -32,14 +71,14 @@ func (um *URLManager) LoadURLs() error {
 	}
 	defer file.Close()
 
-	um.urls = make([]string, 0)
+	urls := make([]string, 0)
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		// Skip empty lines and comments
 		if line != "" && !strings.HasPrefix(line, "#") {
-			um.urls = append(um.urls, line)
+			urls = append(urls, line)
 		}
 	}
 
@@ -47,33 +86,192 @@ func (um *URLManager) LoadURLs() error {
 		return fmt.Errorf("error reading url.txt: %w", err)
 	}
 
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	um.urls = urls
+	um.resetHealth()
+
 	return nil
 }
 
 // GetURLs returns all loaded URLs
 func (um *URLManager) GetURLs() []string {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
 	urls := make([]string, len(um.urls))
 	copy(urls, um.urls)
 	return urls
 }
 
-// GetRandomURL returns a random URL from the list
+// SetStrategy sets the rotation strategy used by Next
+func (um *URLManager) SetStrategy(strategy Strategy) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	switch strategy {
+	case StrategyRandom, StrategyWeighted:
+		um.strategy = strategy
+	default:
+		um.strategy = StrategyRoundRobin
+	}
+}
+
+// GetStrategy returns the current rotation strategy
+func (um *URLManager) GetStrategy() Strategy {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.strategy
+}
+
+// Next returns the URL for the next download according to the rotation
+// strategy, skipping disabled URLs
+func (um *URLManager) Next() (string, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	active := um.activeURLs()
+	if len(active) == 0 {
+		return "", fmt.Errorf("no URLs available")
+	}
+
+	var url string
+	switch um.strategy {
+	case StrategyRandom:
+		url = active[um.rng.Intn(len(active))]
+	case StrategyWeighted:
+		url = um.pickWeighted(active)
+	default:
+		url = active[um.next%len(active)]
+		um.next++
+	}
+
+	um.health[url].LastUsed = time.Now()
+	return url, nil
+}
+
+// GetRandomURL returns a random enabled URL from the list
 func (um *URLManager) GetRandomURL() (string, error) {
-	if len(um.urls) == 0 {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	active := um.activeURLs()
+	if len(active) == 0 {
 		return "", fmt.Errorf("no URLs available")
 	}
 
-	// For now, return the first URL
-	// TODO: Implement random selection
-	return um.urls[0], nil
+	return active[um.rng.Intn(len(active))], nil
+}
+
+// ReportSuccess records a successful download from url
+func (um *URLManager) ReportSuccess(url string) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if h, ok := um.health[url]; ok {
+		h.Successes++
+		h.LastStatus = http.StatusOK
+		h.Score = h.Score*successDecay + (1 - successDecay)
+	}
+}
+
+// ReportFailure records an HTTP error status returned by url. It returns
+// true if the URL was disabled for the rest of the run as a result:
+// 403 and 429 mean the endpoint is refusing us, so retrying it is pointless.
+func (um *URLManager) ReportFailure(url string, statusCode int) bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	h, ok := um.health[url]
+	if !ok {
+		return false
+	}
+
+	h.Failures++
+	h.LastStatus = statusCode
+	h.Score *= successDecay
+
+	if !h.Disabled && (statusCode == http.StatusForbidden || statusCode == http.StatusTooManyRequests) {
+		h.Disabled = true
+		h.DisabledReason = fmt.Sprintf("HTTP %d %s", statusCode, http.StatusText(statusCode))
+		return true
+	}
+	return false
+}
+
+// ResetHealth clears health tracking and re-enables all URLs, e.g. at the start of a run
+func (um *URLManager) ResetHealth() {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.resetHealth()
+}
+
+// GetHealth returns a snapshot of the health of every URL
+func (um *URLManager) GetHealth() []URLHealth {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	health := make([]URLHealth, 0, len(um.urls))
+	for _, url := range um.urls {
+		health = append(health, *um.health[url])
+	}
+	return health
+}
+
+// ActiveCount returns the number of URLs that are not disabled
+func (um *URLManager) ActiveCount() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return len(um.activeURLs())
 }
 
 // URLCount returns the number of loaded URLs
 func (um *URLManager) URLCount() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
 	return len(um.urls)
 }
 
 // HasURLs checks if URLs are loaded
 func (um *URLManager) HasURLs() bool {
-	return len(um.urls) > 0
+	return um.URLCount() > 0
+}
+
+// resetHealth rebuilds the health table (must be called with lock held)
+func (um *URLManager) resetHealth() {
+	um.health = make(map[string]*URLHealth, len(um.urls))
+	for _, url := range um.urls {
+		um.health[url] = &URLHealth{URL: url, Score: 1}
+	}
+	um.next = 0
+}
+
+// activeURLs returns the enabled URLs (must be called with lock held)
+func (um *URLManager) activeURLs() []string {
+	active := make([]string, 0, len(um.urls))
+	for _, url := range um.urls {
+		if !um.health[url].Disabled {
+			active = append(active, url)
+		}
+	}
+	return active
+}
+
+// pickWeighted picks a URL with probability proportional to its success score
+// (must be called with lock held)
+func (um *URLManager) pickWeighted(active []string) string {
+	total := 0.0
+	for _, url := range active {
+		total += max(um.health[url].Score, minWeight)
+	}
+
+	r := um.rng.Float64() * total
+	for _, url := range active {
+		r -= max(um.health[url].Score, minWeight)
+		if r < 0 {
+			return url
+		}
+	}
+	return active[len(active)-1]
 }
@@ -0,0 +1,182 @@
+package urlmanager
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testURLs = []string{
+	"https://speed.example.com/a",
+	"https://speed.example.com/b",
+	"https://speed.example.com/c",
+}
+
+// newTestManager loads testURLs into a manager using strategy and a seeded rng
+func newTestManager(t *testing.T, strategy Strategy) *URLManager {
+	t.Helper()
+	dataDir := t.TempDir()
+	content := "# test URLs\n" + strings.Join(testURLs, "\n") + "\n\n"
+	if err := os.WriteFile(filepath.Join(dataDir, "url.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	um := New(dataDir)
+	if err := um.LoadURLs(); err != nil {
+		t.Fatalf("LoadURLs() error = %v", err)
+	}
+	um.SetStrategy(strategy)
+	um.rng = rand.New(rand.NewSource(1))
+	return um
+}
+
+// health returns the health of url
+func health(um *URLManager, url string) URLHealth {
+	for _, h := range um.GetHealth() {
+		if h.URL == url {
+			return h
+		}
+	}
+	return URLHealth{}
+}
+
+func TestReportFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantDisabled bool
+		wantReason   string
+		wantLast     bool // What the last ReportFailure returned
+	}{
+		{"forbidden", []int{http.StatusForbidden}, true, "HTTP 403 Forbidden", true},
+		{"rate limited", []int{http.StatusTooManyRequests}, true, "HTTP 429 Too Many Requests", true},
+		{"server error", []int{http.StatusInternalServerError}, false, "", false},
+		{"not found", []int{http.StatusNotFound, http.StatusNotFound}, false, "", false},
+		{"disabled once", []int{http.StatusTooManyRequests, http.StatusForbidden}, true, "HTTP 429 Too Many Requests", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			um := newTestManager(t, StrategyRoundRobin)
+			url := testURLs[1]
+
+			var last bool
+			for _, status := range tt.statuses {
+				last = um.ReportFailure(url, status)
+			}
+
+			h := health(um, url)
+			if last != tt.wantLast || h.Disabled != tt.wantDisabled || h.DisabledReason != tt.wantReason {
+				t.Errorf("ReportFailure() = %t with disabled %t (%q), want %t with disabled %t (%q)",
+					last, h.Disabled, h.DisabledReason, tt.wantLast, tt.wantDisabled, tt.wantReason)
+			}
+			if h.Failures != len(tt.statuses) || h.LastStatus != tt.statuses[len(tt.statuses)-1] || h.Score >= 1 {
+				t.Errorf("health = %+v, want %d failures lowering the score", h, len(tt.statuses))
+			}
+		})
+	}
+
+	um := newTestManager(t, StrategyRoundRobin)
+	if um.ReportFailure("https://unknown.example.com/", http.StatusForbidden) {
+		t.Error("ReportFailure() disabled a URL that was never loaded")
+	}
+}
+
+func TestNextSkipsDisabledURLs(t *testing.T) {
+	for _, strategy := range []Strategy{StrategyRoundRobin, StrategyRandom, StrategyWeighted} {
+		t.Run(string(strategy), func(t *testing.T) {
+			um := newTestManager(t, strategy)
+			um.ReportFailure(testURLs[1], http.StatusForbidden)
+
+			picks := make(map[string]int)
+			for range 300 {
+				url, err := um.Next()
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				picks[url]++
+			}
+
+			if picks[testURLs[1]] != 0 {
+				t.Errorf("disabled URL picked %d times", picks[testURLs[1]])
+			}
+			for _, url := range []string{testURLs[0], testURLs[2]} {
+				if picks[url] == 0 {
+					t.Errorf("%s never picked", url)
+				}
+			}
+			if got := um.ActiveCount(); got != 2 {
+				t.Errorf("ActiveCount() = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestNextRoundRobinOrder(t *testing.T) {
+	um := newTestManager(t, StrategyRoundRobin)
+
+	var got []string
+	for range 4 {
+		url, _ := um.Next()
+		got = append(got, url)
+	}
+	um.ReportFailure(testURLs[0], http.StatusTooManyRequests)
+	for range 3 {
+		url, _ := um.Next()
+		got = append(got, url)
+	}
+
+	want := []string{testURLs[0], testURLs[1], testURLs[2], testURLs[0], testURLs[1], testURLs[2], testURLs[1]}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Next() order = %v, want %v", got, want)
+	}
+}
+
+func TestNextWeightedFavoursSuccessfulURLs(t *testing.T) {
+	um := newTestManager(t, StrategyWeighted)
+	for range 10 {
+		um.ReportFailure(testURLs[0], http.StatusInternalServerError)
+		um.ReportSuccess(testURLs[2])
+	}
+
+	picks := make(map[string]int)
+	for range 1000 {
+		url, _ := um.Next()
+		picks[url]++
+	}
+
+	// Failing URLs keep minWeight so they can recover, but are rarely picked
+	if picks[testURLs[0]] == 0 || picks[testURLs[0]]*5 > picks[testURLs[2]] {
+		t.Errorf("picks = %v, want the failing URL picked rarely but not never", picks)
+	}
+}
+
+func TestNextWithEveryURLDisabled(t *testing.T) {
+	um := newTestManager(t, StrategyRandom)
+	for _, url := range testURLs {
+		um.ReportFailure(url, http.StatusForbidden)
+	}
+
+	if url, err := um.Next(); err == nil {
+		t.Errorf("Next() = %q, want an error with every URL disabled", url)
+	}
+	if _, err := um.GetRandomURL(); err == nil {
+		t.Error("GetRandomURL() succeeded with every URL disabled")
+	}
+
+	um.ResetHealth()
+	if got := um.ActiveCount(); got != len(testURLs) {
+		t.Errorf("ActiveCount() after ResetHealth() = %d, want %d", got, len(testURLs))
+	}
+	for _, h := range um.GetHealth() {
+		if h.Disabled || h.Failures != 0 || h.Score != 1 {
+			t.Errorf("health after ResetHealth() = %+v, want a fresh enabled URL", h)
+		}
+	}
+	if _, err := um.Next(); err != nil {
+		t.Errorf("Next() after ResetHealth() error = %v", err)
+	}
+}
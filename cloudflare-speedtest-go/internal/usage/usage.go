@@ -0,0 +1,383 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind tells apart the traffic of probes from that of downloads
+type Kind string
+
+const (
+	KindProbe    Kind = "probe"    // Datacenter trace requests and HTTP latency probes
+	KindDownload Kind = "download" // Speed test downloads
+	KindUpload   Kind = "upload"   // Upload tests
+)
+
+// fileName is the usage file in the data directory
+const fileName = "data-usage.json"
+
+// keepDays is how many days of usage are kept on disk
+const keepDays = 400
+
+// dateLayout keys the daily usage by local calendar day
+const dateLayout = "2006-01-02"
+
+// ErrQuotaExceeded is returned by CheckQuota when a run would go over the monthly quota
+var ErrQuotaExceeded = errors.New("monthly data quota exceeded")
+
+// Usage counts the bytes sent and received over test connections. HTTP
+// headers and TLS handshakes are included, TCP/IP packet overhead is not.
+type Usage struct {
+	ProbeBytes    int64 `json:"probe_bytes"`
+	DownloadBytes int64 `json:"download_bytes"`
+	UploadBytes   int64 `json:"upload_bytes"`
+}
+
+// Total returns the bytes of every kind
+func (u Usage) Total() int64 {
+	return u.ProbeBytes + u.DownloadBytes + u.UploadBytes
+}
+
+// String describes the usage, e.g. "12.50 MiB (probes 1.20 MiB, downloads 11.30 MiB)".
+// Uploads are only listed when there were any.
+func (u Usage) String() string {
+	uploads := ""
+	if u.UploadBytes > 0 {
+		uploads = ", uploads " + FormatBytes(u.UploadBytes)
+	}
+	return fmt.Sprintf("%s (probes %s, downloads %s%s)",
+		FormatBytes(u.Total()), FormatBytes(u.ProbeBytes), FormatBytes(u.DownloadBytes), uploads)
+}
+
+// add counts n bytes of kind
+func (u *Usage) add(kind Kind, n int64) {
+	switch kind {
+	case KindProbe:
+		u.ProbeBytes += n
+	case KindDownload:
+		u.DownloadBytes += n
+	case KindUpload:
+		u.UploadBytes += n
+	}
+}
+
+// merge adds the counts of other
+func (u *Usage) merge(other Usage) {
+	u.ProbeBytes += other.ProbeBytes
+	u.DownloadBytes += other.DownloadBytes
+	u.UploadBytes += other.UploadBytes
+}
+
+// Day is the usage of one calendar day
+type Day struct {
+	Date string `json:"date"` // Local date, e.g. 2024-05-31
+	Usage
+	Runs int `json:"runs"`
+}
+
+// Period is the usage of one quota period
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"` // Exclusive
+	Usage
+	Runs int `json:"runs"`
+}
+
+// state is the content of the usage file
+type state struct {
+	Total Usage           `json:"total"`
+	Days  map[string]*Day `json:"days"`
+}
+
+// newState creates an empty state
+func newState() *state {
+	return &state{Days: make(map[string]*Day)}
+}
+
+// day returns the usage of date, creating it if needed
+func (s *state) day(date string) *Day {
+	d, ok := s.Days[date]
+	if !ok {
+		d = &Day{Date: date}
+		s.Days[date] = d
+	}
+	return d
+}
+
+// merge adds the counts of other
+func (s *state) merge(other *state) {
+	s.Total.merge(other.Total)
+	for date, d := range other.Days {
+		merged := s.day(date)
+		merged.Usage.merge(d.Usage)
+		merged.Runs += d.Runs
+	}
+}
+
+// Tracker accounts the traffic of test runs and persists it in the data
+// directory. Counts not saved yet are kept apart and added to the file on
+// Save, so several processes sharing a data directory do not overwrite each
+// other's usage.
+type Tracker struct {
+	mu      sync.Mutex
+	path    string
+	saved   *state // As last read from or written to disk
+	pending *state // Counted since the last save
+	run     Usage  // Counted since StartRun
+}
+
+// New creates a tracker storing its usage in dataDir
+func New(dataDir string) *Tracker {
+	t := &Tracker{
+		path:    filepath.Join(dataDir, fileName),
+		saved:   newState(),
+		pending: newState(),
+	}
+
+	saved, err := t.load()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		t.saved = saved
+	}
+	return t
+}
+
+// Add counts n bytes of kind for the current run and day
+func (t *Tracker) Add(kind Kind, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.run.add(kind, n)
+	t.pending.Total.add(kind, n)
+	t.pending.day(today()).Usage.add(kind, n)
+}
+
+// StartRun resets the run usage and counts a run for today
+func (t *Tracker) StartRun() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.run = Usage{}
+	t.pending.day(today()).Runs++
+}
+
+// RunUsage returns the usage since the last StartRun
+func (t *Tracker) RunUsage() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.run
+}
+
+// Total returns the usage of every run ever recorded
+func (t *Tracker) Total() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := t.saved.Total
+	total.merge(t.pending.Total)
+	return total
+}
+
+// Period returns the usage of the quota period containing now. Periods start
+// at midnight on resetDay of each month.
+func (t *Tracker) Period(now time.Time, resetDay int) Period {
+	start := PeriodStart(now, resetDay)
+	return t.period(start, start.AddDate(0, 1, 0))
+}
+
+// Periods returns the usage of the n quota periods up to the one containing
+// now, newest first
+func (t *Tracker) Periods(now time.Time, resetDay, n int) []Period {
+	periods := make([]Period, 0, n)
+	start := PeriodStart(now, resetDay)
+	for i := 0; i < n; i++ {
+		periods = append(periods, t.period(start, start.AddDate(0, 1, 0)))
+		start = start.AddDate(0, -1, 0)
+	}
+	return periods
+}
+
+// Days returns the recorded daily usage, oldest first
+func (t *Tracker) Days() []Day {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	merged := newState()
+	merged.merge(t.saved)
+	merged.merge(t.pending)
+
+	days := make([]Day, 0, len(merged.Days))
+	for _, d := range merged.Days {
+		days = append(days, *d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// period sums the days from start up to end
+func (t *Tracker) period(start, end time.Time) Period {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := Period{Start: start, End: end}
+	for _, s := range []*state{t.saved, t.pending} {
+		for date, d := range s.Days {
+			day, err := time.ParseInLocation(dateLayout, date, start.Location())
+			if err != nil || day.Before(start) || !day.Before(end) {
+				continue
+			}
+			p.Usage.merge(d.Usage)
+			p.Runs += d.Runs
+		}
+	}
+	return p
+}
+
+// CheckQuota returns how many bytes are left of a monthly quota, or an error
+// wrapping ErrQuotaExceeded if the quota is used up or an average run would
+// go over it. The average is taken over the current period, or over every
+// recorded day before the first run of a period.
+func (t *Tracker) CheckQuota(now time.Time, quota int64, resetDay int) (int64, error) {
+	current := t.Period(now, resetDay)
+	used := current.Total()
+	if used >= quota {
+		return 0, fmt.Errorf("%w: %s of %s used since %s", ErrQuotaExceeded,
+			FormatBytes(used), FormatBytes(quota), current.Start.Format(dateLayout))
+	}
+
+	if estimate := t.averageRun(current); used+estimate > quota {
+		return 0, fmt.Errorf("%w: %s of %s used since %s and a run uses about %s", ErrQuotaExceeded,
+			FormatBytes(used), FormatBytes(quota), current.Start.Format(dateLayout), FormatBytes(estimate))
+	}
+
+	return quota - used, nil
+}
+
+// averageRun returns the average traffic of a run in current, or of any
+// recorded run if current has none, or 0 when nothing is recorded
+func (t *Tracker) averageRun(current Period) int64 {
+	if current.Runs > 0 {
+		return current.Total() / int64(current.Runs)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var usage Usage
+	runs := 0
+	for _, s := range []*state{t.saved, t.pending} {
+		for _, d := range s.Days {
+			usage.merge(d.Usage)
+			runs += d.Runs
+		}
+	}
+	if runs == 0 {
+		return 0
+	}
+	return usage.Total() / int64(runs)
+}
+
+// Save adds the usage counted since the last save to the usage file
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Start from the file as it is now, in case another process saved to it
+	saved, err := t.load()
+	if err != nil {
+		return err
+	}
+	saved.merge(t.pending)
+
+	cutoff := time.Now().AddDate(0, 0, -keepDays).Format(dateLayout)
+	for date := range saved.Days {
+		if date < cutoff {
+			delete(saved.Days, date)
+		}
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode data usage: %w", err)
+	}
+
+	// Write to a temporary file first so a crash cannot leave a truncated file
+	tmpPath := t.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write data usage: %w", err)
+	}
+	if err := os.Rename(tmpPath, t.path); err != nil {
+		return fmt.Errorf("failed to write data usage: %w", err)
+	}
+
+	t.saved = saved
+	t.pending = newState()
+	return nil
+}
+
+// load reads the usage file, returning an empty state if there is none
+func (t *Tracker) load() (*state, error) {
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data usage: %w", err)
+	}
+
+	s := newState()
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse data usage: %w", err)
+	}
+	if s.Days == nil {
+		s.Days = make(map[string]*Day)
+	}
+	for date, d := range s.Days {
+		d.Date = date
+	}
+	return s, nil
+}
+
+// PeriodStart returns the start of the quota period containing now: midnight
+// on resetDay of this month, or of last month if that is still to come
+func PeriodStart(now time.Time, resetDay int) time.Time {
+	resetDay = min(max(resetDay, 1), 28)
+
+	start := time.Date(now.Year(), now.Month(), resetDay, 0, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// FormatBytes renders a byte count with a binary unit, e.g. "1.50 GiB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// today returns the local date key of the current day
+func today() string {
+	return time.Now().Format(dateLayout)
+}
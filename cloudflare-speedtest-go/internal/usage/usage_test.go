@@ -0,0 +1,171 @@
+package usage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.Local)
+}
+
+func TestPeriodStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		now      time.Time
+		resetDay int
+		want     time.Time
+	}{
+		{"after the reset day", date(2026, 3, 20, 9), 15, date(2026, 3, 15, 0)},
+		{"on the reset day", date(2026, 3, 15, 0), 15, date(2026, 3, 15, 0)},
+		{"before the reset day", date(2026, 3, 14, 23), 15, date(2026, 2, 15, 0)},
+		{"across the new year", date(2026, 1, 3, 12), 10, date(2025, 12, 10, 0)},
+		{"late reset days are the 28th", date(2026, 3, 1, 12), 31, date(2026, 2, 28, 0)},
+		{"unset reset day is the 1st", date(2026, 3, 1, 12), 0, date(2026, 3, 1, 0)},
+	}
+
+	for _, tt := range tests {
+		if got := PeriodStart(tt.now, tt.resetDay); !got.Equal(tt.want) {
+			t.Errorf("%s: PeriodStart(%s, %d) = %s, want %s", tt.name,
+				tt.now.Format(time.DateTime), tt.resetDay, got.Format(time.DateTime), tt.want.Format(time.DateTime))
+		}
+	}
+}
+
+// usageFile is a usage file with four runs around a reset on the 15th
+const usageFile = `{
+  "total": {"probe_bytes": 100, "download_bytes": 700},
+  "days": {
+    "2026-03-10": {"probe_bytes": 50, "download_bytes": 350, "runs": 2},
+    "2026-03-20": {"probe_bytes": 30, "download_bytes": 270, "runs": 1},
+    "2026-04-02": {"probe_bytes": 20, "download_bytes": 80, "runs": 1}
+  }
+}`
+
+func TestCheckQuota(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, fileName), []byte(usageFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracker := New(dataDir)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		quota    int64
+		resetDay int
+		wantLeft int64
+		wantErr  string
+	}{
+		// Since March 15th: 400 bytes in two runs
+		{"room for another run", date(2026, 3, 25, 12), 1000, 15, 600, ""},
+		{"no room for an average run", date(2026, 3, 25, 12), 550, 15, 0, "a run uses about 200 B"},
+		{"used up", date(2026, 3, 25, 12), 400, 15, 0, "400 B of 400 B used since 2026-03-15"},
+
+		// The period since April 15th has no runs yet, so the average is
+		// taken over all four recorded runs: 200 bytes
+		{"new period", date(2026, 4, 16, 12), 1000, 15, 1000, ""},
+		{"new period below an average run", date(2026, 4, 16, 12), 150, 15, 0, "a run uses about 200 B"},
+
+		// Resetting on the 1st, April holds one run of 100 bytes
+		{"reset on the first", date(2026, 4, 5, 12), 250, 1, 150, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, err := tracker.CheckQuota(tt.now, tt.quota, tt.resetDay)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CheckQuota() error = %v, want ErrQuotaExceeded with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || left != tt.wantLeft {
+				t.Errorf("CheckQuota() = %d, %v, want %d", left, err, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, fileName), []byte(usageFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracker := New(dataDir)
+
+	periods := tracker.Periods(date(2026, 4, 20, 8), 15, 3)
+	want := []struct {
+		start string
+		total int64
+		runs  int
+	}{
+		{"2026-04-15", 0, 0},
+		{"2026-03-15", 400, 2},
+		{"2026-02-15", 400, 2},
+	}
+
+	if len(periods) != len(want) {
+		t.Fatalf("got %d periods, want %d", len(periods), len(want))
+	}
+	for i, w := range want {
+		p := periods[i]
+		if p.Start.Format(dateLayout) != w.start || p.Total() != w.total || p.Runs != w.runs {
+			t.Errorf("period %d = %s with %d B in %d runs, want %s with %d B in %d runs",
+				i, p.Start.Format(dateLayout), p.Total(), p.Runs, w.start, w.total, w.runs)
+		}
+	}
+}
+
+func TestSaveKeepsOtherTrackers(t *testing.T) {
+	dataDir := t.TempDir()
+	first, second := New(dataDir), New(dataDir)
+
+	first.StartRun()
+	first.Add(KindDownload, 1000)
+	first.Add(KindProbe, -5) // Ignored
+	second.StartRun()
+	second.Add(KindProbe, 30)
+	second.Add(KindUpload, 200)
+
+	for _, tracker := range []*Tracker{first, second} {
+		if err := tracker.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	want := Usage{ProbeBytes: 30, DownloadBytes: 1000, UploadBytes: 200}
+	if got := New(dataDir).Total(); got != want {
+		t.Errorf("Total() after both saves = %+v, want %+v", got, want)
+	}
+	if got := second.RunUsage(); got != (Usage{ProbeBytes: 30, UploadBytes: 200}) {
+		t.Errorf("RunUsage() = %+v, want only the second run", got)
+	}
+
+	days := New(dataDir).Days()
+	if len(days) != 1 || days[0].Runs != 2 || days[0].Date != today() {
+		t.Errorf("Days() = %+v, want two runs today", days)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1024:          "1.00 KiB",
+		1536:          "1.50 KiB",
+		5 << 20:       "5.00 MiB",
+		3 << 30:       "3.00 GiB",
+		1<<40 + 1<<39: "1.50 TiB",
+	}
+
+	for n, want := range tests {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
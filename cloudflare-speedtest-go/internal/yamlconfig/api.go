@@ -0,0 +1,134 @@
+package yamlconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// FileOnlySettings are the settings that run commands or write files. They
+// are only read from the YAML file: the API neither returns nor changes them.
+type FileOnlySettings struct {
+	ExecCommand string
+	ExecArgs    []string
+	HostsPath   string
+}
+
+// FileOnly returns the file-only settings of cfg
+func (cfg *Config) FileOnly() FileOnlySettings {
+	return FileOnlySettings{
+		ExecCommand: cfg.Notify.Exec.Command,
+		ExecArgs:    slices.Clone(cfg.Notify.Exec.Args),
+		HostsPath:   cfg.Publish.Hosts.Path,
+	}
+}
+
+// SetFileOnly replaces the file-only settings of cfg
+func (cfg *Config) SetFileOnly(settings FileOnlySettings) {
+	cfg.Notify.Exec.Command = settings.ExecCommand
+	cfg.Notify.Exec.Args = slices.Clone(settings.ExecArgs)
+	cfg.Publish.Hosts.Path = settings.HostsPath
+}
+
+// Equal reports whether both hold the same settings
+func (s FileOnlySettings) Equal(other FileOnlySettings) bool {
+	return s.ExecCommand == other.ExecCommand && slices.Equal(s.ExecArgs, other.ExecArgs) &&
+		s.HostsPath == other.HostsPath
+}
+
+// Update returns a copy of cfg with the settings of data, a JSON configuration
+// that may leave out sections or fields. Left out values keep those of cfg,
+// file-only settings are never changed and redacted secrets keep their value.
+// The result still has to be validated.
+func (cfg *Config) Update(data []byte) (*Config, error) {
+	current, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy config: %w", err)
+	}
+	updated := &Config{}
+	if err := json.Unmarshal(current, updated); err != nil {
+		return nil, fmt.Errorf("failed to copy config: %w", err)
+	}
+
+	// Decoding merges maps, so maps that are sent replace the current ones
+	var sent struct {
+		Download struct {
+			URLs json.RawMessage `json:"urls"`
+		} `json:"download"`
+		Notify struct {
+			Webhook struct {
+				Headers json.RawMessage `json:"headers"`
+			} `json:"webhook"`
+		} `json:"notify"`
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if sent.Download.URLs != nil {
+		updated.Download.URLs = nil
+	}
+	if sent.Notify.Webhook.Headers != nil {
+		updated.Notify.Webhook.Headers = nil
+	}
+
+	if err := json.Unmarshal(data, updated); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	mergeWithDefaults(updated)
+	updated.SetFileOnly(cfg.FileOnly())
+	updated.KeepSecrets(cfg)
+	return updated, nil
+}
+
+// RedactedSecret replaces secrets in configurations returned by the API.
+// Sending it back in an update keeps the current secret.
+const RedactedSecret = "********"
+
+// secrets returns the secret fields of cfg
+func (cfg *Config) secrets() []*string {
+	return []*string{
+		&cfg.Publish.Cloudflare.APIToken,
+		&cfg.Publish.RFC2136.TSIGSecret,
+		&cfg.Notify.Telegram.BotToken,
+		&cfg.Notify.SMTP.Password,
+		&cfg.Export.Proxy.UUID,
+		&cfg.Export.Proxy.Password,
+	}
+}
+
+// Redacted returns a copy of cfg with its secrets and webhook header values
+// replaced by RedactedSecret
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	for _, secret := range redacted.secrets() {
+		if *secret != "" {
+			*secret = RedactedSecret
+		}
+	}
+
+	if cfg.Notify.Webhook.Headers != nil {
+		redacted.Notify.Webhook.Headers = make(map[string]string, len(cfg.Notify.Webhook.Headers))
+		for name := range cfg.Notify.Webhook.Headers {
+			redacted.Notify.Webhook.Headers[name] = RedactedSecret
+		}
+	}
+	return &redacted
+}
+
+// KeepSecrets replaces the secrets of cfg that are RedactedSecret with those
+// of current, so a configuration read from the API can be sent back as is
+func (cfg *Config) KeepSecrets(current *Config) {
+	currentSecrets := current.secrets()
+	for i, secret := range cfg.secrets() {
+		if *secret == RedactedSecret {
+			*secret = *currentSecrets[i]
+		}
+	}
+
+	for name, value := range cfg.Notify.Webhook.Headers {
+		if value == RedactedSecret {
+			cfg.Notify.Webhook.Headers[name] = current.Notify.Webhook.Headers[name]
+		}
+	}
+}
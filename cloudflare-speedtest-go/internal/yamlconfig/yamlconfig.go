@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"cloudflare-speedtest/internal/scheduler"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,6 +22,18 @@ type Config struct {
 	UI UIConfig `yaml:"ui" json:"ui"`
 	// Advanced settings
 	Advanced AdvancedConfig `yaml:"advanced" json:"advanced"`
+	// Scheduled test settings
+	Schedule ScheduleConfig `yaml:"schedule" json:"schedule"`
+	// DNS publishing settings
+	Publish PublishConfig `yaml:"publish" json:"publish"`
+	// Hosts, DNS and proxy config export settings
+	Export ExportConfig `yaml:"export" json:"export"`
+	// Run notification settings
+	Notify NotifyConfig `yaml:"notify" json:"notify"`
+	// Result scoring and qualification settings
+	Scoring ScoringConfig `yaml:"scoring" json:"scoring"`
+	// Monthly data quota settings
+	Quota QuotaConfig `yaml:"quota" json:"quota"`
 }
 
 // TestConfig represents test-related settings
@@ -32,6 +48,23 @@ type TestConfig struct {
 	DataCenterFilter  string  `yaml:"datacenter_filter" json:"datacenter_filter"`
 	ConcurrentWorkers int     `yaml:"concurrent_workers" json:"concurrent_workers"`
 	SampleInterval    int     `yaml:"sample_interval" json:"sample_interval"`
+	SpeedMode         string  `yaml:"speed_mode" json:"speed_mode"`
+	SpeedWorkers      int     `yaml:"speed_workers" json:"speed_workers"`
+	URLStrategy       string  `yaml:"url_strategy" json:"url_strategy"`
+	LatencyProbes     int     `yaml:"latency_probes" json:"latency_probes"` // Probes per IP before its download, 0 for none
+	LatencyMethod     string  `yaml:"latency_method" json:"latency_method"`
+	MaxLatencyMs      float64 `yaml:"max_latency_ms" json:"max_latency_ms"`     // Datacenter probe latency limit, 0 for none
+	TopKByLatency     int     `yaml:"top_k_by_latency" json:"top_k_by_latency"` // Speed test only the K fastest of a batch, 0 for all
+
+	// Run budgets: the run stops with a partial result set when one is used up.
+	// Zero or empty means no limit.
+	MaxRunDuration     string `yaml:"max_run_duration" json:"max_run_duration"` // Go duration, e.g. "30m"
+	MaxIPsTested       int    `yaml:"max_ips_tested" json:"max_ips_tested"`
+	MaxBytesDownloaded int64  `yaml:"max_bytes_downloaded" json:"max_bytes_downloaded"`
+
+	// Upload test, run after each successful download
+	UploadURL  string `yaml:"upload_url" json:"upload_url"`   // Endpoint the payload is POSTed to, empty to skip uploads
+	UploadTime int    `yaml:"upload_time" json:"upload_time"` // Seconds, 0 for download_time
 }
 
 // DownloadConfig represents download-related settings
@@ -49,9 +82,166 @@ type UIConfig struct {
 
 // AdvancedConfig represents advanced system settings
 type AdvancedConfig struct {
-	ConcurrentWorkers int    `yaml:"concurrent_workers" json:"concurrent_workers"`
-	LogLevel          string `yaml:"log_level" json:"log_level"`
-	EnableMetrics     bool   `yaml:"enable_metrics" json:"enable_metrics"`
+	ConcurrentWorkers    int    `yaml:"concurrent_workers" json:"concurrent_workers"`
+	ConcurrencyMode      string `yaml:"concurrency_mode" json:"concurrency_mode"`             // fixed or adaptive datacenter probe concurrency
+	MinConcurrentWorkers int    `yaml:"min_concurrent_workers" json:"min_concurrent_workers"` // Adaptive mode lower bound
+	MaxConcurrentWorkers int    `yaml:"max_concurrent_workers" json:"max_concurrent_workers"` // Adaptive mode upper bound
+	LogLevel             string `yaml:"log_level" json:"log_level"`
+	EnableMetrics        bool   `yaml:"enable_metrics" json:"enable_metrics"`
+}
+
+// ScheduleConfig represents periodic re-testing settings.
+// Exactly one of Cron and Interval is used when Enabled is set.
+type ScheduleConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	Cron     string `yaml:"cron" json:"cron"`         // Five-field cron expression, e.g. "0 */6 * * *"
+	Interval string `yaml:"interval" json:"interval"` // Go duration, e.g. "6h"
+}
+
+// PublishConfig represents settings for pointing hostnames at the best IPs
+type PublishConfig struct {
+	Enabled    bool                    `yaml:"enabled" json:"enabled"` // Publish after every completed run
+	Backend    string                  `yaml:"backend" json:"backend"` // cloudflare, rfc2136 or hosts
+	Hostnames  []string                `yaml:"hostnames" json:"hostnames"`
+	TopN       int                     `yaml:"top_n" json:"top_n"`
+	TTL        int                     `yaml:"ttl" json:"ttl"`
+	DryRun     bool                    `yaml:"dry_run" json:"dry_run"`
+	Cloudflare CloudflarePublishConfig `yaml:"cloudflare" json:"cloudflare"`
+	RFC2136    RFC2136PublishConfig    `yaml:"rfc2136" json:"rfc2136"`
+	Hosts      HostsPublishConfig      `yaml:"hosts" json:"hosts"`
+}
+
+// CloudflarePublishConfig represents Cloudflare DNS API settings
+type CloudflarePublishConfig struct {
+	APIURL   string `yaml:"api_url" json:"api_url"`
+	APIToken string `yaml:"api_token" json:"api_token"`
+	ZoneID   string `yaml:"zone_id" json:"zone_id"`
+	Proxied  bool   `yaml:"proxied" json:"proxied"`
+}
+
+// RFC2136PublishConfig represents dynamic DNS update settings
+type RFC2136PublishConfig struct {
+	Server        string `yaml:"server" json:"server"` // host:port, port defaults to 53
+	Zone          string `yaml:"zone" json:"zone"`
+	TSIGKey       string `yaml:"tsig_key" json:"tsig_key"`
+	TSIGSecret    string `yaml:"tsig_secret" json:"tsig_secret"` // Base64
+	TSIGAlgorithm string `yaml:"tsig_algorithm" json:"tsig_algorithm"`
+}
+
+// HostsPublishConfig represents hosts file settings. The path can only be
+// set in the YAML file, never through the API.
+type HostsPublishConfig struct {
+	Path string `yaml:"path" json:"-"` // Empty for the system hosts file
+}
+
+// ExportConfig represents defaults for the best-IP export formats
+type ExportConfig struct {
+	Domain string      `yaml:"domain" json:"domain"` // Hostname served through Cloudflare
+	TopN   int         `yaml:"top_n" json:"top_n"`
+	Proxy  ProxyConfig `yaml:"proxy" json:"proxy"`
+}
+
+// ProxyConfig represents the proxy server behind the Cloudflare CDN used
+// by the Clash, sing-box and Xray exports
+type ProxyConfig struct {
+	Type     string `yaml:"type" json:"type"` // vless, vmess or trojan
+	UUID     string `yaml:"uuid" json:"uuid"`
+	Password string `yaml:"password" json:"password"`
+	Port     int    `yaml:"port" json:"port"`
+	TLS      bool   `yaml:"tls" json:"tls"`
+	Network  string `yaml:"network" json:"network"` // ws or tcp
+	Path     string `yaml:"path" json:"path"`
+}
+
+// ScoringConfig represents how results are scored and which of them qualify.
+// A result qualifies when it reaches test.bandwidth, MinScore and, if set,
+// stays within LatencyCeilingMs. Unlike test.max_latency_ms, which skips IPs
+// by their datacenter probe before any download, the ceiling filters the
+// results by their measured latency.
+type ScoringConfig struct {
+	Weights              ScoringWeights `yaml:"weights" json:"weights"`
+	PreferredDataCenters []string       `yaml:"preferred_datacenters" json:"preferred_datacenters"` // Colo codes, e.g. HKG
+	MinScore             float64        `yaml:"min_score" json:"min_score"`                         // 0 to 100
+	LatencyCeilingMs     float64        `yaml:"latency_ceiling_ms" json:"latency_ceiling_ms"`       // 0 for no limit
+}
+
+// QuotaConfig represents the monthly data quota shared by every run.
+// A run is refused when the quota is used up or an average run would go over
+// it, and stops once the remaining quota is spent.
+type QuotaConfig struct {
+	MonthlyBytes int64 `yaml:"monthly_bytes" json:"monthly_bytes"` // 0 for no quota
+	ResetDay     int   `yaml:"reset_day" json:"reset_day"`         // Day of month the quota resets, 1 to 28
+}
+
+// ScoringWeights represents the weight of each term of the score.
+// Only the ratios between the weights matter.
+type ScoringWeights struct {
+	Speed      float64 `yaml:"speed" json:"speed"`
+	PeakSpeed  float64 `yaml:"peak_speed" json:"peak_speed"`
+	Latency    float64 `yaml:"latency" json:"latency"`
+	Jitter     float64 `yaml:"jitter" json:"jitter"`
+	Loss       float64 `yaml:"loss" json:"loss"`
+	DataCenter float64 `yaml:"datacenter" json:"datacenter"`
+}
+
+// NotifyConfig represents notifications sent when a run finishes.
+// Every enabled notifier receives each of the selected events.
+type NotifyConfig struct {
+	Events   []string             `yaml:"events" json:"events"` // finished, failed, best_changed
+	Retry    NotifyRetryConfig    `yaml:"retry" json:"retry"`
+	Webhook  WebhookNotifyConfig  `yaml:"webhook" json:"webhook"`
+	Telegram TelegramNotifyConfig `yaml:"telegram" json:"telegram"`
+	SMTP     SMTPNotifyConfig     `yaml:"smtp" json:"smtp"`
+	Exec     ExecNotifyConfig     `yaml:"exec" json:"exec"`
+}
+
+// NotifyRetryConfig represents how failed notifications are retried
+type NotifyRetryConfig struct {
+	MaxRetries   int    `yaml:"max_retries" json:"max_retries"`     // 0 sends each notification once
+	InitialDelay string `yaml:"initial_delay" json:"initial_delay"` // Go duration, doubled after each retry
+	MaxDelay     string `yaml:"max_delay" json:"max_delay"`
+}
+
+// WebhookNotifyConfig represents a generic JSON webhook
+type WebhookNotifyConfig struct {
+	Enabled  bool              `yaml:"enabled" json:"enabled"`
+	URL      string            `yaml:"url" json:"url"`
+	Headers  map[string]string `yaml:"headers" json:"headers"`
+	Template string            `yaml:"template" json:"template"` // Request body; empty sends the message as JSON
+}
+
+// TelegramNotifyConfig represents a Telegram bot chat
+type TelegramNotifyConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	APIURL   string `yaml:"api_url" json:"api_url"`
+	BotToken string `yaml:"bot_token" json:"bot_token"`
+	ChatID   string `yaml:"chat_id" json:"chat_id"`
+	Template string `yaml:"template" json:"template"`
+}
+
+// SMTPNotifyConfig represents email delivery. Port 465 uses implicit TLS,
+// other ports upgrade with STARTTLS when the server offers it.
+type SMTPNotifyConfig struct {
+	Enabled  bool     `yaml:"enabled" json:"enabled"`
+	Host     string   `yaml:"host" json:"host"`
+	Port     int      `yaml:"port" json:"port"`
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	From     string   `yaml:"from" json:"from"`
+	To       []string `yaml:"to" json:"to"`
+	Subject  string   `yaml:"subject" json:"subject"`   // Template
+	Template string   `yaml:"template" json:"template"` // Body template
+}
+
+// ExecNotifyConfig represents a local command run for each notification.
+// The message is written to its standard input. The command and its
+// arguments can only be set in the YAML file, never through the API.
+type ExecNotifyConfig struct {
+	Enabled  bool     `yaml:"enabled" json:"enabled"`
+	Command  string   `yaml:"command" json:"-"`
+	Args     []string `yaml:"args" json:"-"`
+	Timeout  string   `yaml:"timeout" json:"timeout"` // Go duration
+	Template string   `yaml:"template" json:"template"`
 }
 
 // DefaultConfig returns the default configuration
@@ -68,6 +258,11 @@ func DefaultConfig() *Config {
 			DataCenterFilter:  "all",
 			ConcurrentWorkers: 10,
 			SampleInterval:    1,
+			SpeedMode:         "auto",
+			SpeedWorkers:      4,
+			URLStrategy:       "round_robin",
+			LatencyProbes:     5,
+			LatencyMethod:     "tcp",
 		},
 		Download: DownloadConfig{
 			URLs: map[string]string{
@@ -84,9 +279,65 @@ func DefaultConfig() *Config {
 			Theme:            "light",
 		},
 		Advanced: AdvancedConfig{
-			ConcurrentWorkers: 10,
-			LogLevel:          "info",
-			EnableMetrics:     true,
+			ConcurrentWorkers:    10,
+			ConcurrencyMode:      "fixed",
+			MinConcurrentWorkers: 1,
+			MaxConcurrentWorkers: 100,
+			LogLevel:             "info",
+			EnableMetrics:        true,
+		},
+		Publish: PublishConfig{
+			Backend: "cloudflare",
+			TopN:    1,
+			TTL:     60,
+			Cloudflare: CloudflarePublishConfig{
+				APIURL: "https://api.cloudflare.com/client/v4",
+			},
+			RFC2136: RFC2136PublishConfig{
+				TSIGAlgorithm: "hmac-sha256",
+			},
+		},
+		Export: ExportConfig{
+			TopN: 10,
+			Proxy: ProxyConfig{
+				Type:    "vless",
+				Port:    443,
+				TLS:     true,
+				Network: "ws",
+				Path:    "/",
+			},
+		},
+		Notify: NotifyConfig{
+			Events: []string{"finished", "failed", "best_changed"},
+			Retry: NotifyRetryConfig{
+				MaxRetries:   3,
+				InitialDelay: "2s",
+				MaxDelay:     "30s",
+			},
+			Telegram: TelegramNotifyConfig{
+				APIURL: "https://api.telegram.org",
+			},
+			SMTP: SMTPNotifyConfig{
+				Port: 587,
+			},
+			Exec: ExecNotifyConfig{
+				Timeout: "30s",
+			},
+		},
+		Scoring: ScoringConfig{
+			Weights: ScoringWeights{
+				Speed:      1,
+				PeakSpeed:  0,
+				Latency:    0.5,
+				Jitter:     0.25,
+				Loss:       0.5,
+				DataCenter: 0.25,
+			},
+			PreferredDataCenters: []string{},
+		},
+		Quota: QuotaConfig{
+			MonthlyBytes: 0,
+			ResetDay:     1,
 		},
 	}
 }
@@ -159,6 +410,18 @@ func mergeWithDefaults(cfg *Config) {
 	if cfg.Test.SampleInterval == 0 {
 		cfg.Test.SampleInterval = defaults.Test.SampleInterval
 	}
+	if cfg.Test.SpeedMode == "" {
+		cfg.Test.SpeedMode = defaults.Test.SpeedMode
+	}
+	if cfg.Test.SpeedWorkers == 0 {
+		cfg.Test.SpeedWorkers = defaults.Test.SpeedWorkers
+	}
+	if cfg.Test.URLStrategy == "" {
+		cfg.Test.URLStrategy = defaults.Test.URLStrategy
+	}
+	if cfg.Test.LatencyMethod == "" {
+		cfg.Test.LatencyMethod = defaults.Test.LatencyMethod
+	}
 
 	// Merge download config
 	if cfg.Download.URLs == nil {
@@ -187,9 +450,85 @@ func mergeWithDefaults(cfg *Config) {
 	if cfg.Advanced.ConcurrentWorkers == 0 {
 		cfg.Advanced.ConcurrentWorkers = defaults.Advanced.ConcurrentWorkers
 	}
+	if cfg.Advanced.ConcurrencyMode == "" {
+		cfg.Advanced.ConcurrencyMode = defaults.Advanced.ConcurrencyMode
+	}
+	if cfg.Advanced.MinConcurrentWorkers == 0 {
+		cfg.Advanced.MinConcurrentWorkers = defaults.Advanced.MinConcurrentWorkers
+	}
+	if cfg.Advanced.MaxConcurrentWorkers == 0 {
+		cfg.Advanced.MaxConcurrentWorkers = max(defaults.Advanced.MaxConcurrentWorkers, cfg.Advanced.ConcurrentWorkers)
+	}
 	if cfg.Advanced.LogLevel == "" {
 		cfg.Advanced.LogLevel = defaults.Advanced.LogLevel
 	}
+
+	// Merge publish config
+	if cfg.Publish.Backend == "" {
+		cfg.Publish.Backend = defaults.Publish.Backend
+	}
+	if cfg.Publish.TopN == 0 {
+		cfg.Publish.TopN = defaults.Publish.TopN
+	}
+	if cfg.Publish.TTL == 0 {
+		cfg.Publish.TTL = defaults.Publish.TTL
+	}
+	if cfg.Publish.Cloudflare.APIURL == "" {
+		cfg.Publish.Cloudflare.APIURL = defaults.Publish.Cloudflare.APIURL
+	}
+	if cfg.Publish.RFC2136.TSIGAlgorithm == "" {
+		cfg.Publish.RFC2136.TSIGAlgorithm = defaults.Publish.RFC2136.TSIGAlgorithm
+	}
+
+	// Merge export config
+	if cfg.Export.TopN == 0 {
+		cfg.Export.TopN = defaults.Export.TopN
+	}
+	if cfg.Export.Proxy.Type == "" {
+		cfg.Export.Proxy.Type = defaults.Export.Proxy.Type
+	}
+	if cfg.Export.Proxy.Port == 0 {
+		cfg.Export.Proxy.Port = defaults.Export.Proxy.Port
+	}
+	if cfg.Export.Proxy.Network == "" {
+		cfg.Export.Proxy.Network = defaults.Export.Proxy.Network
+	}
+	if cfg.Export.Proxy.Path == "" {
+		cfg.Export.Proxy.Path = defaults.Export.Proxy.Path
+	}
+
+	// Merge notify config
+	if len(cfg.Notify.Events) == 0 {
+		cfg.Notify.Events = defaults.Notify.Events
+	}
+	if cfg.Notify.Retry.InitialDelay == "" {
+		cfg.Notify.Retry.InitialDelay = defaults.Notify.Retry.InitialDelay
+	}
+	if cfg.Notify.Retry.MaxDelay == "" {
+		cfg.Notify.Retry.MaxDelay = defaults.Notify.Retry.MaxDelay
+	}
+	if cfg.Notify.Telegram.APIURL == "" {
+		cfg.Notify.Telegram.APIURL = defaults.Notify.Telegram.APIURL
+	}
+	if cfg.Notify.SMTP.Port == 0 {
+		cfg.Notify.SMTP.Port = defaults.Notify.SMTP.Port
+	}
+	if cfg.Notify.Exec.Timeout == "" {
+		cfg.Notify.Exec.Timeout = defaults.Notify.Exec.Timeout
+	}
+
+	// Merge scoring config; single weights may be zero on purpose
+	if cfg.Scoring.Weights == (ScoringWeights{}) {
+		cfg.Scoring.Weights = defaults.Scoring.Weights
+	}
+	if cfg.Scoring.PreferredDataCenters == nil {
+		cfg.Scoring.PreferredDataCenters = defaults.Scoring.PreferredDataCenters
+	}
+
+	// Merge quota config
+	if cfg.Quota.ResetDay == 0 {
+		cfg.Quota.ResetDay = defaults.Quota.ResetDay
+	}
 }
 
 // Save saves configuration to YAML file
@@ -316,6 +655,133 @@ func (cfg *Config) Validate() error {
 		})
 	}
 
+	validSpeedModes := []string{"auto", "parallel", "isolation"}
+	validSpeedMode := false
+	for _, mode := range validSpeedModes {
+		if cfg.Test.SpeedMode == mode {
+			validSpeedMode = true
+			break
+		}
+	}
+	if !validSpeedMode {
+		errors = append(errors, ValidationError{
+			Field:   "test.speed_mode",
+			Value:   cfg.Test.SpeedMode,
+			Message: "must be one of: auto, parallel, isolation",
+		})
+	}
+
+	if cfg.Test.SpeedWorkers < 1 || cfg.Test.SpeedWorkers > 32 {
+		errors = append(errors, ValidationError{
+			Field:   "test.speed_workers",
+			Value:   cfg.Test.SpeedWorkers,
+			Message: "must be between 1 and 32",
+		})
+	}
+
+	validURLStrategies := []string{"round_robin", "random", "weighted"}
+	validURLStrategy := false
+	for _, strategy := range validURLStrategies {
+		if cfg.Test.URLStrategy == strategy {
+			validURLStrategy = true
+			break
+		}
+	}
+	if !validURLStrategy {
+		errors = append(errors, ValidationError{
+			Field:   "test.url_strategy",
+			Value:   cfg.Test.URLStrategy,
+			Message: "must be one of: round_robin, random, weighted",
+		})
+	}
+
+	// 0 disables the latency probes
+	if cfg.Test.LatencyProbes < 0 || cfg.Test.LatencyProbes > 50 {
+		errors = append(errors, ValidationError{
+			Field:   "test.latency_probes",
+			Value:   cfg.Test.LatencyProbes,
+			Message: "must be between 0 and 50",
+		})
+	}
+
+	validLatencyMethods := []string{"tcp", "head"}
+	validLatencyMethod := false
+	for _, method := range validLatencyMethods {
+		if cfg.Test.LatencyMethod == method {
+			validLatencyMethod = true
+			break
+		}
+	}
+	if !validLatencyMethod {
+		errors = append(errors, ValidationError{
+			Field:   "test.latency_method",
+			Value:   cfg.Test.LatencyMethod,
+			Message: "must be one of: tcp, head",
+		})
+	}
+
+	if cfg.Test.MaxLatencyMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "test.max_latency_ms",
+			Value:   cfg.Test.MaxLatencyMs,
+			Message: "must not be negative, use 0 for no limit",
+		})
+	}
+
+	if cfg.Test.TopKByLatency < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "test.top_k_by_latency",
+			Value:   cfg.Test.TopKByLatency,
+			Message: "must not be negative, use 0 to keep every IP",
+		})
+	}
+
+	if cfg.Test.MaxRunDuration != "" {
+		if d, err := time.ParseDuration(cfg.Test.MaxRunDuration); err != nil || d < 0 {
+			errors = append(errors, ValidationError{
+				Field:   "test.max_run_duration",
+				Value:   cfg.Test.MaxRunDuration,
+				Message: "must be a duration such as 30m, or empty for no limit",
+			})
+		}
+	}
+
+	if cfg.Test.MaxIPsTested < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "test.max_ips_tested",
+			Value:   cfg.Test.MaxIPsTested,
+			Message: "must not be negative, use 0 for no limit",
+		})
+	}
+
+	if cfg.Test.MaxBytesDownloaded < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "test.max_bytes_downloaded",
+			Value:   cfg.Test.MaxBytesDownloaded,
+			Message: "must not be negative, use 0 for no limit",
+		})
+	}
+
+	if cfg.Test.UploadURL != "" {
+		host, _ := strings.CutPrefix(cfg.Test.UploadURL, "http://")
+		host, _ = strings.CutPrefix(host, "https://")
+		if host == "" || strings.HasPrefix(host, "/") || strings.ContainsAny(host, " \t") {
+			errors = append(errors, ValidationError{
+				Field:   "test.upload_url",
+				Value:   cfg.Test.UploadURL,
+				Message: "must be a host and path such as speed.cloudflare.com/__up, or empty to skip uploads",
+			})
+		}
+	}
+
+	if cfg.Test.UploadTime < 0 || cfg.Test.UploadTime > 300 {
+		errors = append(errors, ValidationError{
+			Field:   "test.upload_time",
+			Value:   cfg.Test.UploadTime,
+			Message: "must be between 0 and 300 seconds, use 0 for download_time",
+		})
+	}
+
 	// Validate UI config
 	validResultFormats := []string{"table", "json", "csv"}
 	validFormat := false
@@ -358,6 +824,38 @@ func (cfg *Config) Validate() error {
 		})
 	}
 
+	validConcurrencyModes := []string{"fixed", "adaptive"}
+	validConcurrencyMode := false
+	for _, mode := range validConcurrencyModes {
+		if cfg.Advanced.ConcurrencyMode == mode {
+			validConcurrencyMode = true
+			break
+		}
+	}
+	if !validConcurrencyMode {
+		errors = append(errors, ValidationError{
+			Field:   "advanced.concurrency_mode",
+			Value:   cfg.Advanced.ConcurrencyMode,
+			Message: "must be one of: fixed, adaptive",
+		})
+	}
+
+	if cfg.Advanced.MinConcurrentWorkers < 1 || cfg.Advanced.MinConcurrentWorkers > cfg.Advanced.ConcurrentWorkers {
+		errors = append(errors, ValidationError{
+			Field:   "advanced.min_concurrent_workers",
+			Value:   cfg.Advanced.MinConcurrentWorkers,
+			Message: "must be between 1 and advanced.concurrent_workers",
+		})
+	}
+
+	if cfg.Advanced.MaxConcurrentWorkers < cfg.Advanced.ConcurrentWorkers || cfg.Advanced.MaxConcurrentWorkers > 500 {
+		errors = append(errors, ValidationError{
+			Field:   "advanced.max_concurrent_workers",
+			Value:   cfg.Advanced.MaxConcurrentWorkers,
+			Message: "must be between advanced.concurrent_workers and 500",
+		})
+	}
+
 	validLogLevels := []string{"debug", "info", "warn", "error"}
 	validLogLevel := false
 	for _, level := range validLogLevels {
@@ -374,6 +872,236 @@ func (cfg *Config) Validate() error {
 		})
 	}
 
+	// Validate schedule config
+	if cfg.Schedule.Enabled {
+		if _, err := scheduler.Parse(cfg.Schedule.Cron, cfg.Schedule.Interval); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "schedule",
+				Value:   fmt.Sprintf("cron=%q interval=%q", cfg.Schedule.Cron, cfg.Schedule.Interval),
+				Message: err.Error(),
+			})
+		}
+	}
+
+	// Validate publish config
+	validBackends := []string{"cloudflare", "rfc2136", "hosts"}
+	validBackend := false
+	for _, backend := range validBackends {
+		if cfg.Publish.Backend == backend {
+			validBackend = true
+			break
+		}
+	}
+	if !validBackend {
+		errors = append(errors, ValidationError{
+			Field:   "publish.backend",
+			Value:   cfg.Publish.Backend,
+			Message: "must be one of: cloudflare, rfc2136, hosts",
+		})
+	}
+
+	if cfg.Publish.TopN < 1 || cfg.Publish.TopN > 100 {
+		errors = append(errors, ValidationError{
+			Field:   "publish.top_n",
+			Value:   cfg.Publish.TopN,
+			Message: "must be between 1 and 100",
+		})
+	}
+
+	if cfg.Publish.TTL < 1 || cfg.Publish.TTL > 86400 {
+		errors = append(errors, ValidationError{
+			Field:   "publish.ttl",
+			Value:   cfg.Publish.TTL,
+			Message: "must be between 1 and 86400 seconds",
+		})
+	}
+
+	if cfg.Publish.Enabled && len(cfg.Publish.Hostnames) == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "publish.hostnames",
+			Value:   len(cfg.Publish.Hostnames),
+			Message: "at least one hostname is required when publishing is enabled",
+		})
+	}
+
+	// Validate export config
+	if cfg.Export.TopN < 1 || cfg.Export.TopN > 1000 {
+		errors = append(errors, ValidationError{
+			Field:   "export.top_n",
+			Value:   cfg.Export.TopN,
+			Message: "must be between 1 and 1000",
+		})
+	}
+
+	validProxyTypes := []string{"vless", "vmess", "trojan"}
+	validProxyType := false
+	for _, proxyType := range validProxyTypes {
+		if cfg.Export.Proxy.Type == proxyType {
+			validProxyType = true
+			break
+		}
+	}
+	if !validProxyType {
+		errors = append(errors, ValidationError{
+			Field:   "export.proxy.type",
+			Value:   cfg.Export.Proxy.Type,
+			Message: "must be one of: vless, vmess, trojan",
+		})
+	}
+
+	if cfg.Export.Proxy.Port < 1 || cfg.Export.Proxy.Port > 65535 {
+		errors = append(errors, ValidationError{
+			Field:   "export.proxy.port",
+			Value:   cfg.Export.Proxy.Port,
+			Message: "must be between 1 and 65535",
+		})
+	}
+
+	if cfg.Export.Proxy.Network != "ws" && cfg.Export.Proxy.Network != "tcp" {
+		errors = append(errors, ValidationError{
+			Field:   "export.proxy.network",
+			Value:   cfg.Export.Proxy.Network,
+			Message: "must be 'ws' or 'tcp'",
+		})
+	}
+
+	// Validate notify config
+	validEvents := []string{"finished", "failed", "best_changed"}
+	for _, event := range cfg.Notify.Events {
+		validEvent := false
+		for _, valid := range validEvents {
+			if event == valid {
+				validEvent = true
+				break
+			}
+		}
+		if !validEvent {
+			errors = append(errors, ValidationError{
+				Field:   "notify.events",
+				Value:   event,
+				Message: "must be one of: finished, failed, best_changed",
+			})
+		}
+	}
+
+	if cfg.Notify.Retry.MaxRetries < 0 || cfg.Notify.Retry.MaxRetries > 10 {
+		errors = append(errors, ValidationError{
+			Field:   "notify.retry.max_retries",
+			Value:   cfg.Notify.Retry.MaxRetries,
+			Message: "must be between 0 and 10",
+		})
+	}
+
+	durations := []struct{ field, value string }{
+		{"notify.retry.initial_delay", cfg.Notify.Retry.InitialDelay},
+		{"notify.retry.max_delay", cfg.Notify.Retry.MaxDelay},
+		{"notify.exec.timeout", cfg.Notify.Exec.Timeout},
+	}
+	for _, duration := range durations {
+		if d, err := time.ParseDuration(duration.value); err != nil || d <= 0 {
+			errors = append(errors, ValidationError{
+				Field:   duration.field,
+				Value:   duration.value,
+				Message: "must be a positive duration, e.g. 30s",
+			})
+		}
+	}
+
+	if cfg.Notify.Webhook.Enabled && cfg.Notify.Webhook.URL == "" {
+		errors = append(errors, ValidationError{
+			Field:   "notify.webhook.url",
+			Value:   cfg.Notify.Webhook.URL,
+			Message: "is required when the webhook is enabled",
+		})
+	}
+
+	if cfg.Notify.Telegram.Enabled && (cfg.Notify.Telegram.BotToken == "" || cfg.Notify.Telegram.ChatID == "") {
+		errors = append(errors, ValidationError{
+			Field:   "notify.telegram",
+			Value:   cfg.Notify.Telegram.ChatID,
+			Message: "bot_token and chat_id are required when Telegram is enabled",
+		})
+	}
+
+	if cfg.Notify.SMTP.Enabled && (cfg.Notify.SMTP.Host == "" || cfg.Notify.SMTP.From == "" || len(cfg.Notify.SMTP.To) == 0) {
+		errors = append(errors, ValidationError{
+			Field:   "notify.smtp",
+			Value:   cfg.Notify.SMTP.Host,
+			Message: "host, from and to are required when email is enabled",
+		})
+	}
+
+	if cfg.Notify.SMTP.Port < 1 || cfg.Notify.SMTP.Port > 65535 {
+		errors = append(errors, ValidationError{
+			Field:   "notify.smtp.port",
+			Value:   cfg.Notify.SMTP.Port,
+			Message: "must be between 1 and 65535",
+		})
+	}
+
+	if cfg.Notify.Exec.Enabled && cfg.Notify.Exec.Command == "" {
+		errors = append(errors, ValidationError{
+			Field:   "notify.exec.command",
+			Value:   cfg.Notify.Exec.Command,
+			Message: "is required when the exec hook is enabled",
+		})
+	}
+
+	// Validate scoring config
+	weights := []struct {
+		field string
+		value float64
+	}{
+		{"scoring.weights.speed", cfg.Scoring.Weights.Speed},
+		{"scoring.weights.peak_speed", cfg.Scoring.Weights.PeakSpeed},
+		{"scoring.weights.latency", cfg.Scoring.Weights.Latency},
+		{"scoring.weights.jitter", cfg.Scoring.Weights.Jitter},
+		{"scoring.weights.loss", cfg.Scoring.Weights.Loss},
+		{"scoring.weights.datacenter", cfg.Scoring.Weights.DataCenter},
+	}
+	for _, w := range weights {
+		if w.value < 0 {
+			errors = append(errors, ValidationError{
+				Field:   w.field,
+				Value:   w.value,
+				Message: "must not be negative",
+			})
+		}
+	}
+
+	if cfg.Scoring.MinScore < 0 || cfg.Scoring.MinScore > 100 {
+		errors = append(errors, ValidationError{
+			Field:   "scoring.min_score",
+			Value:   cfg.Scoring.MinScore,
+			Message: "must be between 0 and 100",
+		})
+	}
+
+	if cfg.Scoring.LatencyCeilingMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "scoring.latency_ceiling_ms",
+			Value:   cfg.Scoring.LatencyCeilingMs,
+			Message: "must not be negative, use 0 for no limit",
+		})
+	}
+
+	// Validate quota config
+	if cfg.Quota.MonthlyBytes < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "quota.monthly_bytes",
+			Value:   cfg.Quota.MonthlyBytes,
+			Message: "must not be negative, use 0 for no quota",
+		})
+	}
+
+	if cfg.Quota.ResetDay < 1 || cfg.Quota.ResetDay > 28 {
+		errors = append(errors, ValidationError{
+			Field:   "quota.reset_day",
+			Value:   cfg.Quota.ResetDay,
+			Message: "must be between 1 and 28",
+		})
+	}
+
 	// Validate download URLs
 	if len(cfg.Download.URLs) == 0 {
 		errors = append(errors, ValidationError{
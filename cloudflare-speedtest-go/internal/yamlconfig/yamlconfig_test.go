@@ -0,0 +1,91 @@
+package yamlconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadYAML loads a config file holding content
+func loadYAML(t *testing.T, content string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadAndValidate(path)
+	if err != nil {
+		t.Fatalf("LoadAndValidate() error = %v", err)
+	}
+	return cfg
+}
+
+func TestLoadDefaultsAndZeroValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "latency probes default",
+			yaml: "test:\n  bandwidth: 50\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Test.LatencyProbes != 5 {
+					t.Errorf("latency_probes = %d, want the default 5", cfg.Test.LatencyProbes)
+				}
+			},
+		},
+		{
+			name: "latency probes disabled",
+			yaml: "test:\n  latency_probes: 0\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Test.LatencyProbes != 0 {
+					t.Errorf("latency_probes = %d, want 0 to disable them", cfg.Test.LatencyProbes)
+				}
+			},
+		},
+		{
+			name: "notify retries default",
+			yaml: "notify:\n  retry:\n    initial_delay: 1s\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Notify.Retry.MaxRetries != 3 || cfg.Notify.Retry.InitialDelay != "1s" {
+					t.Errorf("retry = %+v, want the default 3 retries after 1s", cfg.Notify.Retry)
+				}
+			},
+		},
+		{
+			name: "notify retries disabled",
+			yaml: "notify:\n  retry:\n    max_retries: 0\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Notify.Retry.MaxRetries != 0 || cfg.Notify.Retry.MaxDelay != "30s" {
+					t.Errorf("retry = %+v, want no retries and the default max_delay", cfg.Notify.Retry)
+				}
+			},
+		},
+		{
+			name: "parallel speed workers by default",
+			yaml: "test:\n  speed_mode: auto\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Test.SpeedWorkers != 4 {
+					t.Errorf("speed_workers = %d, want the default 4 so auto can go parallel", cfg.Test.SpeedWorkers)
+				}
+			},
+		},
+		{
+			name: "fixed probe concurrency by default",
+			yaml: "advanced:\n  concurrent_workers: 4\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Advanced.ConcurrencyMode != "fixed" {
+					t.Errorf("concurrency_mode = %q, want fixed", cfg.Advanced.ConcurrencyMode)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, loadYAML(t, tt.yaml))
+		})
+	}
+}
@@ -21,6 +21,21 @@ func main() {
 	}
 	exeDir := filepath.Dir(exePath)
 
+	// Dispatch subcommands; no subcommand starts the web server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(exeDir, os.Args[2:]))
+		case "publish":
+			os.Exit(publishCommand(exeDir, os.Args[2:]))
+		case "serve":
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
+			fmt.Fprintf(os.Stderr, "Usage: %s [serve|run|publish] [flags]\n", filepath.Base(exePath))
+			os.Exit(exitError)
+		}
+	}
+
 	// Load or create configuration
 	configPath := filepath.Join(exeDir, "config.yaml")
 	cfg, err := yamlconfig.LoadAndValidate(configPath)
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"math"
+	"sort"
+)
+
+// LatencyStats summarizes repeated latency probes of one IP. Times are in
+// milliseconds and Loss is the percentage of probes that got no answer.
+type LatencyStats struct {
+	Method   string  `json:"method"`
+	Probes   int     `json:"probes"`
+	Received int     `json:"received"`
+	Min      float64 `json:"min_ms"`
+	Avg      float64 `json:"avg_ms"`
+	Median   float64 `json:"median_ms"`
+	P95      float64 `json:"p95_ms"`
+	Jitter   float64 `json:"jitter_ms"` // Standard deviation
+	Loss     float64 `json:"loss_percent"`
+}
+
+// NewLatencyStats computes the statistics of the answered probes in samples
+// out of probes sent
+func NewLatencyStats(method string, probes int, samples []float64) *LatencyStats {
+	stats := &LatencyStats{Method: method, Probes: probes, Received: len(samples)}
+	if probes > 0 {
+		stats.Loss = float64(probes-len(samples)) / float64(probes) * 100
+	}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+
+	total := 0.0
+	for _, s := range sorted {
+		total += s
+	}
+	stats.Min = sorted[0]
+	stats.Avg = total / float64(len(sorted))
+	stats.Median = percentile(sorted, 50)
+	stats.P95 = percentile(sorted, 95)
+
+	variance := 0.0
+	for _, s := range sorted {
+		variance += (s - stats.Avg) * (s - stats.Avg)
+	}
+	stats.Jitter = math.Sqrt(variance / float64(len(sorted)))
+
+	return stats
+}
+
+// Score combines the statistics into one effective latency in milliseconds,
+// lower is better. Jitter is added to the median and the sum is scaled up by
+// the loss, so a steady IP beats one that is fast only some of the time.
+// An IP that answered no probe scores +Inf.
+func (s *LatencyStats) Score() float64 {
+	if s.Received == 0 {
+		return math.Inf(1)
+	}
+	return (s.Median + s.Jitter) / (1 - s.Loss/100)
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating
+// linearly between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -1,13 +1,200 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
 // SpeedTestResult represents a single speed test result
 type SpeedTestResult struct {
 	IP         string
-	Status     string // 待测试, 检测数据中心, 测试中, 已完成, 无效, 跳过
-	Latency    string // ms
-	Speed      string // Mbps
-	DataCenter string
+	Status     Status
+	Latency    float64 // ms, the median of LatencyStats when it is set
+	Speed      float64 // Mbps
 	PeakSpeed  float64 // Mbps
+	DataCenter string
+	Error      string        // Why the speed test failed, empty on success
+	TTFB       time.Duration // Time from sending the download request to the first body byte
+	Bytes      int64         // Bytes transferred during the download
+	TestedAt   time.Time
+
+	UploadSpeed float64 // Mbps, 0 if the upload was not measured
+	UploadBytes int64   // Bytes sent during the upload
+
+	Score        float64           // 0 to 100, see internal/scoring
+	LatencyStats *LatencyStats     // Repeated latency probes, nil if not measured
+	Timing       *ConnectionTiming // Phases of the download request, nil if it failed
+}
+
+// EffectiveLatency returns the combined latency score used for ranking, or
+// the single latency sample if no repeated probes were made
+func (r *SpeedTestResult) EffectiveLatency() float64 {
+	if r.LatencyStats != nil {
+		return r.LatencyStats.Score()
+	}
+	return r.Latency
+}
+
+// LatencyString formats the latency the way exports have always shown it
+func (r *SpeedTestResult) LatencyString() string {
+	return fmt.Sprintf("%.2f", r.Latency)
+}
+
+// SpeedString formats the speed the way exports have always shown it,
+// using "timeout" for failed downloads
+func (r *SpeedTestResult) SpeedString() string {
+	if r.Error != "" {
+		return "timeout"
+	}
+	return fmt.Sprintf("%.2f", r.Speed)
+}
+
+// resultJSON is the wire format of SpeedTestResult. Latency and Speed keep
+// their original string encoding; the numeric values are added alongside.
+type resultJSON struct {
+	IP          string
+	Status      Status
+	StatusLabel string
+	Latency     json.RawMessage
+	Speed       json.RawMessage
+	DataCenter  string
+	PeakSpeed   float64
+	LatencyMs   *float64   `json:",omitempty"`
+	SpeedMbps   *float64   `json:",omitempty"`
+	TTFBMs      float64    `json:",omitempty"`
+	Bytes       int64      `json:",omitempty"`
+	UploadSpeed float64    `json:",omitempty"`
+	UploadBytes int64      `json:",omitempty"`
+	Error       string     `json:",omitempty"`
+	TestedAt    *time.Time `json:",omitempty"`
+
+	Score        float64
+	LatencyStats *LatencyStats     `json:",omitempty"`
+	Timing       *ConnectionTiming `json:",omitempty"`
+}
+
+// MarshalJSON encodes the result in the backward compatible wire format
+// with status labels in the default language
+func (r SpeedTestResult) MarshalJSON() ([]byte, error) {
+	return r.marshalJSON(DefaultLanguage)
+}
+
+// marshalJSON encodes the result with status labels in lang
+func (r SpeedTestResult) marshalJSON(lang string) ([]byte, error) {
+	latency, _ := json.Marshal(r.LatencyString())
+	speed, _ := json.Marshal(r.SpeedString())
+
+	out := resultJSON{
+		IP:          r.IP,
+		Status:      r.Status,
+		StatusLabel: r.Status.Label(lang),
+		Latency:     latency,
+		Speed:       speed,
+		DataCenter:  r.DataCenter,
+		PeakSpeed:   r.PeakSpeed,
+		LatencyMs:   &r.Latency,
+		SpeedMbps:   &r.Speed,
+		TTFBMs:      float64(r.TTFB) / float64(time.Millisecond),
+		Bytes:       r.Bytes,
+		UploadSpeed: r.UploadSpeed,
+		UploadBytes: r.UploadBytes,
+		Error:       r.Error,
+
+		Score:        r.Score,
+		LatencyStats: r.LatencyStats,
+		Timing:       r.Timing,
+	}
+	if !r.TestedAt.IsZero() {
+		out.TestedAt = &r.TestedAt
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes both the current wire format and results written
+// before the numeric fields existed
+func (r *SpeedTestResult) UnmarshalJSON(data []byte) error {
+	var in resultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*r = SpeedTestResult{
+		IP:         in.IP,
+		Status:     ParseStatus(string(in.Status)),
+		PeakSpeed:  in.PeakSpeed,
+		DataCenter: in.DataCenter,
+		TTFB:       time.Duration(in.TTFBMs * float64(time.Millisecond)),
+		Bytes:      in.Bytes,
+		Error:      in.Error,
+
+		UploadSpeed: in.UploadSpeed,
+		UploadBytes: in.UploadBytes,
+
+		Score:        in.Score,
+		LatencyStats: in.LatencyStats,
+		Timing:       in.Timing,
+	}
+	if in.TestedAt != nil {
+		r.TestedAt = *in.TestedAt
+	}
+
+	if in.LatencyMs != nil {
+		r.Latency = *in.LatencyMs
+	} else {
+		r.Latency, _ = parseLegacyNumber(in.Latency)
+	}
+
+	if in.SpeedMbps != nil {
+		r.Speed = *in.SpeedMbps
+	} else if speed, ok := parseLegacyNumber(in.Speed); ok {
+		r.Speed = speed
+	} else if r.Error == "" && len(in.Speed) > 0 {
+		// Old results stored "timeout" in place of the speed
+		r.Error = "timeout"
+	}
+
+	return nil
+}
+
+// LocalizedResult encodes a result with status labels in a chosen language
+type LocalizedResult struct {
+	*SpeedTestResult
+	Lang string
+}
+
+// MarshalJSON encodes the result with status labels in Lang
+func (r LocalizedResult) MarshalJSON() ([]byte, error) {
+	return r.SpeedTestResult.marshalJSON(r.Lang)
+}
+
+// Localize wraps results so they encode with status labels in lang
+func Localize(results []*SpeedTestResult, lang string) []LocalizedResult {
+	localized := make([]LocalizedResult, len(results))
+	for i, result := range results {
+		localized[i] = LocalizedResult{SpeedTestResult: result, Lang: lang}
+	}
+	return localized
+}
+
+// parseLegacyNumber reads a value encoded either as a JSON number or as a numeric string
+func parseLegacyNumber(raw json.RawMessage) (float64, bool) {
+	var value float64
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, true
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
 }
 
 // TestConfig holds the test configuration
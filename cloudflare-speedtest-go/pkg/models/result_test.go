@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// legacyResults are results as they were saved before latency and speed
+// became numbers: strings for both, "timeout" in place of a failed speed and
+// Chinese status labels
+const legacyResults = `[
+  {"IP": "104.16.1.1", "Status": "已完成", "Latency": "123.45", "Speed": "56.78", "DataCenter": "Hong Kong (HKG)", "PeakSpeed": 61.5},
+  {"IP": "104.16.1.2", "Status": "无效", "Latency": "88.10", "Speed": "timeout", "DataCenter": "SJC", "PeakSpeed": 0},
+  {"IP": "104.16.1.3", "Status": "跳过", "Latency": "0", "Speed": "0.00", "DataCenter": ""},
+  {"IP": "104.16.1.4", "Status": "测试中", "Latency": 42, "Speed": "7"}
+]`
+
+func TestUnmarshalLegacyResults(t *testing.T) {
+	var got []SpeedTestResult
+	if err := json.Unmarshal([]byte(legacyResults), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := []SpeedTestResult{
+		{IP: "104.16.1.1", Status: StatusCompleted, Latency: 123.45, Speed: 56.78, DataCenter: "Hong Kong (HKG)", PeakSpeed: 61.5},
+		{IP: "104.16.1.2", Status: StatusInvalid, Latency: 88.10, Error: "timeout", DataCenter: "SJC"},
+		{IP: "104.16.1.3", Status: StatusSkipped},
+		{IP: "104.16.1.4", Status: StatusTesting, Latency: 42, Speed: 7},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("result %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// A failed speed reads back the way it was written
+	if s := got[1].SpeedString(); s != "timeout" {
+		t.Errorf("SpeedString() of a legacy timeout = %q, want timeout", s)
+	}
+}
+
+func TestResultJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		result SpeedTestResult
+	}{
+		{
+			name: "completed with every field",
+			result: SpeedTestResult{
+				IP:          "2606:4700::6810:1",
+				Status:      StatusUnqualified,
+				Latency:     35.125,
+				Speed:       187.5,
+				PeakSpeed:   210.25,
+				DataCenter:  "Tokyo (NRT)",
+				TTFB:        145 * time.Millisecond,
+				Bytes:       98 << 20,
+				TestedAt:    time.Date(2026, 4, 2, 8, 30, 15, 0, time.UTC),
+				UploadSpeed: 42.5,
+				UploadBytes: 20 << 20,
+				Score:       71.25,
+				LatencyStats: &LatencyStats{
+					Method: "tcp", Probes: 5, Received: 4,
+					Min: 30, Avg: 36.5, Median: 35.125, P95: 44, Jitter: 5.5, Loss: 20,
+				},
+				Timing: &ConnectionTiming{
+					Connect:      31 * time.Millisecond,
+					TLSHandshake: 64 * time.Millisecond,
+					FirstByte:    50 * time.Millisecond,
+					Transfer:     10 * time.Second,
+				},
+			},
+		},
+		{
+			name: "failed download",
+			result: SpeedTestResult{
+				IP:         "104.16.2.2",
+				Status:     StatusInvalid,
+				Latency:    99.5,
+				DataCenter: "LAX",
+				Error:      "speed test failed: no data received",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			var got SpeedTestResult
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.result) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.result)
+			}
+
+			// Older readers still find the string fields
+			var wire struct{ Latency, Speed string }
+			if err := json.Unmarshal(data, &wire); err != nil {
+				t.Fatalf("Unmarshal() into the legacy fields error = %v", err)
+			}
+			if wire.Latency != tt.result.LatencyString() || wire.Speed != tt.result.SpeedString() {
+				t.Errorf("legacy fields = %q, %q, want %q, %q",
+					wire.Latency, wire.Speed, tt.result.LatencyString(), tt.result.SpeedString())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+)
+
+// Status is the machine-readable state of a tested IP.
+// The codes are stable and safe for API clients to match on.
+type Status string
+
+const (
+	StatusPending     Status = "pending"
+	StatusDetecting   Status = "detecting"
+	StatusTesting     Status = "testing"
+	StatusCompleted   Status = "completed"
+	StatusSlow        Status = "slow"
+	StatusUnqualified Status = "unqualified" // Fast enough but below the score or latency threshold
+	StatusInvalid     Status = "invalid"
+	StatusSkipped     Status = "skipped"
+)
+
+// DefaultLanguage is used for status labels when no supported language is requested
+const DefaultLanguage = "zh"
+
+// statusLabels holds the display label of every status per language
+var statusLabels = map[string]map[Status]string{
+	"zh": {
+		StatusPending:     "待测试",
+		StatusDetecting:   "检测数据中心",
+		StatusTesting:     "测试中",
+		StatusCompleted:   "已完成",
+		StatusSlow:        "低速",
+		StatusUnqualified: "未达标",
+		StatusInvalid:     "无效",
+		StatusSkipped:     "跳过",
+	},
+	"en": {
+		StatusPending:     "Pending",
+		StatusDetecting:   "Detecting data center",
+		StatusTesting:     "Testing",
+		StatusCompleted:   "Completed",
+		StatusSlow:        "Slow",
+		StatusUnqualified: "Below threshold",
+		StatusInvalid:     "Invalid",
+		StatusSkipped:     "Skipped",
+	},
+}
+
+// Label returns the display label of the status in lang, falling back to
+// the default language and finally to the status code itself
+func (s Status) Label(lang string) string {
+	if label, ok := statusLabels[lang][s]; ok {
+		return label
+	}
+	if label, ok := statusLabels[DefaultLanguage][s]; ok {
+		return label
+	}
+	return string(s)
+}
+
+// ParseStatus converts a status code or a label in any supported language to a Status
+func ParseStatus(value string) Status {
+	if _, ok := statusLabels[DefaultLanguage][Status(value)]; ok {
+		return Status(value)
+	}
+
+	for _, labels := range statusLabels {
+		for status, label := range labels {
+			if label == value {
+				return status
+			}
+		}
+	}
+
+	return Status(value)
+}
+
+// MatchLanguage picks the first supported language from a ?lang= value or an
+// Accept-Language header such as "en-US,en;q=0.9,zh;q=0.8"
+func MatchLanguage(accept string) string {
+	for _, tag := range strings.Split(accept, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		base, _, _ := strings.Cut(tag, "-")
+
+		if _, ok := statusLabels[base]; ok {
+			return base
+		}
+	}
+
+	return DefaultLanguage
+}
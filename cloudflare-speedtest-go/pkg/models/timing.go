@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ConnectionTiming breaks a download request down into its phases, so a slow
+// handshake can be told apart from slow throughput. Phases that did not
+// happen, like the TLS handshake of a plain HTTP request, are zero.
+type ConnectionTiming struct {
+	Connect      time.Duration // TCP handshake
+	TLSHandshake time.Duration
+	FirstByte    time.Duration // From the request being written to the first response byte
+	Transfer     time.Duration // From the first response byte to the end of the download
+}
+
+// timingJSON is the wire format of ConnectionTiming, in milliseconds
+type timingJSON struct {
+	ConnectMs      float64 `json:"connect_ms"`
+	TLSHandshakeMs float64 `json:"tls_handshake_ms"`
+	FirstByteMs    float64 `json:"first_byte_ms"`
+	TransferMs     float64 `json:"transfer_ms"`
+}
+
+// MarshalJSON encodes the phases in milliseconds
+func (t ConnectionTiming) MarshalJSON() ([]byte, error) {
+	return json.Marshal(timingJSON{
+		ConnectMs:      durationMs(t.Connect),
+		TLSHandshakeMs: durationMs(t.TLSHandshake),
+		FirstByteMs:    durationMs(t.FirstByte),
+		TransferMs:     durationMs(t.Transfer),
+	})
+}
+
+// UnmarshalJSON decodes phases given in milliseconds
+func (t *ConnectionTiming) UnmarshalJSON(data []byte) error {
+	var in timingJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*t = ConnectionTiming{
+		Connect:      msDuration(in.ConnectMs),
+		TLSHandshake: msDuration(in.TLSHandshakeMs),
+		FirstByte:    msDuration(in.FirstByteMs),
+		Transfer:     msDuration(in.TransferMs),
+	}
+	return nil
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// msDuration converts fractional milliseconds to a duration
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -1,4 +1,7 @@
 const API = {
+    // Status labels follow the page language rather than the browser's
+    lang: document.documentElement.lang || 'zh',
+
     async getConfig() {
         const response = await fetch('/api/config');
         if (!response.ok) throw new Error('Failed to load config');
@@ -46,7 +49,10 @@ const API = {
 
     async startTest() {
         const response = await fetch('/api/start', { method: 'POST' });
-        if (!response.ok) throw new Error('Failed to start test');
+        if (!response.ok) {
+            const errorData = await response.json().catch(() => ({}));
+            throw new Error(errorData.error || 'Failed to start test');
+        }
     },
 
     async stopTest() {
@@ -69,6 +75,14 @@ const API = {
         return response.json();
     },
 
+    subscribeEvents(handlers) {
+        const source = new EventSource(`/api/events?lang=${this.lang}`);
+        for (const [type, handler] of Object.entries(handlers)) {
+            source.addEventListener(type, e => handler(JSON.parse(e.data)));
+        }
+        return source;
+    },
+
     async getStatus() {
         const response = await fetch('/api/status');
         if (!response.ok) throw new Error('Failed to get status');
@@ -82,19 +96,19 @@ const API = {
     },
 
     async getResults() {
-        const response = await fetch('/api/results');
+        const response = await fetch(`/api/results?lang=${this.lang}`);
         if (!response.ok) throw new Error('Failed to fetch results');
         return response.json();
     },
 
     async getSortedResults(sort, order) {
-        const response = await fetch(`/api/results/sorted?sort=${sort}&order=${order}`);
+        const response = await fetch(`/api/results/sorted?sort=${sort}&order=${order}&lang=${this.lang}`);
         if (!response.ok) throw new Error('Failed to load sorted results');
         return response.json();
     },
 
     async getQualifiedResults() {
-        const response = await fetch('/api/results/qualified');
+        const response = await fetch(`/api/results/qualified?lang=${this.lang}`);
         if (!response.ok) throw new Error('Failed to load qualified results');
         return response.json();
     },
@@ -128,5 +142,10 @@ const API = {
     async getPerformanceMetrics() {
         const response = await fetch('/api/metrics/performance');
         return response.ok ? response.json() : null;
+    },
+
+    async getUsage() {
+        const response = await fetch('/api/usage');
+        return response.ok ? response.json() : null;
     }
 };
@@ -10,6 +10,8 @@ let testStartTime = null;
 let testTimeoutId = null;
 let lastProgressUpdate = null;
 let finalResultsFetched = false;
+let eventSource = null;
+let statusCheckId = null;
 
 // Helpers
 function parseAndSortDatacenters(rawDatacenters) {
@@ -46,8 +48,11 @@ window.startTestWithAutoSave = async function () {
 
         const selectedDatacenters = Array.from(document.querySelectorAll('input[name="datacenter"]:checked')).map(cb => cb.value);
 
+        // Start from the loaded config so settings without form fields are preserved
         const config = {
+            ...currentConfig,
             test: {
+                ...currentConfig.test,
                 expected_servers: parseInt(document.getElementById('expectedServers').value) || 3,
                 use_tls: document.getElementById('useTLS').checked,
                 ip_type: document.getElementById('ipType').value || 'ipv4',
@@ -57,15 +62,30 @@ window.startTestWithAutoSave = async function () {
                 file_path: './',
                 datacenter_filter: document.getElementById('datacenterMode').value || 'all',
                 concurrent_workers: parseInt(document.getElementById('concurrentWorkers').value) || 10,
-                sample_interval: 1
+                sample_interval: 1,
+                speed_mode: document.getElementById('speedMode').value || 'auto',
+                speed_workers: parseInt(document.getElementById('speedWorkers').value) || 4,
+                url_strategy: document.getElementById('urlStrategy').value || 'round_robin',
+                latency_probes: parseInt(document.getElementById('latencyProbes').value) || 0,
+                latency_method: document.getElementById('latencyMethod').value || 'tcp',
+                max_latency_ms: parseFloat(document.getElementById('maxLatencyMs').value) || 0,
+                top_k_by_latency: parseInt(document.getElementById('topKByLatency').value) || 0,
+                max_run_duration: document.getElementById('maxRunDuration').value.trim(),
+                max_ips_tested: parseInt(document.getElementById('maxIpsTested').value) || 0,
+                max_bytes_downloaded: Math.round((parseFloat(document.getElementById('maxMbDownloaded').value) || 0) * 1024 * 1024),
+                upload_url: document.getElementById('uploadUrl').value.trim(),
+                upload_time: parseInt(document.getElementById('uploadTime').value) || 0
             },
             download: { urls },
             ui: {
+                ...currentConfig.ui,
                 datacenter_filter: document.getElementById('datacenterMode').value || 'all',
                 result_format: 'table', auto_refresh: true, theme: 'light'
             },
             advanced: {
+                ...currentConfig.advanced,
                 concurrent_workers: parseInt(document.getElementById('concurrentWorkers').value) || 10,
+                concurrency_mode: document.getElementById('concurrencyMode').value || 'fixed',
                 log_level: 'info',
                 enable_metrics: document.getElementById('enableMetrics').checked
             }
@@ -75,6 +95,7 @@ window.startTestWithAutoSave = async function () {
         if (!validateResult.valid) throw new Error(validateResult.error || '配置验证失败');
 
         await API.updateConfig(config);
+        currentConfig = config;
         await API.updateDatacenterFilter(config.ui.datacenter_filter, selectedDatacenters);
         await API.saveConfig();
 
@@ -110,9 +131,8 @@ async function startTest() {
     }
 
     try {
+        subscribeToEvents();
         await API.startTest();
-        pollResults();
-        pollStats();
     } catch (error) {
         console.error('Error:', error);
         UI.showAlert('启动测试失败: ' + error.message);
@@ -136,6 +156,8 @@ function stopTestUI() {
     UI.setButtonDisabled('stopBtn', true);
     UI.updateElementText('testStatus', '已停止');
     if (metricsInterval) { clearInterval(metricsInterval); metricsInterval = null; }
+    if (eventSource) { eventSource.close(); eventSource = null; }
+    if (statusCheckId) { clearTimeout(statusCheckId); statusCheckId = null; }
 }
 
 window.clearResults = async function () {
@@ -188,16 +210,21 @@ window.exportResults = async function () {
     const sort = document.getElementById('exportSort').value;
     const ascending = document.getElementById('exportAscending').checked;
     const order = ascending ? 'asc' : 'desc';
-    const url = `/api/results/export/${format}?sort=${sort}&order=${order}`;
+    const url = `/api/results/export/${format}?sort=${sort}&order=${order}&lang=${API.lang}`;
 
     try {
         const response = await fetch(url);
-        if (!response.ok) throw new Error('Export failed');
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || 'Export failed');
+        }
         const blob = await response.blob();
         const downloadUrl = window.URL.createObjectURL(blob);
         const a = document.createElement('a');
         a.href = downloadUrl;
-        a.download = `cloudflare-speedtest-${new Date().toISOString().slice(0, 19).replace(/:/g, '-')}.${format}`;
+        const disposition = response.headers.get('Content-Disposition') || '';
+        const match = disposition.match(/filename=(.+)$/);
+        a.download = match ? match[1] : `cloudflare-speedtest-${new Date().toISOString().slice(0, 19).replace(/:/g, '-')}.${format}`;
         document.body.appendChild(a);
         a.click();
         document.body.removeChild(a);
@@ -306,6 +333,20 @@ async function updatePerformanceStats() {
     } catch (error) { console.error(error); }
 }
 
+async function updateUsage() {
+    try {
+        const data = await API.getUsage();
+        if (!data) return;
+        const used = data.current_period.probe_bytes + data.current_period.download_bytes;
+        let text = (used / 1024 / 1024).toFixed(2) + ' MB';
+        if (data.quota_bytes > 0) {
+            text += ' / ' + (data.quota_bytes / 1024 / 1024).toFixed(0) + ' MB';
+            if (data.quota_exceeded) text += ' (已超额)';
+        }
+        UI.updateElementText('monthlyUsage', text);
+    } catch (error) { console.error(error); }
+}
+
 async function checkStatus() {
     try {
         const status = await API.getStatus();
@@ -330,6 +371,82 @@ async function loadDatacenters() {
     } catch (error) { console.error(error); }
 }
 
+function subscribeToEvents() {
+    if (eventSource) eventSource.close();
+    results = [];
+    eventSource = API.subscribeEvents({
+        batch_started: ev => UI.updateElementText('testStatus', `测试中: 第 ${ev.batch} 批 (${ev.count} 个IP)`),
+        probe_result: ev => { if (!ev.error) UI.updateElementText('testStatus', `检测数据中心: ${ev.ip}`); },
+        speed_sample: ev => {
+            UI.updateElementText('testStatus', `测试中: ${ev.ip}`);
+            UI.updateElementText('currentSpeed', ev.speed.toFixed(2) + ' Mbps');
+            if (speedChart) speedChart.addPoint(ev.speed, new Date(ev.time));
+        },
+        result_stored: ev => {
+            results.push(ev.result);
+            lastProgressUpdate = Date.now();
+            UI.renderResults('resultsContainer', results);
+            updateStats();
+        },
+        run_finished: ev => finishRun(ev.summary)
+    });
+    let opened = false;
+    eventSource.onopen = () => {
+        // The server drops clients that fall behind; after the reconnect the
+        // missed events, run_finished among them, are caught up from the API
+        if (opened) catchUp();
+        opened = true;
+    };
+    eventSource.onerror = () => {
+        // Fall back to polling if the event stream is unavailable
+        if (isTesting && eventSource && eventSource.readyState === EventSource.CLOSED) {
+            eventSource = null;
+            pollResults();
+            pollStats();
+        }
+    };
+}
+
+// finishRun shows the final results of a run. summary is null when the
+// run_finished event was missed and the reason is unknown.
+async function finishRun(summary) {
+    const reason = summary ? summary.reason : '';
+    stopTestUI();
+    const completed = reason === 'completed' || reason === 'verified';
+    const budgetExhausted = reason === 'budget_exhausted';
+    UI.updateElementText('testStatus', completed ? '已完成' : budgetExhausted ? '已停止 (预算用尽)' : summary ? '已停止' : '已结束');
+    const final = await API.getResults();
+    results = final || [];
+    UI.renderResults('resultsContainer', results);
+    updateStats();
+    updateUsage();
+}
+
+// catchUp reloads the results after the event stream reconnected and checks
+// the run status until the run is over
+async function catchUp() {
+    try {
+        results = await API.getResults() || [];
+        UI.renderResults('resultsContainer', results);
+        updateStats();
+    } catch (error) { console.error(error); }
+    checkRunStatus();
+}
+
+async function checkRunStatus() {
+    if (statusCheckId) { clearTimeout(statusCheckId); statusCheckId = null; }
+    if (!isTesting) return;
+    try {
+        const status = await API.getStatus();
+        if (!status.testing) {
+            if (isTesting) await finishRun(null);
+            return;
+        }
+    } catch (error) { console.error(error); }
+    // The server stays busy briefly after run_finished, e.g. to publish
+    statusCheckId = setTimeout(checkRunStatus, 3000);
+}
+
 async function pollResults() {
     try {
         const data = await API.getResults();
@@ -371,9 +488,9 @@ async function pollStats() {
 
 function updateStats() {
     const expectedServers = currentConfig.test?.expected_servers || 3;
-    const completed = results.filter(r => r.Status === '已完成').length;
+    const completed = results.filter(r => r.Status === 'completed').length;
     UI.updateElementText('progress', `${completed}/${expectedServers}`);
-    const speeds = results.filter(r => r.Status === '已完成' && r.Speed !== '-').map(r => parseFloat(r.Speed));
+    const speeds = results.filter(r => r.Status === 'completed' && r.Speed !== '-').map(r => parseFloat(r.Speed));
     if (speeds.length > 0) {
         UI.updateElementText('avgSpeed', (speeds.reduce((a, b) => a + b, 0) / speeds.length).toFixed(2) + ' Mbps');
         UI.updateElementText('currentSpeed', speeds[speeds.length - 1].toFixed(2) + ' Mbps');
@@ -391,6 +508,19 @@ window.addEventListener('load', async () => {
         document.getElementById('timeout').value = currentConfig.test?.timeout || 5;
         document.getElementById('downloadTime').value = currentConfig.test?.download_time || 10;
         document.getElementById('concurrentWorkers').value = currentConfig.advanced?.concurrent_workers || 10;
+        document.getElementById('concurrencyMode').value = currentConfig.advanced?.concurrency_mode || 'fixed';
+        document.getElementById('speedMode').value = currentConfig.test?.speed_mode || 'auto';
+        document.getElementById('speedWorkers').value = currentConfig.test?.speed_workers || 4;
+        document.getElementById('urlStrategy').value = currentConfig.test?.url_strategy || 'round_robin';
+        document.getElementById('latencyProbes').value = currentConfig.test?.latency_probes ?? 5;
+        document.getElementById('latencyMethod').value = currentConfig.test?.latency_method || 'tcp';
+        document.getElementById('maxLatencyMs').value = currentConfig.test?.max_latency_ms || 0;
+        document.getElementById('topKByLatency').value = currentConfig.test?.top_k_by_latency || 0;
+        document.getElementById('maxRunDuration').value = currentConfig.test?.max_run_duration || '';
+        document.getElementById('maxIpsTested').value = currentConfig.test?.max_ips_tested || 0;
+        document.getElementById('maxMbDownloaded').value = (currentConfig.test?.max_bytes_downloaded || 0) / 1024 / 1024;
+        document.getElementById('uploadUrl').value = currentConfig.test?.upload_url || '';
+        document.getElementById('uploadTime').value = currentConfig.test?.upload_time || 0;
         document.getElementById('enableMetrics').checked = currentConfig.advanced?.enable_metrics || false;
         document.getElementById('datacenterMode').value = currentConfig.ui?.datacenter_filter || 'all';
 
@@ -398,6 +528,7 @@ window.addEventListener('load', async () => {
         await loadDatacenters();
         UI.renderResults('resultsContainer', []);
         checkStatus();
+        updateUsage();
 
         // Setup event listeners for sorting elements after they are confirmed to exist
         document.getElementById('datacenterMode').addEventListener('change', window.toggleDatacenterSelection);
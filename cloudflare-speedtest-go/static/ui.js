@@ -33,6 +33,10 @@ const UI = {
                         <th>速度(Mbps)</th>
                         <th>数据中心</th>
                         <th>峰值速度(Mbps)</th>
+                        <th>上传(Mbps)</th>
+                        <th>抖动(ms)</th>
+                        <th>丢包率</th>
+                        <th>评分</th>
                     </tr>
                 </thead>
                 <tbody>
@@ -40,14 +44,24 @@ const UI = {
 
         results.forEach(result => {
             const statusClass = this.getStatusClass(result.Status);
+            const statusLabel = result.StatusLabel || result.Status;
+            const stats = result.LatencyStats;
+            const timing = result.Timing;
+            const timingTitle = timing
+                ? `连接 ${timing.connect_ms.toFixed(1)} ms / TLS ${timing.tls_handshake_ms.toFixed(1)} ms / 首字节 ${timing.first_byte_ms.toFixed(1)} ms / 传输 ${timing.transfer_ms.toFixed(0)} ms`
+                : '';
             html += `
                 <tr>
                     <td>${result.IP}</td>
-                    <td><span class="status-badge ${statusClass}">${result.Status}</span></td>
+                    <td><span class="status-badge ${statusClass}">${statusLabel}</span></td>
                     <td>${result.Latency}</td>
-                    <td>${result.Speed}</td>
+                    <td title="${timingTitle}">${result.Speed}</td>
                     <td>${result.DataCenter}</td>
                     <td>${result.PeakSpeed.toFixed(2)}</td>
+                    <td>${result.UploadSpeed ? result.UploadSpeed.toFixed(2) : '-'}</td>
+                    <td>${stats ? stats.jitter_ms.toFixed(2) : '-'}</td>
+                    <td>${stats ? stats.loss_percent.toFixed(0) + '%' : '-'}</td>
+                    <td>${result.Score ? result.Score.toFixed(1) : '-'}</td>
                 </tr>
             `;
         });
@@ -58,10 +72,11 @@ const UI = {
 
     getStatusClass(status) {
         switch (status) {
-            case '已完成': return 'status-completed';
-            case '测试中': return 'status-testing';
-            case '待测试': return 'status-pending';
-            case '低速': return 'status-low-speed';
+            case 'completed': return 'status-completed';
+            case 'testing': return 'status-testing';
+            case 'pending': return 'status-pending';
+            case 'slow': return 'status-low-speed';
+            case 'unqualified': return 'status-low-speed';
             default: return 'status-error';
         }
     },